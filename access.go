@@ -0,0 +1,96 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+var ErrAccessDenied = fmt.Errorf("access denied")
+
+// registry key of the AccessPolicy of a VM
+const accessPolicyKey = "lua-pool.access"
+
+// Kinds of external resources
+type AccessKind int
+
+const (
+	AccessFile AccessKind = iota
+	AccessNetwork
+)
+
+func (k AccessKind) String() string {
+	switch k {
+	case AccessFile:
+		return "file"
+	case AccessNetwork:
+		return "network"
+	default:
+		return fmt.Sprintf("AccessKind(%d)", int(k))
+	}
+}
+
+// An access to an external resource requested by a script
+type Access struct {
+	Kind AccessKind
+	// e.g. "read", "write" or "connect"
+	Op string
+	// path of a file or address/URL of a network resource
+	Target string
+}
+
+// Decides about the external accesses of scripts. ctx is the context of the
+// execution, e.g. carrying the tenant set by ContextWithEnv. A non-nil error
+// denies the access.
+type AccessPolicy interface {
+	Allow(ctx context.Context, access Access) error
+}
+
+// Adapts a function to the AccessPolicy interface
+type AccessPolicyFunc func(ctx context.Context, access Access) error
+
+func (f AccessPolicyFunc) Allow(ctx context.Context, access Access) error {
+	return f(ctx, access)
+}
+
+// Sets the policy consulted by Go functions calling CheckAccess before
+// accessing files or the network on behalf of scripts of the pool. Of the
+// modules of this package only FSSearcher checks it, the standard io and os
+// libraries don't, so sandbox them (see WithDeniedFunctions) if the policy
+// must not be bypassed.
+func WithAccessPolicy(policy AccessPolicy) Option {
+	return func(p *Pool) {
+		p.accessPolicy = policy
+	}
+}
+
+// Asks the access policy of the VM (see WithAccessPolicy) whether the running
+// script may access the resource, returns nil for VMs without policy. The
+// policy isn't enforced automatically: Go functions accessing files or the
+// network have to call it first, e.g.
+//
+//	if err := pool.CheckAccess(l, pool.Access{Kind: pool.AccessFile, Op: "read", Target: path}); err != nil {
+//		lua.Errorf(l, "%s", err.Error())
+//	}
+func CheckAccess(l *lua.State, access Access) error {
+	l.Field(lua.RegistryIndex, accessPolicyKey)
+	policy, _ := l.ToUserData(-1).(AccessPolicy)
+	l.Pop(1)
+	if policy == nil {
+		return nil
+	}
+	ctx := l.GetContext()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := policy.Allow(ctx, access); err != nil {
+		return fmt.Errorf("%w: %s %s %q: %w", ErrAccessDenied, access.Op, access.Kind, access.Target, err)
+	}
+	return nil
+}
+
+func installAccessPolicy(vm *lua.State, policy AccessPolicy) {
+	vm.PushUserData(policy)
+	vm.SetField(lua.RegistryIndex, accessPolicyKey)
+}
@@ -0,0 +1,46 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestAccessPolicy(t *testing.T) {
+	fsys := fstest.MapFS{
+		"public/mod.lua":  {Data: []byte("return 'public'")},
+		"private/mod.lua": {Data: []byte("return 'private'")},
+	}
+	var checked []Access
+	policy := AccessPolicyFunc(func(ctx context.Context, access Access) error {
+		checked = append(checked, access)
+		env, _ := EnvFromContext(ctx)
+		if env["tenant"] != "admin" && strings.HasPrefix(access.Target, "private/") {
+			return errors.New("forbidden")
+		}
+		return nil
+	})
+	lpool := NewPool(1, nil,
+		WithReadOnlyGlobals(true),
+		WithSearcher(FSSearcher(fsys)),
+		WithAccessPolicy(policy),
+	)
+	guest := ContextWithEnv(context.Background(), map[string]any{"tenant": "guest"})
+	admin := ContextWithEnv(context.Background(), map[string]any{"tenant": "admin"})
+
+	results, err := lpool.Eval(guest, "return require('public.mod')")
+	if err != nil || len(results) != 1 || results[0] != "public" {
+		t.Errorf("unexpected results %v, %v", results, err)
+	}
+	if _, err := lpool.Eval(guest, "return require('private.mod')"); err == nil || !strings.Contains(err.Error(), "access denied") {
+		t.Errorf("expected access to be denied but got %v", err)
+	}
+	if _, err := lpool.Eval(admin, "return require('private.mod')"); err != nil {
+		t.Errorf("expected access to be allowed but got %v", err)
+	}
+	if len(checked) != 3 || checked[0] != (Access{Kind: AccessFile, Op: "read", Target: "public/mod.lua"}) {
+		t.Errorf("unexpected checks %v", checked)
+	}
+}
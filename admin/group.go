@@ -0,0 +1,43 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+
+	pool "github.com/epikur-io/go-lua-pool"
+)
+
+// Group is the subset of pool.Group functionality required by the group
+// handler
+type Group interface {
+	Stats() map[string]pool.Stats
+	Lookup(key string) (*pool.Pool, bool)
+}
+
+// NewGroupHandler returns a http.Handler exposing the pools of a group:
+//
+//	GET  /stats                   stats of all pools by key
+//	*    /pools/{key}/...         the endpoints of NewHandler for the pool of key
+//
+// Pools are looked up without being created, unknown keys fail with 404.
+func NewGroupHandler(g Group) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		if allowMethod(w, r, http.MethodGet) {
+			writeJSON(w, http.StatusOK, g.Stats())
+		}
+	})
+	mux.HandleFunc("/pools/{key}/{endpoint}", func(w http.ResponseWriter, r *http.Request) {
+		key := r.PathValue("key")
+		p, ok := g.Lookup(key)
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Errorf("unknown pool %q", key))
+			return
+		}
+		r2 := r.Clone(r.Context())
+		r2.URL.Path = "/" + r.PathValue("endpoint")
+		r2.URL.RawPath = ""
+		NewHandler(p).ServeHTTP(w, r2)
+	})
+	return mux
+}
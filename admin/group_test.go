@@ -0,0 +1,49 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	pool "github.com/epikur-io/go-lua-pool"
+)
+
+func TestGroupHandler(t *testing.T) {
+	g, err := pool.NewGroup(2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	g.Pool("a")
+	h := NewGroupHandler(g)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats", nil))
+	var stats map[string]pool.Stats
+	if err := json.NewDecoder(rec.Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 || stats["a"].Capacity != 2 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/pools/a/update?timeout=1s", nil))
+	var resp updateResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK || resp.Removed == nil || *resp.Removed != 2 {
+		t.Errorf("unexpected response %d %+v", rec.Code, resp)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/pools/b/stats", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected status %d but got %d", http.StatusNotFound, rec.Code)
+	}
+	if _, ok := g.Lookup("b"); ok {
+		t.Error("expected the pool not to be created")
+	}
+}
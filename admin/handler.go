@@ -0,0 +1,164 @@
+// Package admin provides an HTTP handler to inspect and manage a Lua VM pool
+// from operational tooling.
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	pool "github.com/epikur-io/go-lua-pool"
+)
+
+// Pool is the subset of pool functionality required by the handler
+type Pool interface {
+	Stats() pool.Stats
+	Update()
+	UpdateWithTimeout(time.Duration) (int, int)
+}
+
+// Closer is implemented by pools which can be closed, like pool.Pool
+type Closer interface {
+	Close()
+}
+
+var ErrNotSupported = errors.New("operation not supported by pool")
+
+// pools have a fixed capacity, a pool of another size has to be created
+var errResizeNotSupported = fmt.Errorf("%w: the capacity of a pool is fixed, create a new pool instead", ErrNotSupported)
+
+// interval in which /drain checks whether all VMs were released
+const drainPollInterval = 10 * time.Millisecond
+
+// NewHandler returns a http.Handler exposing the following endpoints:
+//
+//	GET  /stats                   current pool stats
+//	POST /update[?timeout=5s]     replace all VMs of the pool
+//	POST /drain[?timeout=5s]      close the pool and wait for acquired VMs (requires Closer)
+//	POST /resize?size=N           always fails with 501, the capacity of a pool is fixed
+//
+// All responses are JSON encoded. Mount it with http.StripPrefix when serving
+// it below a sub path.
+func NewHandler(p Pool) http.Handler {
+	h := &handler{pool: p}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stats", h.stats)
+	mux.HandleFunc("/update", h.update)
+	mux.HandleFunc("/drain", h.drain)
+	mux.HandleFunc("/resize", h.resize)
+	return mux
+}
+
+type handler struct {
+	pool Pool
+}
+
+type updateResponse struct {
+	// absent if the update didn't report the counts
+	Removed *int       `json:"removed,omitempty"`
+	Created *int       `json:"created,omitempty"`
+	Stats   pool.Stats `json:"stats"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func (h *handler) stats(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	writeJSON(w, http.StatusOK, h.pool.Stats())
+}
+
+func (h *handler) update(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	to, err := durationParam(r, "timeout")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var resp updateResponse
+	if to > 0 {
+		removed, created := h.pool.UpdateWithTimeout(to)
+		resp.Removed, resp.Created = &removed, &created
+	} else {
+		h.pool.Update()
+	}
+	resp.Stats = h.pool.Stats()
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *handler) drain(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	c, ok := h.pool.(Closer)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, ErrNotSupported)
+		return
+	}
+	to, err := durationParam(r, "timeout")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	c.Close()
+	if to > 0 {
+		ctx, cancel := context.WithTimeout(r.Context(), to)
+		defer cancel()
+		ticker := time.NewTicker(drainPollInterval)
+		defer ticker.Stop()
+		for h.pool.Stats().InUse > 0 && ctx.Err() == nil {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+			}
+		}
+	}
+	// VMs acquired until the timeout are still in use
+	writeJSON(w, http.StatusOK, h.pool.Stats())
+}
+
+func (h *handler) resize(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	writeError(w, http.StatusNotImplemented, errResizeNotSupported)
+}
+
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	return false
+}
+
+func durationParam(r *http.Request, name string) (time.Duration, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, errors.New("invalid " + name + " parameter")
+	}
+	return d, nil
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,96 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	pool "github.com/epikur-io/go-lua-pool"
+)
+
+func TestStatsEndpoint(t *testing.T) {
+	lpool := pool.NewPool(2, nil)
+	lvm := lpool.Acquire()
+	defer lpool.Release(lvm)
+
+	rec := httptest.NewRecorder()
+	NewHandler(lpool).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d but got %d", http.StatusOK, rec.Code)
+	}
+	var stats pool.Stats
+	if err := json.NewDecoder(rec.Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Capacity != 2 || stats.InUse != 1 || stats.Idle != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestUpdateEndpoint(t *testing.T) {
+	lpool := pool.NewPool(2, nil)
+	h := NewHandler(lpool)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/update", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status %d but got %d", http.StatusMethodNotAllowed, rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/update?timeout=1s", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d but got %d", http.StatusOK, rec.Code)
+	}
+	var resp updateResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Removed == nil || *resp.Removed != 2 || resp.Created == nil || *resp.Created != 2 {
+		t.Errorf("expected 2 removed and created instances but got %+v", resp)
+	}
+
+	// the counts of updates without timeout are unknown
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/update", nil))
+	resp = updateResponse{}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Removed != nil || resp.Created != nil {
+		t.Errorf("expected no counts but got %+v", resp)
+	}
+}
+
+func TestDrainEndpoint(t *testing.T) {
+	lpool := pool.NewPool(2, nil)
+	h := NewHandler(lpool)
+	vm := lpool.Acquire()
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		lpool.Release(vm)
+	}()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/drain?timeout=5s", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d but got %d", http.StatusOK, rec.Code)
+	}
+	var stats pool.Stats
+	if err := json.NewDecoder(rec.Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+	if !lpool.Closed() || stats.InUse != 0 {
+		t.Errorf("expected a closed pool without VMs in use but got %+v", stats)
+	}
+}
+
+func TestResizeEndpoint(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewHandler(pool.NewPool(1, nil)).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/resize?size=3", nil))
+	if rec.Code != http.StatusNotImplemented {
+		t.Errorf("expected status %d but got %d", http.StatusNotImplemented, rec.Code)
+	}
+}
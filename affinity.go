@@ -0,0 +1,25 @@
+package pool
+
+import (
+	"context"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+// Sets how many session keys of AcquireFor a VM remembers (default
+// generic.DefaultAffinityKeys), the least recently used key is forgotten first
+func WithAffinityKeys(n int) Option {
+	return func(p *Pool) {
+		p.affinityKeys = n
+	}
+}
+
+// Acquires the VM last acquired for key if it is idle and any VM otherwise, so
+// state a session builds up inside the VM, like caches, is likely to be found
+// again. Scripts must not rely on it: the VM may be busy, replaced or handed
+// to other keys in between.
+func (p *Pool) AcquireFor(ctx context.Context, key string) (*lua.State, error) {
+	start := p.debugNow()
+	vm, err := p.core.AcquireFor(ctx, key)
+	return p.finishAcquire(vm, start, err)
+}
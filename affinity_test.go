@@ -0,0 +1,28 @@
+package pool
+
+import (
+	"context"
+	"testing"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+func TestAcquireFor(t *testing.T) {
+	lpool := NewPool(4, nil)
+	ctx := context.Background()
+	vm, err := lpool.AcquireFor(ctx, "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lua.DoString(vm, "cache = 42"); err != nil {
+		t.Fatal(err)
+	}
+	lpool.Release(vm)
+	vm, _ = lpool.AcquireFor(ctx, "session")
+	defer lpool.Release(vm)
+	vm.Global("cache")
+	if n, _ := vm.ToInteger(-1); n != 42 {
+		t.Errorf("expected the VM of the session")
+	}
+	vm.Pop(1)
+}
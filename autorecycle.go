@@ -0,0 +1,55 @@
+package pool
+
+import (
+	lua "github.com/epikur-io/go-lua"
+)
+
+// Replaces VMs after n failed executions in a row, as a corrupted VM tends to
+// fail every further script. Executions of all helpers count (Do, Eval, Run,
+// RunStream, Executor, RunOnAll, ForEachIdle, ...), whether or not the caller
+// handled the error; errors of canceled or timed out contexts don't. The VM is
+// replaced, or quarantined (see WithQuarantine), the next time it is released.
+// Code run on VMs acquired directly reports its errors with ReportError. 0
+// disables it.
+func WithAutoRecycle(n int) Option {
+	return func(p *Pool) {
+		p.autoRecycle = n
+	}
+}
+
+// marks VMs to be replaced on release
+type doomedKey struct{}
+
+// Counts the outcome of code run on a VM acquired from the pool, see
+// WithAutoRecycle. A nil err ends a series of errors.
+func (p *Pool) ReportError(vm *lua.State, err error) {
+	if vm == nil || !p.countingErrors() {
+		return
+	}
+	if err == nil {
+		p.core.DeleteData(vm, errorCountKey{})
+		return
+	}
+	count := p.errorCount(vm) + 1
+	p.core.SetData(vm, errorCountKey{}, count)
+	if p.autoRecycle > 0 && count >= p.autoRecycle {
+		p.core.SetData(vm, doomedKey{}, true)
+	}
+}
+
+// true if the VM reached the auto recycle threshold
+func (p *Pool) doomed(vm *lua.State) bool {
+	if p.autoRecycle <= 0 {
+		return false
+	}
+	_, doomed := p.core.Data(vm, doomedKey{})
+	return doomed
+}
+
+// validator of the pool
+func (p *Pool) validVM(vm *lua.State) bool {
+	if p.doomed(vm) {
+		return false
+	}
+	return p.chaos == nil || p.injectValidationFault(vm)
+}
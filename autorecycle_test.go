@@ -0,0 +1,47 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+func TestAutoRecycle(t *testing.T) {
+	lpool := NewPool(1, nil, WithAutoRecycle(2))
+	ctx := context.Background()
+	vm := lpool.Acquire()
+	lpool.Release(vm)
+
+	// the caller handles the errors itself
+	for _, code := range []string{"error('a')", "return 1", "error('b')"} {
+		lpool.DoWithContext(ctx, func(vm *lua.State) error {
+			return lua.DoString(vm, code)
+		})
+	}
+	if next := lpool.Acquire(); next != vm {
+		t.Fatalf("expected the VM to be kept below 2 errors in a row")
+	} else {
+		// reported by a caller running code on an acquired VM
+		lpool.ReportError(next, errors.New("c"))
+		lpool.Release(next)
+	}
+	next := lpool.Acquire()
+	defer lpool.Release(next)
+	if next == vm {
+		t.Errorf("expected the VM to be replaced after 2 errors in a row")
+	}
+
+	// RunOnAll executions count as well, idle VMs are replaced after their
+	// next use
+	other := NewPool(1, nil, WithAutoRecycle(1))
+	other.RunScriptOnAll(ctx, "error('x')")
+	vm = other.Acquire()
+	other.Release(vm)
+	if next := other.Acquire(); next == vm {
+		t.Errorf("expected the VM to be replaced on release")
+	} else {
+		other.Release(next)
+	}
+}
@@ -0,0 +1,61 @@
+package pool
+
+import (
+	"context"
+	"sync"
+)
+
+// BatchOptions configures RunBatch
+type BatchOptions struct {
+	// maximum number of inputs processed in parallel, defaults to the pool capacity
+	Concurrency int
+}
+
+// BatchResult holds the outcome of a single input of RunBatch
+type BatchResult struct {
+	Results []any
+	Err     error
+}
+
+// Runs a script of the script registry once per input, passing the input as
+// the only argument (see Run). The inputs are spread over the pooled VMs with
+// at most opts.Concurrency executions at a time. The returned results have the
+// same order as the inputs, failed executions only fail their own entry.
+// An error is returned if the script doesn't exist.
+func (p *Pool) RunBatch(ctx context.Context, name string, inputs []any, opts BatchOptions) ([]BatchResult, error) {
+	if _, err := p.script(name); err != nil {
+		return nil, err
+	}
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = p.Cap()
+	}
+	results := make([]BatchResult, len(inputs))
+	fanOut(len(inputs), concurrency, func(i int) {
+		results[i].Results, results[i].Err = p.Run(ctx, name, inputs[i])
+	})
+	return results, nil
+}
+
+// calls fn for every index in [0, n) using at most concurrency goroutines
+func fanOut(n int, concurrency int, fn func(i int)) {
+	if concurrency > n {
+		concurrency = n
+	}
+	next := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(concurrency)
+	for range concurrency {
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				fn(i)
+			}
+		}()
+	}
+	for i := range n {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+}
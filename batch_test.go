@@ -0,0 +1,70 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+func TestRunBatch(t *testing.T) {
+	scripts := NewScriptRegistry()
+	if err := scripts.Register("square", `
+		local n = ...
+		if n < 0 then error("negative") end
+		enter() leave()
+		return n * n`); err != nil {
+		t.Fatal(err)
+	}
+	var running, maxRunning atomic.Int32
+	lpool := NewPool(4, func() *lua.State {
+		vm := NewLuaVM()
+		vm.Register("enter", func(l *lua.State) int {
+			n := running.Add(1)
+			for {
+				m := maxRunning.Load()
+				if n <= m || maxRunning.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			return 0
+		})
+		vm.Register("leave", func(l *lua.State) int {
+			running.Add(-1)
+			return 0
+		})
+		return vm
+	}, WithScriptRegistry(scripts))
+
+	inputs := []any{1, 2, -1, 4, 5, 6, 7, 8}
+	results, err := lpool.RunBatch(context.Background(), "square", inputs, BatchOptions{Concurrency: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(inputs) {
+		t.Fatalf("expected %d results but got %d", len(inputs), len(results))
+	}
+	for i, res := range results {
+		n := inputs[i].(int)
+		if n < 0 {
+			var serr *ScriptError
+			if !errors.As(res.Err, &serr) {
+				t.Errorf("input %d: expected script error but got %v", i, res.Err)
+			}
+			continue
+		}
+		if res.Err != nil || !reflect.DeepEqual(res.Results, []any{float64(n * n)}) {
+			t.Errorf("input %d: unexpected result %v, %v", i, res.Results, res.Err)
+		}
+	}
+	if m := maxRunning.Load(); m > 2 {
+		t.Errorf("expected at most 2 parallel executions but got %d", m)
+	}
+
+	if _, err := lpool.RunBatch(context.Background(), "missing", inputs, BatchOptions{}); !errors.Is(err, ErrScriptNotFound) {
+		t.Errorf("expected script not found but got %v", err)
+	}
+}
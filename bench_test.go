@@ -0,0 +1,50 @@
+package pool
+
+import (
+	"context"
+	"testing"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+// overhead the Lua pool adds on top of the generic pool in its modes
+func BenchmarkPoolAcquireRelease(b *testing.B) {
+	for _, bc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"default", nil},
+		{"tracking", []Option{WithAcquireTracking(true)}},
+		{"snapshot", []Option{WithGlobalsSnapshot(true)}},
+		{"readonly", []Option{WithReadOnlyGlobals(true)}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			lpool := NewPool(8, nil, bc.opts...)
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					lpool.Release(lpool.Acquire())
+				}
+			})
+		})
+	}
+}
+
+// a complete execution: acquire, run a Lua function, release
+func BenchmarkPoolDo(b *testing.B) {
+	lpool := NewPool(8, nil)
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			err := lpool.DoWithContext(ctx, func(vm *lua.State) error {
+				return lua.DoString(vm, "local x = 1 + 1")
+			})
+			if err != nil {
+				b.Error(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,234 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	lua "github.com/epikur-io/go-lua"
+	"github.com/epikur-io/go-lua-pool/generic"
+)
+
+var ErrCircuitOpen = fmt.Errorf("circuit breaker open")
+
+// State of a Breaker
+type BreakerState int
+
+const (
+	// executions pass, failures are counted
+	BreakerClosed BreakerState = iota
+	// executions fail fast with ErrCircuitOpen
+	BreakerOpen
+	// a limited number of probe executions pass to check for recovery
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("BreakerState(%d)", int(s))
+}
+
+// Thresholds of a Breaker, zero fields use the defaults
+type BreakerOptions struct {
+	// number of recent executions the failure rate is computed over (20)
+	Window int
+	// minimum number of executions in the window before the breaker opens (10)
+	MinExecutions int
+	// failure rate in (0, 1] opening the breaker (0.5)
+	FailureRate float64
+	// time the breaker stays open before probing (5s)
+	Cooldown time.Duration
+	// concurrent probes while half-open, the breaker closes once as many
+	// succeeded in a row (1)
+	Probes int
+	// called on every state change
+	OnStateChange func(from, to BreakerState)
+	// measures the cooldown (generic.SystemClock)
+	Clock generic.Clock
+}
+
+// Breaker sheds load by failing fast when executions keep failing, e.g. because
+// of a broken script bundle or an exhausted pool, instead of queueing behind
+// them. Cancellations by the caller don't count as failures.
+type Breaker struct {
+	opts BreakerOptions
+
+	mux      sync.Mutex
+	state    BreakerState
+	outcomes []bool // ring of recent results, true on failure
+	next     int
+	n        int
+	failures int
+	openedAt time.Time
+	// running and successful probes while half-open
+	probing   int
+	succeeded int
+}
+
+func NewBreaker(opts BreakerOptions) *Breaker {
+	if opts.Window <= 0 {
+		opts.Window = 20
+	}
+	if opts.MinExecutions <= 0 {
+		opts.MinExecutions = 10
+	}
+	if opts.FailureRate <= 0 {
+		opts.FailureRate = 0.5
+	}
+	if opts.Cooldown <= 0 {
+		opts.Cooldown = 5 * time.Second
+	}
+	if opts.Probes <= 0 {
+		opts.Probes = 1
+	}
+	if opts.Clock == nil {
+		opts.Clock = generic.SystemClock
+	}
+	return &Breaker{opts: opts, outcomes: make([]bool, opts.Window)}
+}
+
+func (b *Breaker) State() BreakerState {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if b.state == BreakerOpen && b.opts.Clock.Now().Sub(b.openedAt) >= b.opts.Cooldown {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+// Runs fn unless the breaker is open and records its result
+func (b *Breaker) Do(fn func() error) error {
+	if err := b.Allow(); err != nil {
+		return err
+	}
+	err := fn()
+	b.Record(err)
+	return err
+}
+
+// Returns ErrCircuitOpen if an execution isn't allowed right now, otherwise
+// its result must be passed to Record
+func (b *Breaker) Allow() error {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if b.state == BreakerOpen {
+		if b.opts.Clock.Now().Sub(b.openedAt) < b.opts.Cooldown {
+			return ErrCircuitOpen
+		}
+		b.setState(BreakerHalfOpen)
+	}
+	if b.state == BreakerHalfOpen {
+		if b.probing >= b.opts.Probes-b.succeeded {
+			return ErrCircuitOpen
+		}
+		b.probing++
+	}
+	return nil
+}
+
+// Records the result of an execution allowed by Allow
+func (b *Breaker) Record(err error) {
+	failed := err != nil && !errors.Is(err, context.Canceled)
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	switch b.state {
+	case BreakerHalfOpen:
+		// results of executions allowed before the breaker opened don't count
+		if b.probing == 0 {
+			return
+		}
+		b.probing--
+		if failed {
+			b.open()
+			return
+		}
+		if b.succeeded++; b.succeeded >= b.opts.Probes {
+			b.setState(BreakerClosed)
+		}
+	case BreakerClosed:
+		if b.outcomes[b.next] {
+			b.failures--
+		}
+		b.outcomes[b.next] = failed
+		if failed {
+			b.failures++
+		}
+		b.next = (b.next + 1) % len(b.outcomes)
+		b.n = min(b.n+1, len(b.outcomes))
+		if b.n >= b.opts.MinExecutions && float64(b.failures) >= b.opts.FailureRate*float64(b.n) {
+			b.open()
+		}
+	}
+}
+
+// requires b.mux
+func (b *Breaker) open() {
+	b.openedAt = b.opts.Clock.Now()
+	b.setState(BreakerOpen)
+}
+
+// requires b.mux
+func (b *Breaker) setState(state BreakerState) {
+	from := b.state
+	b.state = state
+	b.probing, b.succeeded = 0, 0
+	if state == BreakerClosed {
+		clear(b.outcomes)
+		b.next, b.n, b.failures = 0, 0, 0
+	}
+	if b.opts.OnStateChange != nil && from != state {
+		b.opts.OnStateChange(from, state)
+	}
+}
+
+// BreakerPool decorates an IPool with a Breaker: acquires fail fast with
+// ErrCircuitOpen while it is open and failed acquires (e.g. timeouts) count as
+// failures. Executions can be guarded by the same breaker via Breaker.Do.
+type BreakerPool struct {
+	IPool
+	*Breaker
+}
+
+// ensure interface is satisfied
+var _ IPool = &BreakerPool{}
+
+func NewBreakerPool(p IPool, b *Breaker) *BreakerPool {
+	return &BreakerPool{IPool: p, Breaker: b}
+}
+
+// Acquire can't fail fast, it blocks even if the breaker is open
+func (p *BreakerPool) Acquire() *lua.State {
+	allowed := p.Allow() == nil
+	vm := p.IPool.Acquire()
+	if allowed {
+		p.Record(nil)
+	}
+	return vm
+}
+
+func (p *BreakerPool) AcquireWithTimeout(to time.Duration) (*lua.State, error) {
+	if err := p.Allow(); err != nil {
+		return nil, err
+	}
+	vm, err := p.IPool.AcquireWithTimeout(to)
+	p.Record(err)
+	return vm, err
+}
+
+func (p *BreakerPool) AcquireWithContext(ctx context.Context) (*lua.State, error) {
+	if err := p.Allow(); err != nil {
+		return nil, err
+	}
+	vm, err := p.IPool.AcquireWithContext(ctx)
+	p.Record(err)
+	return vm, err
+}
@@ -0,0 +1,71 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	var changes []BreakerState
+	b := NewBreaker(BreakerOptions{
+		Window:        4,
+		MinExecutions: 4,
+		Cooldown:      10 * time.Millisecond,
+		OnStateChange: func(_, to BreakerState) { changes = append(changes, to) },
+	})
+	lpool := NewPool(1, nil)
+	run := func(code string) error {
+		return b.Do(func() error {
+			_, err := lpool.Eval(context.Background(), code)
+			return err
+		})
+	}
+
+	for _, code := range []string{"return 1", "error('broken')", "return 1", "error('broken')"} {
+		run(code)
+	}
+	if err := run("return 1"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected %v but got %v", ErrCircuitOpen, err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if s := b.State(); s != BreakerHalfOpen {
+		t.Errorf("expected %s but got %s", BreakerHalfOpen, s)
+	}
+	// a failed probe opens the breaker again
+	if err := run("error('still broken')"); err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected probe to run but got %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if err := run("return 1"); err != nil {
+		t.Fatal(err)
+	}
+	if s := b.State(); s != BreakerClosed {
+		t.Errorf("expected %s but got %s", BreakerClosed, s)
+	}
+	want := []BreakerState{BreakerOpen, BreakerHalfOpen, BreakerOpen, BreakerHalfOpen, BreakerClosed}
+	if len(changes) != len(want) {
+		t.Fatalf("expected state changes %v but got %v", want, changes)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("expected state changes %v but got %v", want, changes)
+			break
+		}
+	}
+}
+
+func TestBreakerPool(t *testing.T) {
+	p := NewBreakerPool(NewPool(1, nil), NewBreaker(BreakerOptions{Window: 2, MinExecutions: 2, FailureRate: 1, Cooldown: time.Hour}))
+	vm := p.Acquire()
+	for range 2 {
+		if _, err := p.AcquireWithTimeout(time.Millisecond); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Errorf("expected acquire to time out but got %v", err)
+		}
+	}
+	p.Release(vm)
+	if _, err := p.AcquireWithContext(context.Background()); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected %v but got %v", ErrCircuitOpen, err)
+	}
+}
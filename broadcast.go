@@ -0,0 +1,76 @@
+package pool
+
+import (
+	"context"
+
+	lua "github.com/epikur-io/go-lua"
+	"github.com/epikur-io/go-lua-pool/generic"
+)
+
+// Reported by RunOnAll for VMs removed from the pool before fn ran
+var ErrVMRemoved = generic.ErrStateRemoved
+
+// Outcome of RunOnAll for a single VM, see Pool.VMID
+type RunResult = generic.RunResult
+
+// Runs fn on every VM of the pool, right away on idle VMs and on busy ones as
+// they are released, e.g. to push configuration or feature flags without an
+// Update. VMs created afterwards, e.g. by Update, are not covered, neither are
+// globals kept with WithGlobalsSnapshot or WithReadOnlyGlobals, which discard
+// them on the next release. fn runs like in DoWithContext. Waits until fn ran
+// on every VM or ctx is done, VMs fn didn't run on by then report the error of
+// ctx. Don't call it while holding a VM of the pool without a deadline.
+func (p *Pool) RunOnAll(ctx context.Context, fn func(*lua.State) error) []RunResult {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	q := p.quotaFor(ctx, "")
+	return p.core.RunOnAll(ctx, func(vm *lua.State) error {
+		return p.exec(ctx, vm, q, nil, fn)
+	})
+}
+
+// Runs a chunk of Lua code on every VM of the pool, see RunOnAll. Errors
+// raised by the chunk are returned as *ScriptError.
+func (p *Pool) RunScriptOnAll(ctx context.Context, code string) []RunResult {
+	return p.RunOnAll(ctx, func(vm *lua.State) error {
+		return doString(vm, code)
+	})
+}
+
+// Sets a global on every VM of the pool, e.g. a config value or feature flag,
+// value is converted like the arguments of Eval (see PushValue). Unlike
+// globals assigned by scripts it is kept across releases with
+// WithGlobalsSnapshot and WithReadOnlyGlobals. A nil value deletes the global.
+// See RunOnAll for which VMs are covered.
+func (p *Pool) SetGlobalOnAll(ctx context.Context, name string, value any) []RunResult {
+	return p.RunOnAll(ctx, func(vm *lua.State) error {
+		if err := PushValue(vm, value); err != nil {
+			return err
+		}
+		p.setBaseGlobal(vm, name)
+		return nil
+	})
+}
+
+// Deletes a global on every VM of the pool, see SetGlobalOnAll
+func (p *Pool) DeleteGlobalOnAll(ctx context.Context, name string) []RunResult {
+	return p.SetGlobalOnAll(ctx, name, nil)
+}
+
+// sets the global name to the value on top of the stack so that it survives
+// the reset of released VMs and pops the value
+func (p *Pool) setBaseGlobal(vm *lua.State, name string) {
+	switch {
+	case p.readOnlyGlobals:
+		if p.snapshotGlobals {
+			vm.PushValue(-1)
+			setSnapshotGlobal(vm, name)
+		}
+		setFrozenGlobal(vm, name)
+	case p.snapshotGlobals:
+		setSnapshotGlobal(vm, name)
+	default:
+		vm.SetGlobal(name)
+	}
+}
@@ -0,0 +1,79 @@
+package pool
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+func TestRunOnAll(t *testing.T) {
+	lpool := NewPool(3, nil)
+	held := lpool.Acquire()
+	done := make(chan []RunResult)
+	go func() {
+		done <- lpool.RunScriptOnAll(context.Background(), "flag = true")
+	}()
+	time.Sleep(10 * time.Millisecond)
+	lpool.Release(held)
+	results := <-done
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results but got %v", results)
+	}
+	for _, r := range results {
+		if r.Err != nil || r.ID == 0 {
+			t.Errorf("unexpected result %+v", r)
+		}
+	}
+	var vms []*lua.State
+	for range 3 {
+		vm := lpool.Acquire()
+		vms = append(vms, vm)
+		vm.Global("flag")
+		if !vm.ToBoolean(-1) {
+			t.Errorf("expected the flag in every VM")
+		}
+		vm.Pop(1)
+	}
+	for _, vm := range vms {
+		lpool.Release(vm)
+	}
+
+	// syntax errors are reported per VM
+	for _, r := range lpool.RunScriptOnAll(context.Background(), "flag =") {
+		if r.Err == nil {
+			t.Errorf("expected an error")
+		}
+	}
+}
+
+func TestSetGlobalOnAll(t *testing.T) {
+	for _, opts := range [][]Option{
+		nil,
+		{WithGlobalsSnapshot(true)},
+		{WithReadOnlyGlobals(true)},
+	} {
+		lpool := NewPool(2, nil, opts...)
+		ctx := context.Background()
+		for _, r := range lpool.SetGlobalOnAll(ctx, "limits", map[string]any{"max": 3}) {
+			if r.Err != nil {
+				t.Fatal(r.Err)
+			}
+		}
+		// survives the reset of released VMs
+		for range 3 {
+			results, err := lpool.Eval(ctx, "return limits.max")
+			if err != nil || len(results) != 1 || results[0] != float64(3) {
+				t.Errorf("expected the global but got %v, %v", results, err)
+			}
+		}
+		lpool.DeleteGlobalOnAll(ctx, "limits")
+		for range 3 {
+			results, err := lpool.Eval(ctx, "return limits")
+			if err != nil || len(results) != 1 || results[0] != nil {
+				t.Errorf("expected the global to be deleted but got %v, %v", results, err)
+			}
+		}
+	}
+}
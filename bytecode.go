@@ -0,0 +1,139 @@
+package pool
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+var ErrInvalidSnapshot = fmt.Errorf("invalid bytecode snapshot")
+
+// SetupScript is a named chunk of Lua code run when a VM is set up
+type SetupScript struct {
+	Name   string
+	Source string
+}
+
+// BytecodeSnapshot holds setup scripts compiled once, so new VMs load the
+// bytecode instead of parsing the sources again. Snapshots are immutable and
+// can be stored (see MarshalBinary) and shared by pools.
+type BytecodeSnapshot struct {
+	chunks []compiledChunk
+}
+
+type compiledChunk struct {
+	name     string
+	bytecode []byte
+}
+
+// Compiles the scripts in the given order
+func NewBytecodeSnapshot(scripts ...SetupScript) (*BytecodeSnapshot, error) {
+	s := &BytecodeSnapshot{}
+	for _, script := range scripts {
+		bytecode, err := compile(script.Name, script.Source)
+		if err != nil {
+			return nil, err
+		}
+		s.chunks = append(s.chunks, compiledChunk{name: script.Name, bytecode: bytecode})
+	}
+	return s, nil
+}
+
+// Runs the compiled scripts in vm, stops at the first failing one
+func (s *BytecodeSnapshot) Apply(vm *lua.State) error {
+	top := vm.Top()
+	defer vm.SetTop(top)
+	vm.PushGoFunction(tracebackHandler)
+	handler := vm.Top()
+	for _, c := range s.chunks {
+		if err := vm.Load(bytes.NewReader(c.bytecode), chunkName(c.name), "b"); err != nil {
+			return fmt.Errorf("%s: %w", c.name, err)
+		}
+		if err := protectedCall(vm, handler, nil); err != nil {
+			return fmt.Errorf("%s: %w", c.name, err)
+		}
+		vm.SetTop(handler)
+	}
+	return nil
+}
+
+// Encodes the snapshot, e.g. to build it once and ship it as an artifact. The
+// bytecode is only compatible with the same version of go-lua.
+func (s *BytecodeSnapshot) MarshalBinary() ([]byte, error) {
+	var buf []byte
+	buf = binary.AppendUvarint(buf, uint64(len(s.chunks)))
+	for _, c := range s.chunks {
+		buf = binary.AppendUvarint(buf, uint64(len(c.name)))
+		buf = append(buf, c.name...)
+		buf = binary.AppendUvarint(buf, uint64(len(c.bytecode)))
+		buf = append(buf, c.bytecode...)
+	}
+	return buf, nil
+}
+
+// Decodes a snapshot encoded by MarshalBinary
+func (s *BytecodeSnapshot) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+	field := func() ([]byte, error) {
+		n, err := binary.ReadUvarint(r)
+		if err != nil || n > uint64(r.Len()) {
+			return nil, ErrInvalidSnapshot
+		}
+		b := make([]byte, n)
+		r.Read(b)
+		return b, nil
+	}
+	count, err := binary.ReadUvarint(r)
+	if err != nil || count > uint64(r.Len()) {
+		return ErrInvalidSnapshot
+	}
+	chunks := make([]compiledChunk, 0, count)
+	for range count {
+		name, err := field()
+		if err != nil {
+			return err
+		}
+		bytecode, err := field()
+		if err != nil {
+			return err
+		}
+		chunks = append(chunks, compiledChunk{name: string(name), bytecode: bytecode})
+	}
+	if r.Len() > 0 {
+		return ErrInvalidSnapshot
+	}
+	s.chunks = chunks
+	return nil
+}
+
+// Runs the scripts of the snapshot in every VM created by the pool, after the
+// VM factory. Failing scripts are logged and the VM is used nevertheless.
+func WithBytecodeSnapshot(s *BytecodeSnapshot) Option {
+	return func(p *Pool) {
+		p.bytecodeSnapshot.Store(s)
+	}
+}
+
+// Returns the snapshot used to set up new VMs, nil if there is none
+func (p *Pool) BytecodeSnapshot() *BytecodeSnapshot {
+	return p.bytecodeSnapshot.Load()
+}
+
+// Replaces the snapshot used to set up new VMs and updates all VMs, see Update
+func (p *Pool) UpdateBytecodeSnapshot(s *BytecodeSnapshot) {
+	p.bytecodeSnapshot.Store(s)
+	p.Update()
+}
+
+func (p *Pool) applySnapshot(vm *lua.State) {
+	s := p.bytecodeSnapshot.Load()
+	if s == nil {
+		return
+	}
+	if err := s.Apply(vm); err != nil {
+		p.logger.Error("lua pool: failed to apply bytecode snapshot", slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,82 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+func TestBytecodeSnapshot(t *testing.T) {
+	s, err := NewBytecodeSnapshot(
+		SetupScript{Name: "lib", Source: "function greet(name) return 'hello ' .. name end"},
+		SetupScript{Name: "config", Source: "greeting = greet('snapshot')"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := s.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded BytecodeSnapshot
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := decoded.UnmarshalBinary(data[:len(data)-1]); !errors.Is(err, ErrInvalidSnapshot) {
+		t.Errorf("expected %v but got %v", ErrInvalidSnapshot, err)
+	}
+
+	lpool := NewPool(2, nil, WithBytecodeSnapshot(&decoded))
+	res, err := lpool.Eval(context.Background(), "return greeting")
+	if err != nil || len(res) != 1 || res[0] != "hello snapshot" {
+		t.Errorf("unexpected result %v, %v", res, err)
+	}
+
+	next, err := NewBytecodeSnapshot(SetupScript{Name: "config", Source: "greeting = 'updated'"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lpool.UpdateBytecodeSnapshot(next)
+	if lpool.BytecodeSnapshot() != next {
+		t.Errorf("expected snapshot to be replaced")
+	}
+	res, err = lpool.Eval(context.Background(), "return greeting")
+	if err != nil || len(res) != 1 || res[0] != "updated" {
+		t.Errorf("unexpected result %v, %v", res, err)
+	}
+
+	failing, _ := NewBytecodeSnapshot(SetupScript{Name: "broken", Source: "error('boom')"})
+	var scriptErr *ScriptError
+	if err := failing.Apply(NewLuaVM()); !errors.As(err, &scriptErr) || !strings.Contains(scriptErr.Traceback, "broken:1:") {
+		t.Errorf("expected setup error but got %v", err)
+	}
+	if _, err := NewBytecodeSnapshot(SetupScript{Name: "syntax", Source: "function"}); err == nil {
+		t.Errorf("expected compile error")
+	}
+}
+
+func BenchmarkBytecodeSnapshot(b *testing.B) {
+	source := strings.Repeat(prototypeScript, 20)
+	b.Run("source", func(b *testing.B) {
+		for range b.N {
+			vm := NewLuaVM()
+			if err := lua.DoString(vm, source); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("snapshot", func(b *testing.B) {
+		s, err := NewBytecodeSnapshot(SetupScript{Name: "setup", Source: source})
+		if err != nil {
+			b.Fatal(err)
+		}
+		for range b.N {
+			if err := s.Apply(NewLuaVM()); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,207 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync/atomic"
+	"time"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+// Tag of the VMs created by the factory of a canary rollout
+const CanaryTag = "canary"
+
+var ErrCanaryRunning = fmt.Errorf("canary rollout in progress")
+
+// Execution metrics of the VMs of one side of a canary rollout
+type ExecStats struct {
+	// number of executions by Do, Eval, CallGlobal and Run
+	Runs uint64
+	// executions which failed
+	Errors uint64
+	// total execution time
+	Duration time.Duration
+}
+
+// CanaryStats compares the canary VMs with the stable ones since the canary
+// rollout started
+type CanaryStats struct {
+	Active bool
+	Canary ExecStats
+	Stable ExecStats
+}
+
+// a canary rollout started by CanaryUpdate
+type canary struct {
+	factory func() *lua.State
+	// canary VMs still to be created
+	pending int
+	// created canary VMs waiting to be tagged
+	created map[*lua.State]struct{}
+}
+
+type execMetrics struct {
+	runs     atomic.Uint64
+	errors   atomic.Uint64
+	duration atomic.Int64
+}
+
+func (m *execMetrics) stats() ExecStats {
+	return ExecStats{
+		Runs:     m.runs.Load(),
+		Errors:   m.errors.Load(),
+		Duration: time.Duration(m.duration.Load()),
+	}
+}
+
+// Starts a canary rollout of a new factory, e.g. one loading a new script
+// bundle: the given share (0 < share <= 1) of the VMs is replaced by VMs of
+// factory tagged CanaryTag, the others keep using the current factory. Errors
+// and latency of both kinds of VMs are compared by CanaryStats. Complete the
+// rollout with PromoteCanary or revert it with AbortCanary. Waits for VMs to
+// be replaced until ctx is done. VMs replaced later, e.g. by Update or
+// invalid VMs, are replaced by stable ones. Not supported with WithFactory.
+func (p *Pool) CanaryUpdate(ctx context.Context, factory func() *lua.State, share float64) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if share <= 0 || share > 1 || factory == nil {
+		return fmt.Errorf("%w: canary share %v", ErrInvalidOption, share)
+	}
+	if len(p.flavors) > 0 {
+		return fmt.Errorf("%w: canary rollouts with several factories", ErrInvalidOption)
+	}
+	n := int(math.Ceil(share * float64(p.Cap())))
+	p.canaryMux.Lock()
+	if p.canary != nil {
+		p.canaryMux.Unlock()
+		return ErrCanaryRunning
+	}
+	p.canary = &canary{factory: factory, pending: n, created: make(map[*lua.State]struct{})}
+	p.canaryMetrics, p.stableMetrics = &execMetrics{}, &execMetrics{}
+	p.canaryActive.Store(true)
+	p.canaryMux.Unlock()
+
+	// the replacements of discarded VMs are created by the canary factory
+	vms := make([]*lua.State, 0, n)
+	for range n {
+		vm, err := p.core.AcquireWithContext(ctx)
+		if err != nil {
+			for _, vm := range vms {
+				p.core.Release(vm)
+			}
+			p.endCanary()
+			return err
+		}
+		vms = append(vms, vm)
+	}
+	for _, vm := range vms {
+		p.core.Discard(vm)
+	}
+	return nil
+}
+
+// Completes a canary rollout: the factory of the canary becomes the factory
+// of the pool and all other VMs are replaced by Update. The previous factory
+// is kept for Rollback.
+func (p *Pool) PromoteCanary() {
+	p.canaryMux.Lock()
+	c := p.canary
+	p.canaryMux.Unlock()
+	if c == nil {
+		return
+	}
+	p.setFactory(c.factory)
+	p.endCanary()
+	p.Update()
+}
+
+// Reverts a canary rollout by replacing all VMs with ones of the current
+// factory (see Update)
+func (p *Pool) AbortCanary() {
+	if p.endCanary() {
+		p.Update()
+	}
+}
+
+// Returns the metrics of the current or last canary rollout
+func (p *Pool) CanaryStats() CanaryStats {
+	p.canaryMux.Lock()
+	defer p.canaryMux.Unlock()
+	s := CanaryStats{Active: p.canary != nil}
+	if p.canaryMetrics != nil {
+		s.Canary = p.canaryMetrics.stats()
+		s.Stable = p.stableMetrics.stats()
+	}
+	return s
+}
+
+func (p *Pool) endCanary() bool {
+	p.canaryMux.Lock()
+	defer p.canaryMux.Unlock()
+	active := p.canary != nil
+	p.canary = nil
+	p.canaryActive.Store(false)
+	return active
+}
+
+// returns a VM of the canary factory if canary VMs are missing
+func (p *Pool) newCanaryVM() *lua.State {
+	if !p.canaryActive.Load() {
+		return nil
+	}
+	p.canaryMux.Lock()
+	c := p.canary
+	if c == nil || c.pending <= 0 {
+		p.canaryMux.Unlock()
+		return nil
+	}
+	c.pending--
+	p.canaryMux.Unlock()
+	vm := c.factory()
+	p.canaryMux.Lock()
+	c.created[vm] = struct{}{}
+	p.canaryMux.Unlock()
+	return vm
+}
+
+// tags of a new VM, see WithTagger
+func (p *Pool) tagVM(vm *lua.State) []string {
+	var tags []string
+	if p.tagger != nil {
+		tags = p.tagger(vm)
+	}
+	if !p.canaryActive.Load() {
+		return tags
+	}
+	p.canaryMux.Lock()
+	defer p.canaryMux.Unlock()
+	if p.canary != nil {
+		if _, ok := p.canary.created[vm]; ok {
+			delete(p.canary.created, vm)
+			tags = append(tags, CanaryTag)
+		}
+	}
+	return tags
+}
+
+// records an execution by do for CanaryStats
+func (p *Pool) recordExec(vm *lua.State, start time.Time, err error) {
+	if !p.canaryActive.Load() {
+		return
+	}
+	p.canaryMux.Lock()
+	canaryMetrics, stableMetrics := p.canaryMetrics, p.stableMetrics
+	p.canaryMux.Unlock()
+	m := stableMetrics
+	if p.core.HasTag(vm, CanaryTag) {
+		m = canaryMetrics
+	}
+	m.runs.Add(1)
+	if err != nil {
+		m.errors.Add(1)
+	}
+	m.duration.Add(int64(p.clock.Now().Sub(start)))
+}
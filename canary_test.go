@@ -0,0 +1,73 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+func TestCanaryUpdate(t *testing.T) {
+	lpool := NewPool(4, nil)
+	ctx := context.Background()
+	broken := func() *lua.State {
+		vm := NewLuaVM()
+		lua.DoString(vm, "broken = true")
+		return vm
+	}
+	if err := lpool.CanaryUpdate(ctx, broken, 0.5); err != nil {
+		t.Fatal(err)
+	}
+	if err := lpool.CanaryUpdate(ctx, broken, 0.5); !errors.Is(err, ErrCanaryRunning) {
+		t.Errorf("expected %v but got %v", ErrCanaryRunning, err)
+	}
+	for lpool.Len() != 4 {
+		time.Sleep(time.Millisecond)
+	}
+	if n := countCanaries(t, lpool); n != 2 {
+		t.Fatalf("expected 2 canary VMs but got %d", n)
+	}
+	for range 8 {
+		lpool.Eval(ctx, "assert(not broken)")
+	}
+	s := lpool.CanaryStats()
+	if !s.Active || s.Canary.Runs == 0 || s.Canary.Errors != s.Canary.Runs || s.Stable.Runs == 0 || s.Stable.Errors != 0 {
+		t.Errorf("unexpected canary stats %+v", s)
+	}
+
+	lpool.AbortCanary()
+	if n := countCanaries(t, lpool); n != 0 || lpool.CanaryStats().Active {
+		t.Errorf("expected the canary to be reverted")
+	}
+
+	if err := lpool.CanaryUpdate(ctx, broken, 0.25); err != nil {
+		t.Fatal(err)
+	}
+	lpool.PromoteCanary()
+	for range 4 {
+		if _, err := lpool.Eval(ctx, "assert(not broken)"); err == nil {
+			t.Errorf("expected the promoted factory")
+		}
+	}
+	if err := lpool.CanaryUpdate(ctx, broken, 1.5); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("expected %v but got %v", ErrInvalidOption, err)
+	}
+}
+
+func countCanaries(t *testing.T, lpool *Pool) int {
+	t.Helper()
+	n := 0
+	err := lpool.ForEachIdle(context.Background(), func(vm *lua.State) error {
+		if slices.Contains(lpool.Tags(vm), CanaryTag) {
+			n++
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
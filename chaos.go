@@ -0,0 +1,67 @@
+package pool
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+var ErrInjectedFault = fmt.Errorf("injected fault")
+
+// Fault rates of WithChaos, between 0 (never) and 1 (always)
+type ChaosOptions struct {
+	// acquires failing with ErrInjectedFault as if the VM couldn't be
+	// created, the VM is discarded and replaced in the background. Acquire
+	// can't fail and is never affected.
+	FactoryFailureRate float64
+	// VM creations delayed by SlowCreationDelay
+	SlowCreationRate  float64
+	SlowCreationDelay time.Duration
+	// released VMs treated as broken, they are dropped and replaced
+	ValidationFailureRate float64
+}
+
+// Makes the pool misbehave at random at the given rates, to test the error
+// handling of an application against a failing pool. Not meant for production.
+func WithChaos(opts ChaosOptions) Option {
+	return func(p *Pool) {
+		if opts.SlowCreationDelay == 0 {
+			opts.SlowCreationDelay = 100 * time.Millisecond
+		}
+		p.chaos = &opts
+	}
+}
+
+func (c *ChaosOptions) validate() error {
+	for _, rate := range []float64{c.FactoryFailureRate, c.SlowCreationRate, c.ValidationFailureRate} {
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("%w: chaos rate %v", ErrInvalidOption, rate)
+		}
+	}
+	return nil
+}
+
+func chance(rate float64) bool {
+	return rate > 0 && rand.Float64() < rate
+}
+
+// fails an acquire as if vm couldn't be created
+func (p *Pool) injectAcquireFault(vm *lua.State) error {
+	if p.chaos == nil || !chance(p.chaos.FactoryFailureRate) {
+		return nil
+	}
+	p.core.Discard(vm)
+	return fmt.Errorf("%w: factory failure", ErrInjectedFault)
+}
+
+func (p *Pool) injectSlowCreation() {
+	if p.chaos != nil && chance(p.chaos.SlowCreationRate) {
+		<-p.clock.NewTimer(p.chaos.SlowCreationDelay).C()
+	}
+}
+
+func (p *Pool) injectValidationFault(*lua.State) bool {
+	return !chance(p.chaos.ValidationFailureRate)
+}
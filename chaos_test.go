@@ -0,0 +1,38 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestChaos(t *testing.T) {
+	if _, err := New(1, nil, WithChaos(ChaosOptions{FactoryFailureRate: 2})); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("expected %v but got %v", ErrInvalidOption, err)
+	}
+
+	start := time.Now()
+	lpool := NewPool(1, nil, WithChaos(ChaosOptions{
+		SlowCreationRate:      1,
+		SlowCreationDelay:     10 * time.Millisecond,
+		ValidationFailureRate: 1,
+	}))
+	if d := time.Since(start); d < 10*time.Millisecond {
+		t.Errorf("expected a slow creation but took %v", d)
+	}
+	vm := lpool.Acquire()
+	lpool.Release(vm)
+	if lpool.Acquire() == vm {
+		t.Errorf("expected the released VM to be replaced")
+	}
+
+	lpool = NewPool(1, nil, WithChaos(ChaosOptions{FactoryFailureRate: 1}))
+	if _, err := lpool.AcquireWithContext(context.Background()); !errors.Is(err, ErrInjectedFault) {
+		t.Errorf("expected %v but got %v", ErrInjectedFault, err)
+	}
+	// the discarded VM is replaced in the background
+	if vm := lpool.Acquire(); vm == nil {
+		t.Errorf("expected a VM")
+	}
+}
@@ -0,0 +1,56 @@
+package pool
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+var ErrChecksumMismatch = fmt.Errorf("script checksum mismatch")
+
+// Sets the expected hex encoded SHA-256 checksum of a script. Registering,
+// reloading or publishing the script fails with ErrChecksumMismatch if the
+// content doesn't match, the current version stays in place. The expectation
+// can be set before the script is registered and doesn't affect the version
+// already loaded, so a reviewed update can be announced before it is
+// published. An empty checksum removes the expectation.
+func (r *ScriptRegistry) ExpectChecksum(name string, sum string) error {
+	sum = strings.ToLower(sum)
+	if sum != "" {
+		if b, err := hex.DecodeString(sum); err != nil || len(b) != sha256.Size {
+			return fmt.Errorf("invalid SHA-256 checksum %q", sum)
+		}
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if sum == "" {
+		delete(r.checksums, name)
+	} else {
+		r.checksums[name] = sum
+	}
+	return nil
+}
+
+// Returns the hex encoded SHA-256 checksum of the current version of a script
+func (r *ScriptRegistry) Checksum(name string) (string, error) {
+	s, err := r.get(name)
+	if err != nil {
+		return "", err
+	}
+	return s.checksum, nil
+}
+
+// checks the checksum of new content against the expected one, r.mux must be held
+func (r *ScriptRegistry) verify(name string, sum string) error {
+	expected, ok := r.checksums[name]
+	if ok && expected != sum {
+		return fmt.Errorf("%w: %s: expected %s but got %s", ErrChecksumMismatch, name, expected, sum)
+	}
+	return nil
+}
+
+func checksum(source string) string {
+	sum := sha256.Sum256([]byte(source))
+	return hex.EncodeToString(sum[:])
+}
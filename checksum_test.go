@@ -0,0 +1,56 @@
+package pool
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func sha(source string) string {
+	sum := sha256.Sum256([]byte(source))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestExpectChecksum(t *testing.T) {
+	scripts := NewScriptRegistry()
+	if err := scripts.ExpectChecksum("answer", "abc"); err == nil {
+		t.Errorf("expected invalid checksum error")
+	}
+
+	v1, v2 := "return 1", "return 2"
+	if err := scripts.ExpectChecksum("answer", sha(v1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := scripts.Register("answer", v2); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("expected checksum mismatch but got %v", err)
+	}
+	if err := scripts.Register("answer", v1); err != nil {
+		t.Fatal(err)
+	}
+	if sum, _ := scripts.Checksum("answer"); sum != sha(v1) {
+		t.Errorf("expected checksum %s but got %s", sha(v1), sum)
+	}
+
+	// unreviewed updates are refused and the current version keeps running
+	if _, err := scripts.Publish("answer", v2); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("expected checksum mismatch but got %v", err)
+	}
+	lpool := NewPool(1, nil, WithScriptRegistry(scripts))
+	if results, err := lpool.Run(context.Background(), "answer"); err != nil || !reflect.DeepEqual(results, []any{1.0}) {
+		t.Errorf("expected version 1 but got %v, %v", results, err)
+	}
+
+	if err := scripts.ExpectChecksum("answer", sha(v2)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := scripts.Publish("answer", v2); err != nil {
+		t.Fatal(err)
+	}
+	stats := scripts.Stats()
+	if len(stats) != 1 || stats[0].Checksum != sha(v2) {
+		t.Errorf("expected checksum %s in stats but got %+v", sha(v2), stats)
+	}
+}
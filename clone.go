@@ -0,0 +1,353 @@
+package pool
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+var ErrNotClonable = fmt.Errorf("value can't be cloned")
+
+// Builds VMs by cloning the globals of a prototype VM into a VM created by
+// NewLuaVM instead of calling the factory for every VM. The prototype is
+// created by the factory once and again after Update and RollingUpdate.
+// Cloning walks all globals including the standard libraries, so it only makes
+// replacement VMs cheaper if the factory runs expensive setup code, e.g.
+// building large tables (compare with BenchmarkCloneGlobals).
+// Only globals are cloned (see CloneGlobals), state the factory keeps
+// elsewhere, e.g. in the registry, is lost. If the prototype can't be cloned,
+// e.g. because the factory registered Go functions, the factory is used
+// instead and a warning is logged.
+func WithCloning(enabled bool) Option {
+	return func(p *Pool) {
+		p.cloning = enabled
+	}
+}
+
+// returns a VM as created by the factory, cloned from the prototype if cloning
+// is enabled, or by the factory of a canary rollout
+func (p *Pool) newVM() *lua.State {
+	if vm := p.newCanaryVM(); vm != nil {
+		return vm
+	}
+	if !p.cloning {
+		return p.factoryVM()
+	}
+	p.protoMux.Lock()
+	defer p.protoMux.Unlock()
+	if p.prototype == nil && !p.cloneFailed {
+		p.prototype = p.factoryVM()
+	}
+	if p.cloneFailed {
+		return p.factoryVM()
+	}
+	vm := NewLuaVM()
+	if err := CloneGlobals(p.prototype, vm); err != nil {
+		p.logger.Warn("lua pool: can't clone prototype, using the factory", slog.Any("error", err))
+		p.cloneFailed = true
+		p.prototype = nil
+		return p.factoryVM()
+	}
+	return vm
+}
+
+func (p *Pool) factoryVM() *lua.State {
+	p.creatorMux.Lock()
+	creator := p.creator
+	p.creatorMux.Unlock()
+	if creator != nil {
+		return creator()
+	}
+	return NewLuaVM()
+}
+
+// makes the next VM build a new prototype
+func (p *Pool) resetPrototype() {
+	if !p.cloning {
+		return
+	}
+	p.protoMux.Lock()
+	p.prototype = nil
+	p.cloneFailed = false
+	p.protoMux.Unlock()
+}
+
+// Copies the globals of src to dst, typically a fresh VM with the standard
+// libraries opened. Tables and Lua functions are copied deeply, functions are
+// transferred as bytecode with their upvalues, keeping upvalues shared between
+// functions shared. Tables, Go functions and userdata found under the same
+// keys in both VMs, like the standard libraries, are treated as the same:
+// their Lua fields are copied into dst and fields missing in src are removed
+// from dst. Fails with ErrNotClonable for other Go functions, userdata and
+// threads, leaving dst partially updated.
+func CloneGlobals(src, dst *lua.State) error {
+	srcTop, dstTop := src.Top(), dst.Top()
+	defer src.SetTop(srcTop)
+	defer dst.SetTop(dstTop)
+
+	c := &cloner{
+		src:      src,
+		dst:      dst,
+		seen:     make(map[any]int),
+		shared:   make(map[any]bool),
+		upValues: make(map[any]upValueRef),
+	}
+	dst.NewTable()
+	c.cache = dst.Top()
+	src.RawGetInt(lua.RegistryIndex, lua.RegistryIndexGlobals)
+	dst.RawGetInt(lua.RegistryIndex, lua.RegistryIndexGlobals)
+	c.remember(src.ToValue(-1), dst.Top())
+	c.shared[src.ToValue(-1)] = true
+	c.share(src.Top(), dst.Top())
+	return c.merge(src.Top(), dst.Top(), make(map[any]bool))
+}
+
+type cloner struct {
+	src, dst *lua.State
+	// table on the dst stack holding the copied values by slot
+	cache int
+	slots int
+	// slots of the copies of src tables and functions
+	seen map[any]int
+	// src tables found in both VMs
+	shared map[any]bool
+	// upvalues already copied by their id in src
+	upValues map[any]upValueRef
+}
+
+// a copied upvalue, the n-th of the function in the cache slot
+type upValueRef struct {
+	slot, n int
+}
+
+// stores the dst value at index as copy of the src value v
+func (c *cloner) remember(v any, index int) int {
+	c.slots++
+	c.dst.PushValue(index)
+	c.dst.RawSetInt(c.cache, c.slots)
+	c.seen[v] = c.slots
+	return c.slots
+}
+
+// maps the tables and Go functions found under the same keys in the tables at
+// the absolute indices to each other
+func (c *cloner) share(srcT, dstT int) {
+	c.src.CheckStack(4)
+	c.dst.CheckStack(4)
+	c.src.PushNil()
+	for c.src.Next(srcT) {
+		if (c.src.IsTable(-1) || c.src.IsGoFunction(-1)) && c.pushKey(c.src.AbsIndex(-2)) {
+			c.dst.RawGet(dstT)
+			v := c.src.ToValue(-1)
+			if _, ok := c.seen[v]; !ok {
+				switch {
+				case c.src.IsGoFunction(-1) && c.dst.IsGoFunction(-1):
+					c.remember(v, c.dst.Top())
+				case c.src.IsTable(-1) && c.dst.IsTable(-1):
+					c.remember(v, c.dst.Top())
+					c.shared[v] = true
+					c.share(c.src.Top(), c.dst.Top())
+				}
+			}
+			c.dst.Pop(1)
+		}
+		c.src.Pop(1)
+	}
+}
+
+// pushes string and number keys onto the dst stack
+func (c *cloner) pushKey(index int) bool {
+	switch c.src.TypeOf(index) {
+	case lua.TypeString, lua.TypeNumber:
+		c.copy(index)
+		return true
+	}
+	return false
+}
+
+// copies the fields of the shared src table into the dst table and removes
+// the fields missing in src
+func (c *cloner) merge(srcT, dstT int, merged map[any]bool) error {
+	merged[c.src.ToValue(srcT)] = true
+	c.src.CheckStack(4)
+	c.dst.CheckStack(4)
+	c.src.PushNil()
+	for c.src.Next(srcT) {
+		switch {
+		case c.src.IsTable(-1) && c.shared[c.src.ToValue(-1)]:
+			if v := c.src.ToValue(-1); !merged[v] {
+				c.push(v)
+				if err := c.merge(c.src.Top(), c.dst.Top(), merged); err != nil {
+					return err
+				}
+				c.dst.Pop(1)
+			}
+		case c.src.IsGoFunction(-1):
+			// the same function in both VMs or not clonable
+			if _, ok := c.seen[c.src.ToValue(-1)]; !ok {
+				return fmt.Errorf("%w: Go function", ErrNotClonable)
+			}
+		case c.src.IsUserData(-1):
+			// userdata can't be compared, kept if dst has one under the key
+			if !c.pushKey(c.src.AbsIndex(-2)) {
+				return fmt.Errorf("%w: userdata", ErrNotClonable)
+			}
+			c.dst.RawGet(dstT)
+			isUserData := c.dst.IsUserData(-1)
+			c.dst.Pop(1)
+			if !isUserData {
+				return fmt.Errorf("%w: userdata", ErrNotClonable)
+			}
+		default:
+			if err := c.copy(c.src.AbsIndex(-2)); err != nil {
+				return err
+			}
+			if err := c.copy(c.src.Top()); err != nil {
+				return err
+			}
+			c.dst.RawSet(dstT)
+		}
+		c.src.Pop(1)
+	}
+
+	// fields the factory removed, e.g. unsafe functions
+	var removed []any
+	c.dst.PushNil()
+	for c.dst.Next(dstT) {
+		c.dst.Pop(1)
+		var key any
+		switch c.dst.TypeOf(-1) {
+		case lua.TypeString:
+			s, _ := c.dst.ToString(-1)
+			c.src.PushString(s)
+			key = s
+		case lua.TypeNumber:
+			n, _ := c.dst.ToNumber(-1)
+			c.src.PushNumber(n)
+			key = n
+		default:
+			continue
+		}
+		c.src.RawGet(srcT)
+		if c.src.IsNil(-1) {
+			removed = append(removed, key)
+		}
+		c.src.Pop(1)
+	}
+	for _, key := range removed {
+		switch key := key.(type) {
+		case string:
+			c.dst.PushString(key)
+		case float64:
+			c.dst.PushNumber(key)
+		}
+		c.dst.PushNil()
+		c.dst.RawSet(dstT)
+	}
+	return nil
+}
+
+// pushes a copy of the src value at the absolute index onto the dst stack
+func (c *cloner) copy(index int) error {
+	c.src.CheckStack(4)
+	c.dst.CheckStack(4)
+	switch c.src.TypeOf(index) {
+	case lua.TypeNil:
+		c.dst.PushNil()
+	case lua.TypeBoolean:
+		c.dst.PushBoolean(c.src.ToBoolean(index))
+	case lua.TypeNumber:
+		n, _ := c.src.ToNumber(index)
+		c.dst.PushNumber(n)
+	case lua.TypeString:
+		s, _ := c.src.ToString(index)
+		c.dst.PushString(s)
+	case lua.TypeTable:
+		if c.push(c.src.ToValue(index)) {
+			return nil
+		}
+		return c.copyTable(index)
+	case lua.TypeFunction:
+		if c.push(c.src.ToValue(index)) {
+			return nil
+		}
+		if c.src.IsGoFunction(index) {
+			return fmt.Errorf("%w: Go function", ErrNotClonable)
+		}
+		return c.copyFunction(index)
+	default:
+		return fmt.Errorf("%w: %s", ErrNotClonable, c.src.TypeOf(index))
+	}
+	return nil
+}
+
+// pushes the copy of v if it was copied before
+func (c *cloner) push(v any) bool {
+	slot, ok := c.seen[v]
+	if ok {
+		c.dst.RawGetInt(c.cache, slot)
+	}
+	return ok
+}
+
+func (c *cloner) copyTable(index int) error {
+	c.dst.NewTable()
+	t := c.dst.Top()
+	c.remember(c.src.ToValue(index), t)
+	c.src.PushNil()
+	for c.src.Next(index) {
+		if err := c.copy(c.src.AbsIndex(-2)); err != nil {
+			return err
+		}
+		if err := c.copy(c.src.Top()); err != nil {
+			return err
+		}
+		c.dst.RawSet(t)
+		c.src.Pop(1)
+	}
+	if c.src.MetaTable(index) {
+		if err := c.copy(c.src.Top()); err != nil {
+			return err
+		}
+		c.src.Pop(1)
+		c.dst.SetMetaTable(t)
+	}
+	return nil
+}
+
+func (c *cloner) copyFunction(index int) error {
+	var buf bytes.Buffer
+	c.src.PushValue(index)
+	err := c.src.Dump(&buf)
+	c.src.Pop(1)
+	if err != nil {
+		return err
+	}
+	if err := c.dst.Load(&buf, "=clone", "b"); err != nil {
+		return err
+	}
+	f := c.dst.Top()
+	slot := c.remember(c.src.ToValue(index), f)
+	for n := 1; ; n++ {
+		if _, ok := lua.UpValue(c.src, index, n); !ok {
+			break
+		}
+		id := lua.UpValueId(c.src, index, n)
+		if ref, ok := c.upValues[id]; ok {
+			// shared with a function copied before
+			c.dst.RawGetInt(c.cache, ref.slot)
+			lua.UpValueJoin(c.dst, f, n, -1, ref.n)
+			c.dst.Pop(1)
+		} else {
+			if err := c.copy(c.src.Top()); err != nil {
+				return err
+			}
+			lua.SetUpValue(c.dst, f, n)
+			c.upValues[id] = upValueRef{slot: slot, n: n}
+		}
+		c.src.Pop(1)
+	}
+	return nil
+}
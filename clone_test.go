@@ -0,0 +1,98 @@
+package pool
+
+import (
+	"errors"
+	"testing"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+const prototypeScript = `
+io = nil
+os.exit = nil
+local format = string.format
+local count = 0
+function inc() count = count + 1; return count end
+function get() return count end
+function string.shout(s) return s:upper() .. "!" end
+config = {name = "proto", nested = {}}
+config.nested.parent = config
+function describe() return format("%s %d", config.name, get()) end
+`
+
+func TestCloneGlobals(t *testing.T) {
+	proto := NewLuaVM()
+	if err := lua.DoString(proto, prototypeScript); err != nil {
+		t.Fatal(err)
+	}
+	proto.Global("inc")
+	proto.Call(0, 0)
+
+	vm := NewLuaVM()
+	if err := CloneGlobals(proto, vm); err != nil {
+		t.Fatal(err)
+	}
+	err := lua.DoString(vm, `
+		assert(io == nil and os.exit == nil and os.time ~= nil)
+		assert(inc() == 2 and get() == 2, "upvalues must be copied and stay shared")
+		assert(("hi"):shout() == "HI!")
+		assert(config.nested.parent == config)
+		assert(describe() == "proto 2")
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the prototype is unaffected
+	proto.Global("get")
+	proto.Call(0, 1)
+	if n, _ := proto.ToInteger(-1); n != 1 {
+		t.Errorf("expected prototype counter 1 but got %d", n)
+	}
+
+	proto.Register("native", func(l *lua.State) int { return 0 })
+	if err := CloneGlobals(proto, NewLuaVM()); !errors.Is(err, ErrNotClonable) {
+		t.Errorf("expected %v but got %v", ErrNotClonable, err)
+	}
+}
+
+func TestCloning(t *testing.T) {
+	calls := 0
+	factory := func() *lua.State {
+		calls++
+		vm := NewLuaVM()
+		lua.DoString(vm, "setup = 'done'")
+		return vm
+	}
+	lpool := NewPool(3, factory, WithCloning(true))
+	if calls != 1 {
+		t.Errorf("expected the factory to be called once but got %d", calls)
+	}
+	for range 3 {
+		vm := lpool.Acquire()
+		defer lpool.Release(vm)
+		if err := lua.DoString(vm, "assert(setup == 'done')"); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func BenchmarkCloneGlobals(b *testing.B) {
+	factory := func() *lua.State {
+		vm := NewLuaVM()
+		lua.DoString(vm, prototypeScript)
+		return vm
+	}
+	b.Run("factory", func(b *testing.B) {
+		for range b.N {
+			factory()
+		}
+	})
+	b.Run("clone", func(b *testing.B) {
+		proto := factory()
+		for range b.N {
+			if err := CloneGlobals(proto, NewLuaVM()); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,459 @@
+package pool
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+// maximum nesting of tables converted between Go and Lua
+const maxConvertDepth = 100
+
+var (
+	ErrUnsupportedType = fmt.Errorf("unsupported type")
+	ErrTypeMismatch    = fmt.Errorf("type mismatch")
+	ErrLimitExceeded   = fmt.Errorf("conversion limit exceeded")
+)
+
+var errStackOverflow = fmt.Errorf("lua stack overflow")
+
+// ConvertLimits restrict the conversion of Lua values to Go values to defend
+// against hostile scripts returning huge or deeply nested tables.
+// Zero values fall back to the defaults of DefaultConvertLimits.
+type ConvertLimits struct {
+	// maximum nesting of tables
+	MaxDepth int
+	// maximum number of table entries in total
+	MaxItems int
+	// maximum length of a single string
+	MaxStringLen int
+}
+
+var DefaultConvertLimits = ConvertLimits{
+	MaxDepth:     maxConvertDepth,
+	MaxItems:     1 << 20,
+	MaxStringLen: 64 << 20,
+}
+
+// Converts the Lua value at the given stack index to a Go value using
+// DefaultConvertLimits, see ConvertLimits.ToValue.
+func ToValue(vm *lua.State, index int) (any, error) {
+	return DefaultConvertLimits.ToValue(vm, index)
+}
+
+// Converts the Lua value at the given stack index into the value pointed to by
+// v using DefaultConvertLimits, see ConvertLimits.Unmarshal.
+func Unmarshal(vm *lua.State, index int, v any) error {
+	return DefaultConvertLimits.Unmarshal(vm, index, v)
+}
+
+// Converts the Lua value at the given stack index to a Go value.
+// Numbers are returned as float64, sequences as []any and other tables as
+// map[string]any. Functions, userdata and threads are not supported.
+func (l ConvertLimits) ToValue(vm *lua.State, index int) (any, error) {
+	d := newDecoder(vm, l)
+	return d.value(vm.AbsIndex(index), 0)
+}
+
+// Converts the Lua value at the given stack index into the value pointed to by
+// v, which is the reverse of PushValue: tables are converted into structs (using
+// the same `lua` tags), maps, slices and arrays. Struct fields are matched by
+// name, falling back to a case-insensitive match. Table entries without a
+// matching field are ignored, nil leaves the target untouched.
+func (l ConvertLimits) Unmarshal(vm *lua.State, index int, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("%w: unmarshal target must be a non-nil pointer, got %T", ErrUnsupportedType, v)
+	}
+	d := newDecoder(vm, l)
+	return d.decode(vm.AbsIndex(index), rv.Elem(), 0)
+}
+
+type decoder struct {
+	vm     *lua.State
+	limits ConvertLimits
+	items  int
+}
+
+func newDecoder(vm *lua.State, limits ConvertLimits) *decoder {
+	if limits.MaxDepth <= 0 {
+		limits.MaxDepth = DefaultConvertLimits.MaxDepth
+	}
+	if limits.MaxItems <= 0 {
+		limits.MaxItems = DefaultConvertLimits.MaxItems
+	}
+	if limits.MaxStringLen <= 0 {
+		limits.MaxStringLen = DefaultConvertLimits.MaxStringLen
+	}
+	return &decoder{vm: vm, limits: limits}
+}
+
+func (d *decoder) enterTable(depth int) error {
+	if depth >= d.limits.MaxDepth {
+		return fmt.Errorf("%w: table nesting exceeds %d levels", ErrLimitExceeded, d.limits.MaxDepth)
+	}
+	if !d.vm.CheckStack(3) {
+		return errStackOverflow
+	}
+	return nil
+}
+
+func (d *decoder) countItem() error {
+	if d.items++; d.items > d.limits.MaxItems {
+		return fmt.Errorf("%w: more than %d table entries", ErrLimitExceeded, d.limits.MaxItems)
+	}
+	return nil
+}
+
+func (d *decoder) string(index int) (string, error) {
+	s, _ := d.vm.ToString(index)
+	if len(s) > d.limits.MaxStringLen {
+		return "", fmt.Errorf("%w: string longer than %d bytes", ErrLimitExceeded, d.limits.MaxStringLen)
+	}
+	return s, nil
+}
+
+func (d *decoder) value(index int, depth int) (any, error) {
+	vm := d.vm
+	switch t := vm.TypeOf(index); t {
+	case lua.TypeNil, lua.TypeNone:
+		return nil, nil
+	case lua.TypeBoolean:
+		return vm.ToBoolean(index), nil
+	case lua.TypeNumber:
+		n, _ := vm.ToNumber(index)
+		return n, nil
+	case lua.TypeString:
+		return d.string(index)
+	case lua.TypeTable:
+		if err := d.enterTable(depth); err != nil {
+			return nil, err
+		}
+		return d.table(index, depth+1)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedType, t)
+	}
+}
+
+func (d *decoder) table(index int, depth int) (any, error) {
+	vm := d.vm
+	if n := vm.RawLength(index); n > 0 && isSequence(vm, index, n) {
+		values := make([]any, 0, min(n, d.limits.MaxItems))
+		for i := 1; i <= n; i++ {
+			if err := d.countItem(); err != nil {
+				return nil, err
+			}
+			vm.RawGetInt(index, i)
+			v, err := d.value(vm.Top(), depth)
+			vm.Pop(1)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+			values = append(values, v)
+		}
+		return values, nil
+	}
+	values := make(map[string]any)
+	vm.PushNil()
+	for vm.Next(index) {
+		if err := d.countItem(); err != nil {
+			vm.Pop(2)
+			return nil, err
+		}
+		key, err := tableKey(vm, -2)
+		if err != nil {
+			vm.Pop(2)
+			return nil, err
+		}
+		v, err := d.value(vm.Top(), depth)
+		vm.Pop(1)
+		if err != nil {
+			vm.Pop(1)
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		values[key] = v
+	}
+	return values, nil
+}
+
+func (d *decoder) decode(index int, rv reflect.Value, depth int) error {
+	vm := d.vm
+	t := vm.TypeOf(index)
+	if t == lua.TypeNil || t == lua.TypeNone {
+		return nil
+	}
+	switch rv.Kind() {
+	case reflect.Interface:
+		if rv.NumMethod() != 0 {
+			return fmt.Errorf("%w: %s", ErrUnsupportedType, rv.Type())
+		}
+		v, err := d.value(index, depth)
+		if err != nil {
+			return err
+		}
+		if v != nil {
+			rv.Set(reflect.ValueOf(v))
+		}
+		return nil
+	case reflect.Pointer:
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		return d.decode(index, rv.Elem(), depth)
+	case reflect.Bool:
+		if t != lua.TypeBoolean {
+			return mismatch(t, rv)
+		}
+		rv.SetBool(vm.ToBoolean(index))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := d.integer(index, t, rv)
+		if err != nil {
+			return err
+		}
+		if n < math.MinInt64 || n >= math.MaxInt64 || rv.OverflowInt(int64(n)) {
+			return fmt.Errorf("%w: %v overflows %s", ErrTypeMismatch, n, rv.Type())
+		}
+		rv.SetInt(int64(n))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := d.integer(index, t, rv)
+		if err != nil {
+			return err
+		}
+		if n < 0 || n >= math.MaxUint64 || rv.OverflowUint(uint64(n)) {
+			return fmt.Errorf("%w: %v overflows %s", ErrTypeMismatch, n, rv.Type())
+		}
+		rv.SetUint(uint64(n))
+	case reflect.Float32, reflect.Float64:
+		if t != lua.TypeNumber {
+			return mismatch(t, rv)
+		}
+		n, _ := vm.ToNumber(index)
+		rv.SetFloat(n)
+	case reflect.String:
+		if t != lua.TypeString {
+			return mismatch(t, rv)
+		}
+		s, err := d.string(index)
+		if err != nil {
+			return err
+		}
+		rv.SetString(s)
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 && t == lua.TypeString {
+			s, err := d.string(index)
+			if err != nil {
+				return err
+			}
+			rv.SetBytes([]byte(s))
+			return nil
+		}
+		if t != lua.TypeTable {
+			return mismatch(t, rv)
+		}
+		if err := d.enterTable(depth); err != nil {
+			return err
+		}
+		return d.decodeSequence(index, rv, depth+1)
+	case reflect.Array:
+		if t != lua.TypeTable {
+			return mismatch(t, rv)
+		}
+		if err := d.enterTable(depth); err != nil {
+			return err
+		}
+		return d.decodeSequence(index, rv, depth+1)
+	case reflect.Map:
+		if t != lua.TypeTable {
+			return mismatch(t, rv)
+		}
+		if err := d.enterTable(depth); err != nil {
+			return err
+		}
+		return d.decodeMap(index, rv, depth+1)
+	case reflect.Struct:
+		if t != lua.TypeTable {
+			return mismatch(t, rv)
+		}
+		if err := d.enterTable(depth); err != nil {
+			return err
+		}
+		return d.decodeStruct(index, rv, depth+1)
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedType, rv.Type())
+	}
+	return nil
+}
+
+func (d *decoder) integer(index int, t lua.Type, rv reflect.Value) (float64, error) {
+	if t != lua.TypeNumber {
+		return 0, mismatch(t, rv)
+	}
+	n, _ := d.vm.ToNumber(index)
+	if n != math.Trunc(n) {
+		return 0, fmt.Errorf("%w: %v is not an integer", ErrTypeMismatch, n)
+	}
+	return n, nil
+}
+
+func (d *decoder) decodeSequence(index int, rv reflect.Value, depth int) error {
+	vm := d.vm
+	n := vm.RawLength(index)
+	if rv.Kind() == reflect.Array {
+		n = min(n, rv.Len())
+	} else {
+		if n > d.limits.MaxItems-d.items {
+			return fmt.Errorf("%w: more than %d table entries", ErrLimitExceeded, d.limits.MaxItems)
+		}
+		rv.Set(reflect.MakeSlice(rv.Type(), n, n))
+	}
+	for i := 1; i <= n; i++ {
+		if err := d.countItem(); err != nil {
+			return err
+		}
+		vm.RawGetInt(index, i)
+		err := d.decode(vm.Top(), rv.Index(i-1), depth)
+		vm.Pop(1)
+		if err != nil {
+			return fmt.Errorf("[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (d *decoder) decodeMap(index int, rv reflect.Value, depth int) error {
+	vm := d.vm
+	if rv.IsNil() {
+		rv.Set(reflect.MakeMap(rv.Type()))
+	}
+	keyType, elemType := rv.Type().Key(), rv.Type().Elem()
+	vm.PushNil()
+	for vm.Next(index) {
+		if err := d.countItem(); err != nil {
+			vm.Pop(2)
+			return err
+		}
+		// decode a copy of the key, string conversions would break vm.Next
+		vm.PushValue(-2)
+		key := reflect.New(keyType).Elem()
+		err := d.decode(vm.Top(), key, depth)
+		vm.Pop(1)
+		if err != nil {
+			vm.Pop(2)
+			return fmt.Errorf("map key: %w", err)
+		}
+		elem := reflect.New(elemType).Elem()
+		err = d.decode(vm.Top(), elem, depth)
+		vm.Pop(1)
+		if err != nil {
+			vm.Pop(1)
+			return fmt.Errorf("%v: %w", key, err)
+		}
+		rv.SetMapIndex(key, elem)
+	}
+	return nil
+}
+
+func (d *decoder) decodeStruct(index int, rv reflect.Value, depth int) error {
+	vm := d.vm
+	fields := structFields(rv.Type())
+	vm.PushNil()
+	for vm.Next(index) {
+		if err := d.countItem(); err != nil {
+			vm.Pop(2)
+			return err
+		}
+		if vm.TypeOf(-2) != lua.TypeString {
+			vm.Pop(1)
+			continue
+		}
+		name, _ := vm.ToString(-2)
+		f, ok := findField(fields, name)
+		if !ok {
+			vm.Pop(1)
+			continue
+		}
+		fv, err := fieldByIndexAlloc(rv, f.index)
+		if err == nil {
+			err = d.decode(vm.Top(), fv, depth)
+		}
+		vm.Pop(1)
+		if err != nil {
+			vm.Pop(1)
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func findField(fields []structField, name string) (structField, bool) {
+	for _, f := range fields {
+		if f.name == name {
+			return f, true
+		}
+	}
+	for _, f := range fields {
+		if strings.EqualFold(f.name, name) {
+			return f, true
+		}
+	}
+	return structField{}, false
+}
+
+// like reflect.Value.FieldByIndex but allocates nil embedded pointers
+func fieldByIndexAlloc(rv reflect.Value, index []int) (reflect.Value, error) {
+	for i, x := range index {
+		if i > 0 && rv.Kind() == reflect.Pointer {
+			if rv.IsNil() {
+				if !rv.CanSet() {
+					return reflect.Value{}, fmt.Errorf("%w: unexported embedded pointer %s", ErrUnsupportedType, rv.Type())
+				}
+				rv.Set(reflect.New(rv.Type().Elem()))
+			}
+			rv = rv.Elem()
+		}
+		rv = rv.Field(x)
+	}
+	return rv, nil
+}
+
+func mismatch(t lua.Type, rv reflect.Value) error {
+	return fmt.Errorf("%w: cannot convert %s to %s", ErrTypeMismatch, t, rv.Type())
+}
+
+// true if the table only contains the keys 1..n
+func isSequence(vm *lua.State, index int, n int) bool {
+	count := 0
+	vm.PushNil()
+	for vm.Next(index) {
+		vm.Pop(1)
+		count++
+		if count > n {
+			vm.Pop(1)
+			return false
+		}
+	}
+	return count == n
+}
+
+// converts a table key to a string without modifying the key on the stack,
+// which would break the table traversal
+func tableKey(vm *lua.State, index int) (string, error) {
+	switch t := vm.TypeOf(index); t {
+	case lua.TypeString:
+		s, _ := vm.ToString(index)
+		return s, nil
+	case lua.TypeNumber:
+		n, _ := vm.ToNumber(index)
+		if n == math.Trunc(n) {
+			return fmt.Sprintf("%d", int64(n)), nil
+		}
+		return fmt.Sprintf("%g", n), nil
+	case lua.TypeBoolean:
+		return fmt.Sprintf("%t", vm.ToBoolean(index)), nil
+	default:
+		return "", fmt.Errorf("%w: table key of type %s", ErrUnsupportedType, t)
+	}
+}
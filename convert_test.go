@@ -0,0 +1,110 @@
+package pool
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+func TestUnmarshalRoundTrip(t *testing.T) {
+	vm := NewLuaVM()
+	in := testConfig{
+		testBase: testBase{ID: 7, Created: "today"},
+		Name:     "api",
+		Port:     8080,
+		Ratio:    0.5,
+		Tags:     []string{"a", "b"},
+		Limits:   map[string]int{"rps": 100},
+		Backends: map[int]*testBase{1: {ID: 1}},
+		Enabled:  true,
+	}
+	if err := PushValue(vm, in); err != nil {
+		t.Fatal(err)
+	}
+	var out testConfig
+	if err := Unmarshal(vm, -1, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("expected %+v after round trip but got %+v", in, out)
+	}
+}
+
+func TestUnmarshalFromLua(t *testing.T) {
+	vm := NewLuaVM()
+	err := lua.DoString(vm, `return { name = "lua", PORT = 80, tags = {"x"}, unknown = true, nested = { list = {1, 2} } }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out struct {
+		Name   string `lua:"name"`
+		Port   int
+		Tags   [2]string `lua:"tags"`
+		Nested *struct {
+			List []float64 `lua:"list"`
+		} `lua:"nested"`
+		Any any
+	}
+	if err := Unmarshal(vm, -1, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Name != "lua" || out.Port != 80 || out.Tags[0] != "x" || out.Nested == nil || len(out.Nested.List) != 2 {
+		t.Errorf("unexpected result %+v", out)
+	}
+	if out.Any != nil {
+		t.Errorf("expected missing field to stay nil")
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	vm := NewLuaVM()
+	for code, target := range map[string]any{
+		`return "text"`: new(int),
+		`return 1.5`:    new(int),
+		`return 300`:    new(uint8),
+		`return -1`:     new(uint),
+		`return {1}`:    new(string),
+		`return {a={}}`: new(map[string]int),
+	} {
+		vm.SetTop(0)
+		if err := lua.DoString(vm, code); err != nil {
+			t.Fatal(err)
+		}
+		if err := Unmarshal(vm, -1, target); !errors.Is(err, ErrTypeMismatch) {
+			t.Errorf("%s into %T: expected %v but got %v", code, target, ErrTypeMismatch, err)
+		}
+	}
+	if err := Unmarshal(vm, -1, 1); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("expected %v for non pointer target but got %v", ErrUnsupportedType, err)
+	}
+}
+
+func TestConvertLimits(t *testing.T) {
+	vm := NewLuaVM()
+	err := lua.DoString(vm, `
+		local t = {}
+		for i = 1, 100 do t[i] = { s = string.rep("x", 10) } end
+		return t
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limits := []ConvertLimits{{MaxItems: 50}, {MaxDepth: 1}, {MaxStringLen: 5}}
+	for _, l := range limits {
+		if _, err := l.ToValue(vm, -1); !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("%+v: expected %v but got %v", l, ErrLimitExceeded, err)
+		}
+		var out []map[string]string
+		if err := l.Unmarshal(vm, -1, &out); !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("%+v: expected %v on unmarshal but got %v", l, ErrLimitExceeded, err)
+		}
+	}
+	if _, err := ToValue(vm, -1); err != nil {
+		t.Errorf("expected default limits to pass but got %v", err)
+	}
+	if vm.Top() != 1 {
+		t.Errorf("expected conversions to keep the stack intact but got %d values", vm.Top())
+	}
+}
@@ -0,0 +1,18 @@
+package pool
+
+import (
+	"syscall"
+	"time"
+)
+
+// getrusage(2) flag for the calling thread
+const rusageThread = 1
+
+// returns the CPU time consumed by the current thread
+func threadCPUTime() time.Duration {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(rusageThread, &ru); err != nil {
+		return 0
+	}
+	return time.Duration(ru.Utime.Nano() + ru.Stime.Nano())
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package pool
+
+import "time"
+
+var clockStart = time.Now()
+
+// thread CPU time is not available, falls back to wall-clock time
+func threadCPUTime() time.Duration {
+	return time.Since(clockStart)
+}
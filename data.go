@@ -0,0 +1,23 @@
+package pool
+
+import (
+	lua "github.com/epikur-io/go-lua"
+)
+
+// Attaches Go metadata to a VM of the pool under key, e.g. a cache, counters or
+// tenant info, instead of storing it in Lua globals. Keys are compared like
+// map keys. The data is dropped together with the VM, its replacement starts
+// without data. Returns false if vm isn't a VM of the pool.
+func (p *Pool) SetVMData(vm *lua.State, key, value any) bool {
+	return p.core.SetData(vm, key, value)
+}
+
+// Returns the metadata attached to a VM under key, see SetVMData
+func (p *Pool) GetVMData(vm *lua.State, key any) (any, bool) {
+	return p.core.Data(vm, key)
+}
+
+// Removes the metadata attached to a VM under key
+func (p *Pool) DeleteVMData(vm *lua.State, key any) {
+	p.core.DeleteData(vm, key)
+}
@@ -0,0 +1,27 @@
+package pool
+
+import (
+	"testing"
+)
+
+func TestVMData(t *testing.T) {
+	type counterKey struct{}
+	lpool := NewPool(1, nil)
+	vm := lpool.Acquire()
+	if !lpool.SetVMData(vm, counterKey{}, 1) {
+		t.Fatal("failed to attach data")
+	}
+	lpool.Release(vm)
+	vm = lpool.Acquire()
+	if v, ok := lpool.GetVMData(vm, counterKey{}); !ok || v != 1 {
+		t.Errorf("expected 1 but got %v", v)
+	}
+	lpool.DeleteVMData(vm, counterKey{})
+	if _, ok := lpool.GetVMData(vm, counterKey{}); ok {
+		t.Errorf("expected the data to be deleted")
+	}
+	lpool.Release(vm)
+	if lpool.SetVMData(NewLuaVM(), counterKey{}, 1) {
+		t.Errorf("expected foreign VMs to be rejected")
+	}
+}
@@ -0,0 +1,116 @@
+package pool
+
+import (
+	"log/slog"
+	"os"
+	"time"
+
+	lua "github.com/epikur-io/go-lua"
+	"github.com/epikur-io/go-lua-pool/generic"
+)
+
+// Logs every acquire/release/create/destroy including VM IDs and durations.
+// Intended for local troubleshooting, when disabled the hot paths only pay for a
+// boolean check. Without WithLogger the output is written to stderr.
+func WithDebug(enabled bool) Option {
+	return func(p *Pool) {
+		p.debug = enabled
+	}
+}
+
+// Sets the logger used by the pool, defaults to slog.Default()
+func WithLogger(logger *slog.Logger) Option {
+	return func(p *Pool) {
+		p.logger = logger
+	}
+}
+
+func (p *Pool) initLogger() {
+	if p.logger != nil {
+		return
+	}
+	if p.debug {
+		p.logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	} else {
+		p.logger = slog.Default()
+	}
+}
+
+// returns the current time in debug mode and the zero time otherwise
+func (p *Pool) debugNow() time.Time {
+	if !p.debug {
+		return time.Time{}
+	}
+	return p.clock.Now()
+}
+
+func (p *Pool) logCreate(vm *lua.State, info generic.Info, took time.Duration) {
+	p.logger.Debug("lua pool: vm created",
+		slog.Uint64("vm", info.ID),
+		slog.Duration("duration", took))
+}
+
+func (p *Pool) logDestroy(vm *lua.State, info generic.Info) {
+	if info.ID == 0 {
+		p.logger.Debug("lua pool: unknown vm destroyed")
+		return
+	}
+	p.logger.Debug("lua pool: vm destroyed",
+		slog.Uint64("vm", info.ID),
+		slog.Duration("age", p.since(info.Created)))
+}
+
+func (p *Pool) logAcquire(vm *lua.State, start time.Time) {
+	info, ok := p.core.Info(vm)
+	if !ok {
+		p.logger.Debug("lua pool: unknown vm acquired", slog.Duration("wait", p.since(start)))
+		return
+	}
+	p.acquiredMux.Lock()
+	p.acquired[vm] = p.clock.Now()
+	p.acquiredMux.Unlock()
+	p.logger.Debug("lua pool: vm acquired",
+		slog.Uint64("vm", info.ID),
+		slog.Duration("wait", p.since(start)))
+}
+
+func (p *Pool) logAcquireFailed(start time.Time, err error) {
+	p.logger.Debug("lua pool: acquire failed",
+		slog.Duration("wait", p.since(start)),
+		slog.String("error", err.Error()))
+}
+
+// info is passed separately as the VM may be gone from the bookkeeping already
+func (p *Pool) logRelease(vm *lua.State, info generic.Info) {
+	p.acquiredMux.Lock()
+	acquired, ok := p.acquired[vm]
+	delete(p.acquired, vm)
+	p.acquiredMux.Unlock()
+	if info.ID == 0 || !ok {
+		p.logger.Debug("lua pool: unknown vm released")
+		return
+	}
+	p.logger.Debug("lua pool: vm released",
+		slog.Uint64("vm", info.ID),
+		slog.Duration("held", p.since(acquired)))
+}
+
+// logs a VM the holder gave up without releasing it, e.g. as it was recycled
+func (p *Pool) logDrop(vm *lua.State, action string) {
+	p.acquiredMux.Lock()
+	acquired, ok := p.acquired[vm]
+	delete(p.acquired, vm)
+	p.acquiredMux.Unlock()
+	info, known := p.core.Info(vm)
+	if !known || !ok {
+		p.logger.Debug("lua pool: unknown vm " + action)
+		return
+	}
+	p.logger.Debug("lua pool: vm "+action,
+		slog.Uint64("vm", info.ID),
+		slog.Duration("held", p.since(acquired)))
+}
+
+func (p *Pool) since(t time.Time) time.Duration {
+	return p.clock.Now().Sub(t)
+}
@@ -0,0 +1,54 @@
+package pool
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestDebugLogging(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	lpool := NewPool(1, nil, WithDebug(true), WithLogger(logger))
+	lpool.Release(lpool.Acquire())
+	lpool.Update()
+
+	out := buf.String()
+	for _, msg := range []string{"vm created", "vm acquired", "vm released", "vm destroyed"} {
+		if !strings.Contains(out, msg) {
+			t.Errorf("expected log output to contain %q", msg)
+		}
+	}
+	if !strings.Contains(out, "vm=") {
+		t.Errorf("expected log output to contain vm ids")
+	}
+}
+
+func TestDebugLoggingDroppedVMs(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	lpool := NewPool(1, nil, WithDebug(true), WithLogger(logger), WithInstructionLimit(1000))
+	defer lpool.Close()
+	lpool.Eval(context.Background(), "while true do end")
+
+	if !strings.Contains(buf.String(), "vm recycled") {
+		t.Errorf("expected the recycled VM to be logged")
+	}
+	lpool.acquiredMux.Lock()
+	defer lpool.acquiredMux.Unlock()
+	if len(lpool.acquired) != 0 {
+		t.Errorf("expected the recycled VM to be forgotten but got %d VMs", len(lpool.acquired))
+	}
+}
+
+func TestDebugLoggingDisabled(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	lpool := NewPool(1, nil, WithLogger(logger))
+	lpool.Release(lpool.Acquire())
+	if buf.Len() != 0 {
+		t.Errorf("expected no log output but got %q", buf.String())
+	}
+}
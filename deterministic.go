@@ -0,0 +1,117 @@
+package pool
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+// registry key of the function reseeding math.random
+const reseedKey = "lua-pool.reseed"
+
+// Options of the deterministic execution mode, see WithDeterministic
+type DeterministicOptions struct {
+	// seed of math.random, reapplied every time a VM is released
+	Seed int64
+	// returns the time reported by os.time, defaults to the Unix epoch
+	Now func() time.Time
+	// returns the processor time reported by os.clock, defaults to zero
+	Clock func() time.Duration
+}
+
+// Makes executions reproducible: math.random of every VM uses its own
+// generator seeded with opts.Seed (again after every release) and os.time and
+// os.clock report the given clocks instead of the real ones.
+func WithDeterministic(opts DeterministicOptions) Option {
+	return func(p *Pool) {
+		if opts.Now == nil {
+			opts.Now = func() time.Time { return time.Unix(0, 0) }
+		}
+		if opts.Clock == nil {
+			opts.Clock = func() time.Duration { return 0 }
+		}
+		p.deterministic = &opts
+	}
+}
+
+// replaces the random and clock functions of the VM
+func makeDeterministic(vm *lua.State, opts *DeterministicOptions) {
+	top := vm.Top()
+	defer vm.SetTop(top)
+
+	rnd := rand.New(rand.NewSource(opts.Seed))
+	vm.PushGoFunction(func(l *lua.State) int {
+		rnd.Seed(opts.Seed)
+		return 0
+	})
+	vm.SetField(lua.RegistryIndex, reseedKey)
+
+	vm.Global("math")
+	if vm.IsTable(-1) {
+		vm.PushGoFunction(func(l *lua.State) int {
+			return random(l, rnd.Float64())
+		})
+		vm.SetField(-2, "random")
+		vm.PushGoFunction(func(l *lua.State) int {
+			rnd.Seed(int64(lua.CheckInteger(l, 1)))
+			return 0
+		})
+		vm.SetField(-2, "randomseed")
+	}
+	vm.Pop(1)
+
+	vm.Global("os")
+	if vm.IsTable(-1) {
+		// os.time with a date table doesn't depend on the clock
+		vm.Field(-1, "time")
+		vm.PushGoClosure(func(l *lua.State) int {
+			if l.IsNoneOrNil(1) {
+				l.PushNumber(float64(opts.Now().Unix()))
+				return 1
+			}
+			l.PushValue(lua.UpValueIndex(1))
+			l.Insert(1)
+			l.Call(l.Top()-1, 1)
+			return 1
+		}, 1)
+		vm.SetField(-2, "time")
+		vm.PushGoFunction(func(l *lua.State) int {
+			l.PushNumber(opts.Clock().Seconds())
+			return 1
+		})
+		vm.SetField(-2, "clock")
+	}
+	vm.Pop(1)
+}
+
+// implements math.random like the standard library does for the given value
+// in [0, 1)
+func random(l *lua.State, r float64) int {
+	switch l.Top() {
+	case 0:
+		l.PushNumber(r)
+	case 1:
+		u := lua.CheckNumber(l, 1)
+		lua.ArgumentCheck(l, 1.0 <= u, 1, "interval is empty")
+		l.PushNumber(math.Floor(r*u) + 1.0)
+	case 2:
+		lo, u := lua.CheckNumber(l, 1), lua.CheckNumber(l, 2)
+		lua.ArgumentCheck(l, lo <= u, 2, "interval is empty")
+		l.PushNumber(math.Floor(r*(u-lo+1)) + lo)
+	default:
+		lua.Errorf(l, "wrong number of arguments")
+	}
+	return 1
+}
+
+// restarts the random sequence of a deterministic VM
+func reseed(vm *lua.State) {
+	vm.Field(lua.RegistryIndex, reseedKey)
+	if vm.IsFunction(-1) {
+		vm.Call(0, 0)
+		return
+	}
+	vm.Pop(1)
+}
@@ -0,0 +1,43 @@
+package pool
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDeterministic(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	newPool := func() *Pool {
+		return NewPool(1, nil, WithDeterministic(DeterministicOptions{
+			Seed:  42,
+			Now:   func() time.Time { return now },
+			Clock: func() time.Duration { return 1500 * time.Millisecond },
+		}))
+	}
+	code := "return math.random(1000), math.random(1000), math.random()"
+	first, err := newPool().Eval(context.Background(), code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lpool := newPool()
+	for range 2 {
+		// every execution starts the same random sequence
+		results, err := lpool.Eval(context.Background(), code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(results, first) {
+			t.Errorf("expected %v but got %v", first, results)
+		}
+	}
+
+	results, err := lpool.Eval(context.Background(), "return os.time(), os.clock(), os.time({year=2000, month=1, day=1}) ~= os.time()")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(results, []any{float64(now.Unix()), 1.5, true}) {
+		t.Errorf("unexpected clocks %v", results)
+	}
+}
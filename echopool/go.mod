@@ -0,0 +1,24 @@
+module github.com/epikur-io/go-lua-pool/echopool
+
+go 1.22.3
+
+require (
+	github.com/epikur-io/go-lua v0.0.0-20250224085517-17039441b5fb // indirect
+	github.com/epikur-io/go-lua-pool v0.0.0-00010101000000-000000000000
+	github.com/labstack/echo/v4 v4.12.0
+)
+
+require (
+	github.com/labstack/gommon v0.4.2 // indirect
+	github.com/mattn/go-colorable v0.1.13 // indirect
+	github.com/mattn/go-isatty v0.0.20 // indirect
+	github.com/stretchr/testify v1.9.0 // indirect
+	github.com/valyala/bytebufferpool v1.0.0 // indirect
+	github.com/valyala/fasttemplate v1.2.2 // indirect
+	golang.org/x/crypto v0.23.0 // indirect
+	golang.org/x/net v0.25.0 // indirect
+	golang.org/x/sys v0.20.0 // indirect
+	golang.org/x/text v0.15.0 // indirect
+)
+
+replace github.com/epikur-io/go-lua-pool => ../
@@ -0,0 +1,34 @@
+// Package echopool provides Echo middleware attaching a pooled Lua VM to every
+// request.
+package echopool
+
+import (
+	"net/http"
+
+	pool "github.com/epikur-io/go-lua-pool"
+	"github.com/labstack/echo/v4"
+)
+
+// Returns middleware acquiring a VM of p for every request, which handlers get
+// by Lease or pool.FromContext(c.Request().Context()). The VM is released once
+// the handler returned, even if it panics. The acquire is bound to the request
+// context, requests without a VM fail with 503 Service Unavailable.
+func Middleware(p pool.IPool) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			r := c.Request()
+			lease, err := pool.NewLease(r.Context(), p)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusServiceUnavailable).SetInternal(err)
+			}
+			defer lease.Release()
+			c.SetRequest(r.WithContext(pool.NewContext(r.Context(), lease)))
+			return next(c)
+		}
+	}
+}
+
+// Returns the lease of the request acquired by Middleware
+func Lease(c echo.Context) (*pool.Lease, bool) {
+	return pool.FromContext(c.Request().Context())
+}
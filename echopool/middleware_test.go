@@ -0,0 +1,40 @@
+package echopool
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	pool "github.com/epikur-io/go-lua-pool"
+	"github.com/labstack/echo/v4"
+)
+
+func TestMiddleware(t *testing.T) {
+	p := pool.NewPool(1, nil)
+	e := echo.New()
+	e.Use(Middleware(p))
+	e.GET("/", func(c echo.Context) error {
+		if _, ok := Lease(c); !ok {
+			t.Error("expected lease")
+		}
+		return c.String(http.StatusOK, "ok")
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK || p.Stats().InUse != 0 {
+		t.Errorf("unexpected response %d or VM not released", rec.Code)
+	}
+
+	vm := p.Acquire()
+	defer p.Release(vm)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected %d but got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+}
@@ -0,0 +1,58 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+var ErrGlobalsNotReadOnly = fmt.Errorf("VM doesn't use read-only globals")
+
+type envKey struct{}
+
+// Returns a context providing the given values as globals to the executions it
+// is passed to (DoWithContext, Eval, CallGlobal, Run, ...), e.g. the settings
+// of a tenant. The values are converted by PushValue on every use and are gone
+// once the VM is released. Requires WithReadOnlyGlobals, otherwise executions
+// fail with ErrGlobalsNotReadOnly.
+func ContextWithEnv(ctx context.Context, env map[string]any) context.Context {
+	return context.WithValue(ctx, envKey{}, env)
+}
+
+// Returns the environment set by ContextWithEnv
+func EnvFromContext(ctx context.Context) (map[string]any, bool) {
+	env, ok := ctx.Value(envKey{}).(map[string]any)
+	return env, ok
+}
+
+// Adds the given values to the throwaway globals of an acquired VM of a pool
+// using WithReadOnlyGlobals, they are discarded when the VM is released.
+// Values already set for the current use are overwritten.
+func SetEnv(vm *lua.State, env map[string]any) error {
+	top := vm.Top()
+	defer vm.SetTop(top)
+	vm.Field(lua.RegistryIndex, scratchMetaKey)
+	isFrozen := !vm.IsNil(-1)
+	vm.RawGetInt(lua.RegistryIndex, lua.RegistryIndexGlobals)
+	if !isFrozen || !vm.MetaTable(-1) {
+		return ErrGlobalsNotReadOnly
+	}
+	vm.Field(-1, "__newindex")
+	scratch := vm.Top()
+
+	// sorted for a deterministic order of conversion errors
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := PushValue(vm, env[name]); err != nil {
+			return fmt.Errorf("env %s: %w", name, err)
+		}
+		vm.SetField(scratch, name)
+	}
+	return nil
+}
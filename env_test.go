@@ -0,0 +1,62 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+func TestContextWithEnv(t *testing.T) {
+	scripts := NewScriptRegistry()
+	scripts.Register("greet", `return greeting .. ", " .. tenant.name`)
+	lpool := NewPool(1, func() *lua.State {
+		vm := NewLuaVM()
+		lua.DoString(vm, `greeting = "hello"`)
+		return vm
+	}, WithScriptRegistry(scripts), WithReadOnlyGlobals(true))
+
+	run := func(ctx context.Context) any {
+		results, err := lpool.Run(ctx, "greet")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return results[0]
+	}
+	ctx := ContextWithEnv(context.Background(), map[string]any{
+		"tenant": map[string]any{"name": "acme"},
+	})
+	if greeting := run(ctx); greeting != "hello, acme" {
+		t.Errorf("unexpected greeting %q", greeting)
+	}
+	ctx = ContextWithEnv(context.Background(), map[string]any{
+		"tenant":   map[string]any{"name": "initech"},
+		"greeting": "hi",
+	})
+	if greeting := run(ctx); greeting != "hi, initech" {
+		t.Errorf("unexpected greeting %q", greeting)
+	}
+	// nothing is left for the next user
+	results, err := lpool.Eval(context.Background(), "return tenant, greeting")
+	if err != nil || !reflect.DeepEqual(results, []any{nil, "hello"}) {
+		t.Errorf("expected tenant to be gone but got %v, %v", results, err)
+	}
+}
+
+func TestSetEnv(t *testing.T) {
+	lpool := NewPool(1, nil, WithReadOnlyGlobals(true))
+	vm := lpool.Acquire()
+	if err := SetEnv(vm, map[string]any{"answer": 42}); err != nil {
+		t.Fatal(err)
+	}
+	if err := lua.DoString(vm, "assert(answer == 42)"); err != nil {
+		t.Error(err)
+	}
+	lpool.Release(vm)
+
+	if err := SetEnv(NewLuaVM(), nil); !errors.Is(err, ErrGlobalsNotReadOnly) {
+		t.Errorf("expected error for mutable globals but got %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+// ErrorAction decides what happens to a VM after an execution failed, see
+// ErrorPolicy
+type ErrorAction int
+
+const (
+	// the VM is returned to the pool as is (default)
+	ReuseOnError ErrorAction = iota
+	// the VM is checked by ErrorPolicy.Validate and replaced if it fails
+	ValidateOnError
+	// the VM is replaced after ErrorPolicy.MaxErrors errors in a row
+	RecycleAfterErrors
+	// the VM is replaced after every error
+	DiscardOnError
+)
+
+// ErrorPolicy decides what happens to a VM after an execution by Do, Eval,
+// CallGlobal or Run failed. Quota violations are handled by the violation
+// policies (see WithViolationPolicy), errors of canceled or timed out
+// contexts are ignored.
+type ErrorPolicy struct {
+	Action ErrorAction
+	// reports whether the VM may be reused, see ValidateOnError. If nil the
+	// health check script (see WithHealthCheckScript) must succeed.
+	Validate func(*lua.State) bool
+	// see RecycleAfterErrors
+	MaxErrors int
+}
+
+// Sets the policy for VMs after failed executions. VMs failing validation are
+// quarantined instead if a quarantine is configured (see WithQuarantine).
+func WithErrorPolicy(policy ErrorPolicy) Option {
+	return func(p *Pool) {
+		p.errorPolicy = policy
+	}
+}
+
+func (e ErrorPolicy) validate() error {
+	switch e.Action {
+	case ReuseOnError, ValidateOnError, DiscardOnError:
+		return nil
+	case RecycleAfterErrors:
+		if e.MaxErrors < 1 {
+			return fmt.Errorf("%w: error policy needs MaxErrors", ErrInvalidOption)
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: unknown error action %d", ErrInvalidOption, e.Action)
+}
+
+type errorCountKey struct{}
+
+// true if failed executions are counted per VM
+func (p *Pool) countingErrors() bool {
+	return p.maxErrors > 0 || p.errorPolicy.Action == RecycleAfterErrors || p.autoRecycle > 0
+}
+
+// counts the failed executions of a VM in a row, errors of canceled or timed
+// out contexts don't count
+func (p *Pool) countError(ctx context.Context, vm *lua.State, err error) {
+	if err != nil && ctx.Err() != nil {
+		return
+	}
+	p.ReportError(vm, err)
+}
+
+// failed executions of a VM in a row
+func (p *Pool) errorCount(vm *lua.State) int {
+	n, _ := p.core.Data(vm, errorCountKey{})
+	count, _ := n.(int)
+	return count
+}
+
+// applies the error policy and quarantine after an execution which didn't
+// violate its quota, returns whether the VM must be replaced or the reason to
+// quarantine it
+func (p *Pool) afterExec(ctx context.Context, vm *lua.State, err error) (recycle bool, quarantine error) {
+	if err == nil || ctx.Err() != nil {
+		return false, nil
+	}
+	count := p.errorCount(vm)
+	if p.maxErrors > 0 && count >= p.maxErrors {
+		return false, fmt.Errorf("%w (%d in a row): %w", ErrRepeatedErrors, count, err)
+	}
+	switch p.errorPolicy.Action {
+	case ValidateOnError:
+		if p.validateVM(ctx, vm) {
+			return false, nil
+		}
+		if p.quarantineSize > 0 {
+			return false, fmt.Errorf("%w: %w", ErrInvalidVM, err)
+		}
+		return true, nil
+	case RecycleAfterErrors:
+		return count >= p.errorPolicy.MaxErrors, nil
+	case DiscardOnError:
+		return true, nil
+	}
+	return false, nil
+}
+
+// runs the validator of the error policy
+func (p *Pool) validateVM(ctx context.Context, vm *lua.State) bool {
+	if p.errorPolicy.Validate != nil {
+		return p.errorPolicy.Validate(vm)
+	}
+	if p.healthScript != "" {
+		return runHealthScript(ctx, vm, p.healthScript) == nil
+	}
+	return true
+}
@@ -0,0 +1,66 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+func TestErrorPolicy(t *testing.T) {
+	ctx := context.Background()
+	// returns whether the VM was replaced after executing code
+	replaced := func(lpool *Pool, code string) bool {
+		t.Helper()
+		vm := lpool.Acquire()
+		lpool.Release(vm)
+		lpool.Eval(ctx, code)
+		next := lpool.Acquire()
+		lpool.Release(next)
+		return next != vm
+	}
+
+	lpool := NewPool(1, nil)
+	if replaced(lpool, "error('x')") {
+		t.Errorf("expected the VM to be reused by default")
+	}
+
+	lpool = NewPool(1, nil, WithErrorPolicy(ErrorPolicy{Action: DiscardOnError}))
+	if replaced(lpool, "return 1") || !replaced(lpool, "error('x')") {
+		t.Errorf("expected the VM to be discarded after an error only")
+	}
+
+	lpool = NewPool(1, nil, WithErrorPolicy(ErrorPolicy{Action: RecycleAfterErrors, MaxErrors: 2}))
+	if replaced(lpool, "error('x')") || replaced(lpool, "return 1") || replaced(lpool, "error('x')") {
+		t.Errorf("expected the VM to be kept below 2 errors in a row")
+	}
+	if !replaced(lpool, "error('x')") {
+		t.Errorf("expected the VM to be recycled after 2 errors in a row")
+	}
+
+	lpool = NewPool(1, nil, WithErrorPolicy(ErrorPolicy{
+		Action: ValidateOnError,
+		Validate: func(vm *lua.State) bool {
+			vm.Global("broken")
+			defer vm.Pop(1)
+			return !vm.ToBoolean(-1)
+		},
+	}))
+	if replaced(lpool, "error('x')") || !replaced(lpool, "broken = true; error('x')") {
+		t.Errorf("expected invalid VMs to be replaced")
+	}
+
+	// the health check script validates by default
+	lpool = NewPool(1, nil, WithHealthCheckScript("assert(not broken)"),
+		WithErrorPolicy(ErrorPolicy{Action: ValidateOnError}))
+	if replaced(lpool, "error('x')") || !replaced(lpool, "broken = true; error('x')") {
+		t.Errorf("expected VMs failing the health check script to be replaced")
+	}
+
+	for _, policy := range []ErrorPolicy{{Action: RecycleAfterErrors}, {Action: 42}} {
+		if _, err := New(1, nil, WithErrorPolicy(policy)); !errors.Is(err, ErrInvalidOption) {
+			t.Errorf("expected %v but got %v", ErrInvalidOption, err)
+		}
+	}
+}
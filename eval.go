@@ -0,0 +1,146 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+var ErrFunctionNotFound = fmt.Errorf("lua function not found")
+
+// ScriptError is returned for errors raised while running Lua code
+type ScriptError struct {
+	// the error raised by the script, without the traceback
+	Err error
+	// Lua stack traceback at the point of the error, empty if it couldn't be
+	// captured
+	Traceback string
+}
+
+func (e *ScriptError) Error() string {
+	if e.Traceback == "" {
+		return e.Err.Error()
+	}
+	return e.Err.Error() + "\n" + e.Traceback
+}
+
+func (e *ScriptError) Unwrap() error {
+	return e.Err
+}
+
+// separates the error message from the traceback appended by tracebackHandler
+const tracebackSeparator = "\nstack traceback:\n"
+
+// message handler appending the stack traceback to the error message, it is
+// split off again by protectedCall
+func tracebackHandler(vm *lua.State) int {
+	msg, _ := lua.ToStringMeta(vm, 1)
+	lua.Traceback(vm, vm, msg, 1)
+	return 1
+}
+
+// runs a chunk of Lua code like lua.DoString, errors raised by the chunk are
+// returned as *ScriptError
+func doString(vm *lua.State, code string) error {
+	top := vm.Top()
+	defer vm.SetTop(top)
+	vm.PushGoFunction(tracebackHandler)
+	handler := vm.Top()
+	if err := lua.LoadString(vm, code); err != nil {
+		return err
+	}
+	return protectedCall(vm, handler, nil)
+}
+
+// Loads and runs a chunk of Lua code on a pooled VM. The args are converted to
+// Lua values (see PushValue) and passed to the chunk as varargs (...), all
+// values returned by the chunk are converted back to Go values (see ToValue).
+// ctx bounds both the wait for a VM and the execution of the chunk. Errors
+// raised by the chunk are returned as *ScriptError including the Lua traceback.
+func (p *Pool) Eval(ctx context.Context, code string, args ...any) ([]any, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	q := p.quotaFor(ctx, "")
+	var results []any
+	err := p.do(ctx, q, func(vm *lua.State) error {
+		vm.PushGoFunction(tracebackHandler)
+		handler := vm.Top()
+		if err := lua.LoadString(vm, code); err != nil {
+			return err
+		}
+		var err error
+		results, err = call(vm, handler, handler, args, q.Output)
+		return err
+	})
+	return results, err
+}
+
+// Calls a global Lua function on a pooled VM, typically one preloaded by the VM
+// factory. Arguments and results are converted like in Eval. Errors raised by
+// the function are returned as *ScriptError including the Lua traceback.
+func (p *Pool) CallGlobal(ctx context.Context, fnName string, args ...any) ([]any, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	q := p.quotaFor(ctx, "")
+	var results []any
+	err := p.do(ctx, q, func(vm *lua.State) error {
+		vm.PushGoFunction(tracebackHandler)
+		handler := vm.Top()
+		vm.Global(fnName)
+		if !vm.IsFunction(-1) {
+			return fmt.Errorf("%w: %s", ErrFunctionNotFound, fnName)
+		}
+		var err error
+		results, err = call(vm, handler, handler, args, q.Output)
+		return err
+	})
+	return results, err
+}
+
+// calls the function on top of the stack with the given args and returns its
+// results, base is the stack top below the function and handler the stack index
+// of a message handler (see tracebackHandler) or 0, limits restrict the
+// conversion of the results
+func call(vm *lua.State, base int, handler int, args []any, limits ConvertLimits) ([]any, error) {
+	if err := protectedCall(vm, handler, args); err != nil {
+		return nil, err
+	}
+	results := make([]any, 0, vm.Top()-base)
+	for i := base + 1; i <= vm.Top(); i++ {
+		v, err := limits.ToValue(vm, i)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, v)
+	}
+	return results, nil
+}
+
+// calls the function on top of the stack with the given args and leaves its
+// results on the stack, see call
+func protectedCall(vm *lua.State, handler int, args []any) error {
+	for _, arg := range args {
+		if err := PushValue(vm, arg); err != nil {
+			return err
+		}
+	}
+	if err := vm.ProtectedCall(len(args), lua.MultipleReturns, handler); err != nil {
+		if handler == 0 {
+			return err
+		}
+		if _, ok := err.(lua.RuntimeError); !ok {
+			return &ScriptError{Err: err}
+		}
+		msg, _ := vm.ToString(-1)
+		i := strings.Index(msg, tracebackSeparator)
+		if i < 0 {
+			return &ScriptError{Err: err}
+		}
+		return &ScriptError{Err: lua.RuntimeError(msg[:i]), Traceback: msg[i+1:]}
+	}
+	return nil
+}
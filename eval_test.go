@@ -0,0 +1,144 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+func TestEval(t *testing.T) {
+	lpool := NewPool(1, nil)
+	results, err := lpool.Eval(context.Background(), `
+		local a, b, name = ...
+		return a + b, "hello " .. name, {1, 2, 3}, {key = "value"}, nil, true
+	`, 40, 2.0, "lua")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []any{
+		42.0,
+		"hello lua",
+		[]any{1.0, 2.0, 3.0},
+		map[string]any{"key": "value"},
+		nil,
+		true,
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("expected %#v but got %#v", expected, results)
+	}
+}
+
+func TestEvalTableArgs(t *testing.T) {
+	lpool := NewPool(1, nil)
+	results, err := lpool.Eval(context.Background(), `
+		local list, dict = ...
+		return #list, dict.name
+	`, []any{"a", "b"}, map[string]any{"name": "lua"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(results, []any{2.0, "lua"}) {
+		t.Errorf("unexpected results %#v", results)
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	lpool := NewPool(1, nil)
+	if _, err := lpool.Eval(context.Background(), "this is not lua"); err == nil {
+		t.Errorf("expected syntax error")
+	}
+	if _, err := lpool.Eval(context.Background(), "error('failed')"); err == nil {
+		t.Errorf("expected runtime error")
+	}
+	if _, err := lpool.Eval(context.Background(), "return ...", make(chan int)); err == nil {
+		t.Errorf("expected unsupported type error")
+	}
+	if _, err := lpool.Eval(context.Background(), "local t = {} t.self = t return t"); err == nil {
+		t.Errorf("expected nesting error for cyclic table")
+	}
+}
+
+func TestCallGlobal(t *testing.T) {
+	lpool := NewPool(1, func() *lua.State {
+		vm := NewLuaVM()
+		err := lua.DoString(vm, `
+			function greet(name) return "hello " .. name end
+			function fail() error("failed") end
+		`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return vm
+	})
+
+	results, err := lpool.CallGlobal(context.Background(), "greet", "lua")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(results, []any{"hello lua"}) {
+		t.Errorf("unexpected results %#v", results)
+	}
+
+	_, err = lpool.CallGlobal(context.Background(), "missing")
+	if !errors.Is(err, ErrFunctionNotFound) {
+		t.Errorf("expected %v but got %v", ErrFunctionNotFound, err)
+	}
+
+	_, err = lpool.CallGlobal(context.Background(), "fail")
+	var scriptErr *ScriptError
+	if !errors.As(err, &scriptErr) {
+		t.Fatalf("expected script error but got %v", err)
+	}
+	if !strings.Contains(scriptErr.Traceback, "stack traceback") || !strings.Contains(scriptErr.Traceback, ":3:") {
+		t.Errorf("expected traceback pointing to line 3 but got %q", scriptErr.Traceback)
+	}
+}
+
+func TestEvalTraceback(t *testing.T) {
+	lpool := NewPool(1, nil)
+	_, err := lpool.Eval(context.Background(), "local function fail() error('boom') end\nfail()")
+	var scriptErr *ScriptError
+	if !errors.As(err, &scriptErr) {
+		t.Fatalf("expected script error but got %v", err)
+	}
+	if msg := scriptErr.Err.Error(); !strings.Contains(msg, "boom") || strings.Contains(msg, "stack traceback") {
+		t.Errorf("expected the message without traceback but got %q", msg)
+	}
+	if !strings.Contains(scriptErr.Traceback, "stack traceback") || !strings.Contains(scriptErr.Traceback, ":2:") {
+		t.Errorf("expected traceback pointing to line 2 but got %q", scriptErr.Traceback)
+	}
+
+	// syntax errors are no script errors
+	_, err = lpool.Eval(context.Background(), "this is not lua")
+	if err == nil || errors.As(err, &scriptErr) {
+		t.Errorf("expected a plain syntax error but got %v", err)
+	}
+
+	results := lpool.RunScriptOnAll(context.Background(), "error('boom')")
+	if len(results) != 1 || !errors.As(results[0].Err, &scriptErr) {
+		t.Errorf("expected script errors but got %+v", results)
+	}
+}
+
+func TestEvalCancel(t *testing.T) {
+	lpool := NewPool(1, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	start := time.Now()
+	// the abort can't be caught by the script
+	_, err := lpool.Eval(ctx, "while true do pcall(function() while true do end end) end")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v but got %v", context.Canceled, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected prompt abort but took %v", elapsed)
+	}
+}
@@ -0,0 +1,142 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	lua "github.com/epikur-io/go-lua"
+	"github.com/epikur-io/go-lua-pool/generic"
+)
+
+// Acquires a VM, runs fn on it and releases the VM again, even if fn panics.
+// Values fn leaves on the Lua stack are removed before the VM is released.
+// The quota profile of the pool applies (see WithQuotaProfile).
+func (p *Pool) Do(fn func(*lua.State) error) error {
+	ctx := context.Background()
+	return p.do(ctx, p.quotaFor(ctx, ""), fn)
+}
+
+// Like Do but ctx bounds both the wait for a VM and the execution of Lua code
+// inside fn, which gets aborted once ctx is done. Lua code can't catch the
+// abort with pcall. Go functions called by the script which block should watch
+// vm.GetContext() themselves.
+// If ctx is done the returned error always matches ctx.Err() via errors.Is.
+func (p *Pool) DoWithContext(ctx context.Context, fn func(*lua.State) error) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return p.do(ctx, p.quotaFor(ctx, ""), fn)
+}
+
+// acquires a VM and runs fn on it with the given quota, VMs interrupted by a
+// quota violation are replaced instead of returned to the pool, VMs of other
+// failed executions are handled by the error policy and quarantine (see
+// WithErrorPolicy and WithQuarantine)
+func (p *Pool) do(ctx context.Context, q QuotaProfile, fn func(*lua.State) error) error {
+	var vm *lua.State
+	var err error
+	if weight, ok := WeightFromContext(ctx); ok {
+		vm, err = p.AcquireWeighted(ctx, weight)
+	} else {
+		vm, err = p.AcquireWithContext(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	recycle := false
+	var quarantine error
+	defer func() {
+		switch {
+		case recycle:
+			p.recycle(vm)
+		case quarantine != nil:
+			p.quarantine(vm, quarantine)
+		default:
+			p.Release(vm)
+		}
+	}()
+	res, _ := ExecResultFromContext(ctx)
+	if res != nil {
+		defer p.measure(vm, res)()
+	}
+	var start time.Time
+	if p.canaryActive.Load() {
+		start = p.clock.Now()
+	}
+	err = p.exec(ctx, vm, q, res, fn)
+	p.recordExec(vm, start, err)
+	recycle = p.mustRecycle(err)
+	if !recycle {
+		recycle, quarantine = p.afterExec(ctx, vm, err)
+	}
+	return err
+}
+
+// runs fn on an acquired VM bound to ctx and with the given quota applied,
+// values left on the stack are removed afterwards. The executed instructions
+// are counted into res unless it is nil.
+func (p *Pool) exec(ctx context.Context, vm *lua.State, q QuotaProfile, res *ExecResult, fn func(*lua.State) error) error {
+	execCtx := ctx
+	if q.Timeout > 0 {
+		var cancel context.CancelFunc
+		execCtx, cancel = generic.ContextWithTimeout(ctx, p.clock, q.Timeout)
+		defer cancel()
+	}
+	top := vm.Top()
+	defer vm.SetTop(top)
+	if env, ok := EnvFromContext(ctx); ok {
+		if err := SetEnv(vm, env); err != nil {
+			return err
+		}
+	}
+	// contexts which are never done don't need to be checked by the VM, unless
+	// the access policy needs them
+	if execCtx.Done() != nil || p.accessPolicy != nil {
+		restore := bindContext(vm, execCtx)
+		defer restore()
+	}
+	err := func() error {
+		limits := installLimits(vm, q, res != nil, p.profiler)
+		if limits == nil {
+			return fn(vm)
+		}
+		defer limits.restore()
+		err := fn(vm)
+		if res != nil {
+			res.Instructions = limits.executed
+		}
+		if limits.violation != nil {
+			err = fmt.Errorf("%w: %w", limits.violation, err)
+		}
+		return err
+	}()
+	err = contextError(execCtx, err)
+	if q.Timeout > 0 && ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+		err = fmt.Errorf("%w: %w", ErrExecTimeout, err)
+	}
+	p.countError(ctx, vm, err)
+	return err
+}
+
+// lets the VM abort running Lua code once ctx is done, the returned function
+// restores the previous context of the VM
+func bindContext(vm *lua.State, ctx context.Context) func() {
+	prev := vm.GetContext()
+	vm.SetContext(ctx)
+	return func() {
+		vm.SetContext(prev)
+	}
+}
+
+// makes sure err matches ctx.Err() if ctx is done
+func contextError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil && !errors.Is(err, ctxErr) {
+		return fmt.Errorf("%w: %w", ctxErr, err)
+	}
+	return err
+}
@@ -0,0 +1,111 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+func TestDo(t *testing.T) {
+	lpool := NewPool(1, nil)
+	var result int
+	err := lpool.Do(func(vm *lua.State) error {
+		if err := lua.DoString(vm, "return 40 + 2"); err != nil {
+			return err
+		}
+		result, _ = vm.ToInteger(-1)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != 42 {
+		t.Errorf("expected 42 but got %d", result)
+	}
+	if lpool.Len() != 1 {
+		t.Errorf("expected vm to be released")
+	}
+	lpool.Do(func(vm *lua.State) error {
+		if vm.Top() != 0 {
+			t.Errorf("expected clean stack but got %d values", vm.Top())
+		}
+		return nil
+	})
+}
+
+func TestDoReleasesOnErrorAndPanic(t *testing.T) {
+	lpool := NewPool(1, nil)
+	errFailed := errors.New("failed")
+	err := lpool.Do(func(vm *lua.State) error {
+		return errFailed
+	})
+	if !errors.Is(err, errFailed) {
+		t.Errorf("expected %v but got %v", errFailed, err)
+	}
+
+	func() {
+		defer func() { recover() }()
+		lpool.Do(func(vm *lua.State) error {
+			panic("boom")
+		})
+	}()
+	if lpool.Len() != 1 {
+		t.Errorf("expected vm to be released after panic")
+	}
+}
+
+func TestDoWithContextAbortsScript(t *testing.T) {
+	lpool := NewPool(1, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := lpool.DoWithContext(ctx, func(vm *lua.State) error {
+		return lua.DoString(vm, "while true do end")
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded but got %v", err)
+	}
+
+	// the VM must be usable again without the expired context
+	err = lpool.DoWithContext(context.Background(), func(vm *lua.State) error {
+		return lua.DoString(vm, "return 1")
+	})
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+	}
+}
+
+func TestDoWithContextAcquireTimeout(t *testing.T) {
+	lpool := NewPool(1, nil)
+	lvm := lpool.Acquire()
+	defer lpool.Release(lvm)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	called := false
+	err := lpool.DoWithContext(ctx, func(vm *lua.State) error {
+		called = true
+		return nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded but got %v", err)
+	}
+	if called {
+		t.Errorf("fn must not be called without a VM")
+	}
+}
+
+func TestDoWithContextWrapsErrors(t *testing.T) {
+	lpool := NewPool(1, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	errFailed := errors.New("failed")
+	err := lpool.DoWithContext(ctx, func(vm *lua.State) error {
+		cancel()
+		return errFailed
+	})
+	if !errors.Is(err, context.Canceled) || !errors.Is(err, errFailed) {
+		t.Errorf("expected error to match context.Canceled and %v but got %v", errFailed, err)
+	}
+}
@@ -0,0 +1,59 @@
+package pool
+
+import (
+	"context"
+	"runtime"
+	"time"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+// Cost of a single execution, see ContextWithExecResult
+type ExecResult struct {
+	// ID of the VM which ran the execution, see VMID
+	VMID uint64
+	// of the execution, without the wait for the VM
+	WallTime time.Duration
+	// CPU time of the executing thread, only available on Linux, other
+	// platforms report the wall-clock time
+	CPUTime time.Duration
+	// Lua instructions executed, counted in steps of 100, so short executions
+	// may report 0. Instructions of Go functions called by the script are not
+	// counted.
+	Instructions int
+}
+
+type execResultKey struct{}
+
+// Returns a context making the executions it is passed to (DoWithContext, Eval,
+// CallGlobal, Run, ...) fill res with their cost once they return, also if
+// they failed. Measuring installs a count hook and keeps the execution on its
+// thread, so it is slightly slower. res must not be shared by concurrent
+// executions.
+func ContextWithExecResult(ctx context.Context, res *ExecResult) context.Context {
+	return context.WithValue(ctx, execResultKey{}, res)
+}
+
+// Returns the result set by ContextWithExecResult
+func ExecResultFromContext(ctx context.Context) (*ExecResult, bool) {
+	res, ok := ctx.Value(execResultKey{}).(*ExecResult)
+	return res, ok && res != nil
+}
+
+// starts measuring an execution on vm, the returned function fills res once
+// the execution returned, except the instructions which are counted by exec
+func (p *Pool) measure(vm *lua.State, res *ExecResult) func() {
+	*res = ExecResult{}
+	if id, ok := p.VMID(vm); ok {
+		res.VMID = id
+	}
+	// keep the execution on the thread whose CPU time is measured
+	runtime.LockOSThread()
+	cpuStart := threadCPUTime()
+	start := p.clock.Now()
+	return func() {
+		res.WallTime = p.clock.Now().Sub(start)
+		res.CPUTime = threadCPUTime() - cpuStart
+		runtime.UnlockOSThread()
+	}
+}
@@ -0,0 +1,63 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestExecResult(t *testing.T) {
+	lpool := NewPool(1, nil)
+	defer lpool.Close()
+
+	var res ExecResult
+	ctx := ContextWithExecResult(context.Background(), &res)
+	if _, err := lpool.Eval(ctx, "local x = 0 for i = 1, 10000 do x = x + i end return x"); err != nil {
+		t.Fatal(err)
+	}
+	vm := lpool.Acquire()
+	id, _ := lpool.VMID(vm)
+	lpool.Release(vm)
+	if res.VMID != id {
+		t.Errorf("expected VM %d but got %d", id, res.VMID)
+	}
+	if res.WallTime <= 0 {
+		t.Errorf("expected a wall time but got %v", res.WallTime)
+	}
+	// a loop iteration takes a few instructions
+	if res.Instructions < 10000 || res.Instructions > 100000 {
+		t.Errorf("unexpected instruction count %d", res.Instructions)
+	}
+
+	// filled on errors too and reset for every execution
+	if _, err := lpool.Eval(ctx, "error('boom')"); err == nil {
+		t.Fatal("expected an error")
+	}
+	if res.VMID != id || res.Instructions >= 10000 {
+		t.Errorf("unexpected result %+v", res)
+	}
+}
+
+func TestExecResultWithInstructionLimit(t *testing.T) {
+	lpool := NewPool(1, nil, WithInstructionLimit(1000))
+	defer lpool.Close()
+
+	var res ExecResult
+	ctx := ContextWithExecResult(context.Background(), &res)
+	_, err := lpool.Eval(ctx, "while true do end")
+	if !errors.Is(err, ErrInstructionLimit) {
+		t.Fatalf("expected %v but got %v", ErrInstructionLimit, err)
+	}
+	if res.Instructions != 1000 {
+		t.Errorf("expected 1000 instructions but got %d", res.Instructions)
+	}
+}
+
+func TestExecResultFromContext(t *testing.T) {
+	if _, ok := ExecResultFromContext(context.Background()); ok {
+		t.Error("expected no result")
+	}
+	if _, ok := ExecResultFromContext(ContextWithExecResult(context.Background(), nil)); ok {
+		t.Error("expected no result for nil")
+	}
+}
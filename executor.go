@@ -0,0 +1,191 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+var ErrExecutorClosed = fmt.Errorf("executor closed")
+
+// Job is executed by an Executor on a pooled VM
+type Job func(vm *lua.State) (any, error)
+
+// ExecutorOptions configures an Executor
+type ExecutorOptions struct {
+	// number of jobs waiting for a VM before Submit blocks, defaults to the pool capacity
+	QueueSize int
+	// number of jobs running in parallel, defaults to the pool capacity
+	Workers int
+	// Every worker acquires a VM for its first job, bounded by the context of
+	// the job, and runs all further jobs on it until the executor is closed,
+	// which saves the acquire and release per job and keeps each VM on a
+	// single goroutine. Pinned VMs are not available to other users of the
+	// pool, so Workers is limited to the pool capacity and Pool.Update waits
+	// for them until the update timeout and then replaces them as leaked (see
+	// WithUpdateTimeout). VMs replaced by Pool.Update or Pool.RollingUpdate are
+	// swapped after the job running on them, VMs of failed jobs are handled
+	// by the error policy and quarantine like in Pool.Do.
+	Pinned bool
+}
+
+// Executor runs jobs on the VMs of a pool. Jobs are queued in a bounded queue
+// in front of the pool, producers block in Submit once the queue is full.
+type Executor struct {
+	pool  *Pool
+	queue chan *task
+	wg    sync.WaitGroup
+
+	mux    sync.RWMutex
+	closed bool
+}
+
+type task struct {
+	ctx    context.Context
+	job    Job
+	future *Future
+}
+
+// Future delivers the result of a submitted job
+type Future struct {
+	done   chan struct{}
+	result any
+	err    error
+}
+
+// Creates an executor and starts its workers, see Close
+func NewExecutor(p *Pool, opts ExecutorOptions) *Executor {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = p.Cap()
+	}
+	if opts.Workers <= 0 || (opts.Pinned && opts.Workers > p.Cap()) {
+		opts.Workers = p.Cap()
+	}
+	e := &Executor{
+		pool:  p,
+		queue: make(chan *task, opts.QueueSize),
+	}
+	e.wg.Add(opts.Workers)
+	for range opts.Workers {
+		if opts.Pinned {
+			go e.workPinned()
+		} else {
+			go e.work()
+		}
+	}
+	return e
+}
+
+// Queues a job, blocking while the queue is full. ctx bounds the wait for a
+// free queue slot, the wait for a VM and the execution of Lua code inside the
+// job (see Pool.DoWithContext). Failures to queue the job are reported by the
+// returned future.
+func (e *Executor) Submit(ctx context.Context, job Job) *Future {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	f := &Future{done: make(chan struct{})}
+	e.mux.RLock()
+	defer e.mux.RUnlock()
+	if e.closed {
+		f.complete(nil, ErrExecutorClosed)
+		return f
+	}
+	select {
+	case e.queue <- &task{ctx: ctx, job: job, future: f}:
+	case <-ctx.Done():
+		f.complete(nil, ctx.Err())
+	}
+	return f
+}
+
+// Stops accepting jobs and waits until all queued jobs are done
+func (e *Executor) Close() {
+	e.mux.Lock()
+	if !e.closed {
+		e.closed = true
+		close(e.queue)
+	}
+	e.mux.Unlock()
+	e.wg.Wait()
+}
+
+func (e *Executor) work() {
+	defer e.wg.Done()
+	for t := range e.queue {
+		if err := t.ctx.Err(); err != nil {
+			t.future.complete(nil, err)
+			continue
+		}
+		var result any
+		err := e.pool.DoWithContext(t.ctx, func(vm *lua.State) (err error) {
+			result, err = runJob(vm, t.job)
+			return err
+		})
+		t.future.complete(result, err)
+	}
+}
+
+func (e *Executor) workPinned() {
+	defer e.wg.Done()
+	// acquired with the context of the next job, so the wait is bounded
+	var vm *lua.State
+	defer func() {
+		if vm != nil {
+			e.pool.Release(vm)
+		}
+	}()
+	for t := range e.queue {
+		if err := t.ctx.Err(); err != nil {
+			t.future.complete(nil, err)
+			continue
+		}
+		if vm == nil {
+			var err error
+			if vm, err = e.pool.AcquireWithContext(t.ctx); err != nil {
+				t.future.complete(nil, err)
+				continue
+			}
+		}
+		var result any
+		err := e.pool.exec(t.ctx, vm, e.pool.quotaFor(t.ctx, ""), nil, func(vm *lua.State) (err error) {
+			result, err = runJob(vm, t.job)
+			return err
+		})
+		t.future.complete(result, err)
+		if !e.pool.keep(t.ctx, vm, err) {
+			vm = nil
+		}
+	}
+}
+
+func runJob(vm *lua.State, job Job) (result any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", ErrPanic, r)
+		}
+	}()
+	return job(vm)
+}
+
+func (f *Future) complete(result any, err error) {
+	f.result, f.err = result, err
+	close(f.done)
+}
+
+// Returns a channel which is closed once the job is done
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Waits until the job is done and returns its result, ctx only bounds the wait
+func (f *Future) Wait(ctx context.Context) (any, error) {
+	select {
+	case <-f.done:
+		return f.result, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,216 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+func TestExecutor(t *testing.T) {
+	for _, pinned := range []bool{false, true} {
+		lpool := NewPool(2, nil)
+		testExecutor(t, lpool, NewExecutor(lpool, ExecutorOptions{Pinned: pinned}))
+	}
+}
+
+func testExecutor(t *testing.T, lpool *Pool, e *Executor) {
+	ctx := context.Background()
+
+	var futures []*Future
+	for i := range 10 {
+		futures = append(futures, e.Submit(ctx, func(vm *lua.State) (any, error) {
+			if err := lua.LoadString(vm, "local n = ... return n * 2"); err != nil {
+				return nil, err
+			}
+			vm.PushInteger(i)
+			vm.Call(1, 1)
+			n, _ := vm.ToInteger(-1)
+			return n, nil
+		}))
+	}
+	for i, f := range futures {
+		result, err := f.Wait(ctx)
+		if err != nil || result != i*2 {
+			t.Errorf("job %d: unexpected result %v, %v", i, result, err)
+		}
+	}
+
+	f := e.Submit(ctx, func(vm *lua.State) (any, error) { panic("boom") })
+	if _, err := f.Wait(ctx); !errors.Is(err, ErrPanic) {
+		t.Errorf("expected panic error but got %v", err)
+	}
+
+	e.Close()
+	if _, err := e.Submit(ctx, nil).Wait(ctx); !errors.Is(err, ErrExecutorClosed) {
+		t.Errorf("expected executor closed but got %v", err)
+	}
+	if s := lpool.Stats(); s.Idle != 2 {
+		t.Errorf("expected all VMs to be idle but got %+v", s)
+	}
+}
+
+func TestExecutorBackpressure(t *testing.T) {
+	lpool := NewPool(1, nil)
+	e := NewExecutor(lpool, ExecutorOptions{QueueSize: 1, Workers: 1})
+	defer e.Close()
+
+	release := make(chan struct{})
+	block := func(vm *lua.State) (any, error) {
+		<-release
+		return nil, nil
+	}
+	running := e.Submit(context.Background(), block)
+	// wait until the worker picked up the first job
+	for len(e.queue) != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	queued := e.Submit(context.Background(), block)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := e.Submit(ctx, block).Wait(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected full queue to block until the deadline but got %v", err)
+	}
+	close(release)
+	for _, f := range []*Future{running, queued} {
+		if _, err := f.Wait(context.Background()); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestPinnedExecutorRollingUpdate(t *testing.T) {
+	lpool := NewPool(1, nil)
+	e := NewExecutor(lpool, ExecutorOptions{Workers: 4, Pinned: true})
+	defer e.Close()
+
+	vmOf := func() *lua.State {
+		vm, err := e.Submit(context.Background(), func(vm *lua.State) (any, error) {
+			return vm, nil
+		}).Wait(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return vm.(*lua.State)
+	}
+	first := vmOf()
+	if s := lpool.Stats(); s.InUse != 1 {
+		t.Errorf("expected the worker to pin the only VM but got %+v", s)
+	}
+	if vm := vmOf(); vm != first {
+		t.Errorf("expected jobs to run on the pinned VM")
+	}
+	lpool.RollingUpdate()
+	// the job running after the update still uses the old VM
+	vmOf()
+	if vm := vmOf(); vm == first {
+		t.Errorf("expected the stale VM to be replaced")
+	}
+}
+
+func TestPinnedExecutorClosedPool(t *testing.T) {
+	lpool := NewPool(1, nil)
+	lpool.Close()
+	e := NewExecutor(lpool, ExecutorOptions{Pinned: true})
+	defer e.Close()
+	_, err := e.Submit(context.Background(), func(vm *lua.State) (any, error) {
+		return nil, nil
+	}).Wait(context.Background())
+	if !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("expected %v but got %v", ErrPoolClosed, err)
+	}
+}
+
+func TestPinnedExecutorBusyPool(t *testing.T) {
+	lpool := NewPool(1, nil)
+	vm := lpool.Acquire()
+	defer lpool.Release(vm)
+	// doesn't wait for a VM
+	e := NewExecutor(lpool, ExecutorOptions{Pinned: true})
+	defer e.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := e.Submit(ctx, func(vm *lua.State) (any, error) {
+		return nil, nil
+	}).Wait(context.Background())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected %v but got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestPinnedExecutorErrorPolicy(t *testing.T) {
+	lpool := NewPool(1, nil, WithErrorPolicy(ErrorPolicy{Action: DiscardOnError}))
+	e := NewExecutor(lpool, ExecutorOptions{Pinned: true})
+	defer e.Close()
+
+	run := func(fail bool) *lua.State {
+		vm, _ := e.Submit(context.Background(), func(vm *lua.State) (any, error) {
+			if fail {
+				return vm, errors.New("boom")
+			}
+			return vm, nil
+		}).Wait(context.Background())
+		return vm.(*lua.State)
+	}
+	first := run(false)
+	if vm := run(true); vm != first {
+		t.Fatalf("expected jobs to run on the pinned VM")
+	}
+	if vm := run(false); vm == first {
+		t.Errorf("expected the VM to be discarded after the failed job")
+	}
+}
+
+func TestPinnedExecutorAutoRecycle(t *testing.T) {
+	lpool := NewPool(1, nil, WithAutoRecycle(2))
+	e := NewExecutor(lpool, ExecutorOptions{Pinned: true})
+	defer e.Close()
+
+	run := func(fail bool) *lua.State {
+		vm, _ := e.Submit(context.Background(), func(vm *lua.State) (any, error) {
+			if fail {
+				return vm, errors.New("boom")
+			}
+			return vm, nil
+		}).Wait(context.Background())
+		return vm.(*lua.State)
+	}
+	first := run(true)
+	if vm := run(true); vm != first {
+		t.Fatalf("expected jobs to run on the pinned VM")
+	}
+	if vm := run(false); vm == first {
+		t.Errorf("expected the VM to be replaced after 2 failed jobs")
+	}
+}
+
+func benchmarkExecutor(b *testing.B, pinned bool) {
+	lpool := NewPool(4, nil)
+	e := NewExecutor(lpool, ExecutorOptions{Pinned: pinned})
+	defer e.Close()
+	job := func(vm *lua.State) (any, error) {
+		vm.PushInteger(1)
+		return nil, nil
+	}
+	ctx := context.Background()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := e.Submit(ctx, job).Wait(ctx); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkExecutorAcquire(b *testing.B) {
+	benchmarkExecutor(b, false)
+}
+
+func BenchmarkExecutorPinned(b *testing.B) {
+	benchmarkExecutor(b, true)
+}
@@ -0,0 +1,25 @@
+module github.com/epikur-io/go-lua-pool/fiberpool
+
+go 1.22.3
+
+require (
+	github.com/epikur-io/go-lua v0.0.0-20250224085517-17039441b5fb // indirect
+	github.com/epikur-io/go-lua-pool v0.0.0-00010101000000-000000000000
+	github.com/gofiber/fiber/v2 v2.52.5
+)
+
+require (
+	github.com/andybalholm/brotli v1.0.5 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/klauspost/compress v1.17.0 // indirect
+	github.com/mattn/go-colorable v0.1.13 // indirect
+	github.com/mattn/go-isatty v0.0.20 // indirect
+	github.com/mattn/go-runewidth v0.0.15 // indirect
+	github.com/rivo/uniseg v0.2.0 // indirect
+	github.com/valyala/bytebufferpool v1.0.0 // indirect
+	github.com/valyala/fasthttp v1.51.0 // indirect
+	github.com/valyala/tcplisten v1.0.0 // indirect
+	golang.org/x/sys v0.20.0 // indirect
+)
+
+replace github.com/epikur-io/go-lua-pool => ../
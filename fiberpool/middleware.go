@@ -0,0 +1,30 @@
+// Package fiberpool provides Fiber middleware attaching a pooled Lua VM to
+// every request.
+package fiberpool
+
+import (
+	pool "github.com/epikur-io/go-lua-pool"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Returns middleware acquiring a VM of p for every request, which handlers get
+// by Lease or pool.FromContext(c.UserContext()). The VM is released once the
+// handler returned, even if it panics. The acquire is bound to the user
+// context of the request, requests without a VM fail with 503 Service
+// Unavailable.
+func New(p pool.IPool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		lease, err := pool.NewLease(c.UserContext(), p)
+		if err != nil {
+			return fiber.ErrServiceUnavailable
+		}
+		defer lease.Release()
+		c.SetUserContext(pool.NewContext(c.UserContext(), lease))
+		return c.Next()
+	}
+}
+
+// Returns the lease of the request acquired by the middleware
+func Lease(c *fiber.Ctx) (*pool.Lease, bool) {
+	return pool.FromContext(c.UserContext())
+}
@@ -0,0 +1,52 @@
+package fiberpool
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	pool "github.com/epikur-io/go-lua-pool"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestMiddleware(t *testing.T) {
+	p := pool.NewPool(1, nil)
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		if c.Get("X-Deadline") != "" {
+			ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Millisecond)
+			defer cancel()
+			c.SetUserContext(ctx)
+		}
+		return c.Next()
+	})
+	app.Use(New(p))
+	app.Get("/", func(c *fiber.Ctx) error {
+		if _, ok := Lease(c); !ok {
+			t.Error("expected lease")
+		}
+		return c.SendString("ok")
+	})
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || p.Stats().InUse != 0 {
+		t.Errorf("unexpected response %d or VM not released", resp.StatusCode)
+	}
+
+	vm := p.Acquire()
+	defer p.Release(vm)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Deadline", "1")
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected %d but got %d", http.StatusServiceUnavailable, resp.StatusCode)
+	}
+}
@@ -0,0 +1,61 @@
+package pool
+
+import (
+	"fmt"
+
+	lua "github.com/epikur-io/go-lua"
+	"github.com/epikur-io/go-lua-pool/generic"
+)
+
+// a factory registered by WithFactory
+type flavor struct {
+	name    string
+	weight  int
+	factory func() *lua.State
+}
+
+// Registers a named VM factory, so a single pool can hold a mix of VM flavors,
+// e.g. "full" and "lite", instead of several underutilized pools. Once a
+// factory is registered the factory passed to New is no longer used. Every
+// new VM is created by the flavor furthest below its weighted share of the
+// pool and tagged with its name, so AcquireWithTag selects a flavor (see
+// generic.WithFlavors). A nil factory creates the VMs with NewLuaVM, cloning
+// (see WithCloning) doesn't apply.
+func WithFactory(name string, weight int, factory func() *lua.State) Option {
+	return func(p *Pool) {
+		p.flavors = append(p.flavors, flavor{name: name, weight: weight, factory: factory})
+	}
+}
+
+func (p *Pool) validateFlavors() error {
+	names := make(map[string]bool)
+	for _, f := range p.flavors {
+		switch {
+		case f.weight < 1:
+			return fmt.Errorf("%w: weight %d of factory %q", ErrInvalidOption, f.weight, f.name)
+		case names[f.name]:
+			return fmt.Errorf("%w: duplicate factory %q", ErrInvalidOption, f.name)
+		}
+		names[f.name] = true
+	}
+	return nil
+}
+
+func (p *Pool) genericFlavors() []generic.Flavor[*lua.State] {
+	flavors := make([]generic.Flavor[*lua.State], 0, len(p.flavors))
+	for _, f := range p.flavors {
+		factory := f.factory
+		if factory == nil {
+			factory = NewLuaVM
+		}
+		flavors = append(flavors, generic.Flavor[*lua.State]{
+			Name:   f.name,
+			Weight: f.weight,
+			Factory: func() *lua.State {
+				p.injectSlowCreation()
+				return factory()
+			},
+		})
+	}
+	return flavors
+}
@@ -0,0 +1,49 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+func TestWithFactory(t *testing.T) {
+	flavored := func(name string) func() *lua.State {
+		return func() *lua.State {
+			vm := NewLuaVM()
+			lua.DoString(vm, "flavor = '"+name+"'")
+			return vm
+		}
+	}
+	lpool, err := New(4, nil, WithFactory("full", 3, flavored("full")), WithFactory("lite", 1, flavored("lite")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for _, name := range []string{"lite", "full"} {
+		vm, err := lpool.AcquireWithTag(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		vm.Global("flavor")
+		if s, _ := vm.ToString(-1); s != name {
+			t.Errorf("expected a %s VM but got %q", name, s)
+		}
+		vm.Pop(1)
+		lpool.Release(vm)
+	}
+
+	// only one lite VM
+	vm, _ := lpool.AcquireWithTag(ctx, "lite")
+	if _, err := lpool.AcquireWithTag(ctx, "lite"); !errors.Is(err, ErrNoTaggedVM) {
+		t.Errorf("expected %v but got %v", ErrNoTaggedVM, err)
+	}
+	lpool.Release(vm)
+
+	for _, opt := range []Option{WithFactory("lite", 0, nil), WithFactory("", 1, nil)} {
+		if _, err := New(1, nil, WithFactory("", 1, nil), opt); !errors.Is(err, ErrInvalidOption) {
+			t.Errorf("expected %v but got %v", ErrInvalidOption, err)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package pool
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+// What happens when a VM is returned to the pool, see WithGCOnRelease
+type GCMode int
+
+const (
+	// no collection (default)
+	GCNone GCMode = iota
+	// starts a collection in the background unless one is running already
+	GCStep
+	// collects before the VM is returned to the pool
+	GCFull
+)
+
+func (m GCMode) String() string {
+	switch m {
+	case GCNone:
+		return "none"
+	case GCStep:
+		return "step"
+	case GCFull:
+		return "full"
+	default:
+		return "unknown"
+	}
+}
+
+// Runs the garbage collector when a VM is released, trading release latency
+// (GCFull) or background CPU time (GCStep) for lower steady-state memory.
+// go-lua VMs live on the Go heap, so every collection is a runtime.GC of the
+// whole process.
+func WithGCOnRelease(mode GCMode) Option {
+	return func(p *Pool) {
+		p.gcMode = mode
+	}
+}
+
+// process wide, collections of all pools are coalesced
+var gcRunning atomic.Bool
+
+func (p *Pool) collectGarbage() {
+	switch p.gcMode {
+	case GCStep:
+		if gcRunning.CompareAndSwap(false, true) {
+			go func() {
+				defer gcRunning.Store(false)
+				runtime.GC()
+			}()
+		}
+	case GCFull:
+		runtime.GC()
+	}
+}
@@ -0,0 +1,33 @@
+package pool
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+func numGC() uint32 {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.NumGC
+}
+
+func TestGCOnRelease(t *testing.T) {
+	lpool := NewPool(1, nil, WithGCOnRelease(GCFull))
+	before := numGC()
+	lpool.Release(lpool.Acquire())
+	if numGC() == before {
+		t.Errorf("expected a collection on release")
+	}
+
+	lpool = NewPool(1, nil, WithGCOnRelease(GCStep))
+	before = numGC()
+	lpool.Release(lpool.Acquire())
+	deadline := time.Now().Add(time.Second)
+	for numGC() == before {
+		if time.Now().After(deadline) {
+			t.Fatal("expected a background collection after release")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
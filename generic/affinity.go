@@ -0,0 +1,80 @@
+package generic
+
+import (
+	"context"
+	"slices"
+)
+
+// How many session keys a state remembers by default, see WithAffinityKeys
+const DefaultAffinityKeys = 64
+
+// Sets how many session keys of AcquireFor a state remembers, the least
+// recently used key is forgotten first. Bounds the bookkeeping to n keys per
+// state.
+func WithAffinityKeys[T comparable](n int) Option[T] {
+	return func(p *Pool[T]) {
+		p.affinityKeys = n
+	}
+}
+
+// Acquires the state last acquired for key if it is idle and any state
+// otherwise, so state built up for a session, like caches, is reused. Only the
+// SemaphoreBackend picks the previous state, the other backends hand out any
+// state.
+func (p *Pool[T]) AcquireFor(ctx context.Context, key string) (T, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	p.statesMux.Lock()
+	prev, ok := p.affinity[key]
+	p.statesMux.Unlock()
+	mb, matching := p.backend.(matchingBackend[T])
+	if !ok || !matching {
+		v, err := p.AcquireWithContext(ctx)
+		if err == nil {
+			p.remember(key, v)
+		}
+		return v, err
+	}
+	if p.closed.Load() {
+		var zero T
+		return zero, ErrPoolClosed
+	}
+	v, err := mb.getMatching(ctx, func(v T) bool { return v == prev })
+	if err != nil {
+		return v, err
+	}
+	if v, err = p.checkOut(v); err != nil {
+		return v, err
+	}
+	p.inUse.Add(1)
+	p.remember(key, v)
+	return v, nil
+}
+
+// makes v the state of key
+func (p *Pool[T]) remember(key string, v T) {
+	p.statesMux.Lock()
+	defer p.statesMux.Unlock()
+	if _, ok := p.states[v]; !ok {
+		return
+	}
+	if prev, ok := p.affinity[key]; ok {
+		p.affinityByState[prev] = slices.DeleteFunc(p.affinityByState[prev], func(k string) bool { return k == key })
+	}
+	keys := append(p.affinityByState[v], key)
+	if len(keys) > p.affinityKeys {
+		delete(p.affinity, keys[0])
+		keys = slices.Delete(keys, 0, 1)
+	}
+	p.affinity[key] = v
+	p.affinityByState[v] = keys
+}
+
+// drops the keys of a removed state, requires statesMux
+func (p *Pool[T]) forgetKeys(v T) {
+	for _, key := range p.affinityByState[v] {
+		delete(p.affinity, key)
+	}
+	delete(p.affinityByState, v)
+}
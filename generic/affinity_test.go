@@ -0,0 +1,53 @@
+package generic
+
+import (
+	"context"
+	"testing"
+)
+
+func TestAcquireFor(t *testing.T) {
+	f := &factory{}
+	p := New(3, f.new, WithCloser(Close[*state]), WithAffinityKeys[*state](2))
+	ctx := context.Background()
+	a, _ := p.AcquireFor(ctx, "alice")
+	p.Release(a)
+	// FIFO would hand out another state
+	if s, _ := p.AcquireFor(ctx, "alice"); s != a {
+		t.Errorf("expected the state of alice")
+	} else {
+		p.Release(s)
+	}
+
+	// busy, another state is taken and becomes the one of alice
+	held, _ := p.AcquireFor(ctx, "alice")
+	b, _ := p.AcquireFor(ctx, "alice")
+	if held != a || b == a {
+		t.Fatal("expected the state of alice and another one")
+	}
+	p.Release(held)
+	p.Release(b)
+	if s, _ := p.AcquireFor(ctx, "alice"); s != b {
+		t.Errorf("expected the last state of alice")
+	} else {
+		p.Release(s)
+	}
+
+	// keys beyond the limit and of destroyed states are forgotten
+	for _, key := range []string{"bob", "carol"} {
+		s, _ := p.AcquireFor(ctx, key)
+		p.Release(s)
+	}
+	p.statesMux.Lock()
+	n := len(p.affinity)
+	p.statesMux.Unlock()
+	if n > 3*2 {
+		t.Errorf("expected at most 6 keys but got %d", n)
+	}
+	p.Update()
+	p.statesMux.Lock()
+	n = len(p.affinity)
+	p.statesMux.Unlock()
+	if n != 0 {
+		t.Errorf("expected the keys to be dropped with their states but got %d", n)
+	}
+}
@@ -0,0 +1,580 @@
+package generic
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Storage of the idle states of a pool, see WithBackend
+type Backend int
+
+const (
+	// semaphore plus a list of the idle states (default). Waiting acquirers are
+	// served in the order they arrived.
+	SemaphoreBackend Backend = iota
+	// sync.Pool holding the idle states plus a semaphore limiting the number of
+	// acquired states. Acquiring is cheaper and idle states are dropped by the
+	// garbage collector when they aren't needed, but dropped states are never
+	// passed to the Closer. Len and Stats report free slots instead of idle
+	// states and EachIdle only visits some of the idle states.
+	SyncPoolBackend
+)
+
+func (b Backend) String() string {
+	switch b {
+	case SemaphoreBackend:
+		return "semaphore"
+	case SyncPoolBackend:
+		return "sync.Pool"
+	default:
+		return "unknown"
+	}
+}
+
+// Selects how idle states are stored, see Backend
+func WithBackend[T comparable](backend Backend) Option[T] {
+	return func(p *Pool[T]) {
+		p.backendType = backend
+	}
+}
+
+// a slot is the right to hold a state, a pool of size n hands out n slots
+type backend[T comparable] interface {
+	// waits for a free slot, returns an idle state or the zero value if a new
+	// state has to be created for the slot
+	get(ctx context.Context) (T, error)
+	// returns v and its slot, fails with ErrFailedToRelease instead of
+	// blocking if ctx is nil
+	put(ctx context.Context, v T) error
+	// moves idle states in and out without changing the slots in use, for
+	// maintenance like RollingUpdate
+	takeIdle() (T, bool)
+	putIdle(v T)
+	// free slots
+	len() int
+	cap() int
+	// acquirers waiting for a slot
+	waiting() int
+	// makes waiting and later calls of get fail with ErrPoolClosed, channels
+	// are never closed so late puts don't panic
+	close()
+}
+
+// implemented by backends which can pick a specific idle state, see
+// AcquireWithTag
+type matchingBackend[T comparable] interface {
+	// takes an idle state matching match if one is available and nobody
+	// waits, otherwise like get
+	getMatching(ctx context.Context, match func(T) bool) (T, error)
+}
+
+// implemented by backends supporting AcquireWeighted
+type weightedBackend[T comparable] interface {
+	getWeighted(ctx context.Context, weight int) (T, error)
+	putWeighted(ctx context.Context, v T, weight int) error
+}
+
+// Order in which idle states are handed out, see WithOrder
+type Order int
+
+const (
+	// least recently used state first (default)
+	FIFO Order = iota
+	// most recently used state first, keeps the working set of states small
+	// and warm under low load
+	LIFO
+)
+
+func (o Order) String() string {
+	switch o {
+	case FIFO:
+		return "FIFO"
+	case LIFO:
+		return "LIFO"
+	default:
+		return "unknown"
+	}
+}
+
+// Sets the order in which idle states are handed out. Ignored by the
+// SyncPoolBackend, LIFO takes precedence over WithShards.
+func WithOrder[T comparable](order Order) Option[T] {
+	return func(p *Pool[T]) {
+		p.order = order
+	}
+}
+
+// Splits the idle states of the SemaphoreBackend into n channels to reduce
+// contention when many goroutines acquire and release concurrently. Every
+// acquire and release picks a random shard first. Ignored by the
+// SyncPoolBackend, sync.Pool is sharded per P already.
+func WithShards[T comparable](n int) Option[T] {
+	return func(p *Pool[T]) {
+		p.shards = n
+	}
+}
+
+// The backends start without free slots, the pool is filled by put
+func newBackend[T comparable](b Backend, size int, shards int, order Order) backend[T] {
+	switch {
+	case b == SyncPoolBackend:
+		return &syncPoolBackend[T]{sem: fullSemaphore(size), done: make(chan struct{})}
+	case shards > 1 && order == FIFO:
+		return newShardedBackend[T](size, shards)
+	default:
+		return newListBackend[T](size, order)
+	}
+}
+
+// sem holds a token for every slot in use
+type syncPoolBackend[T comparable] struct {
+	sem     chan struct{}
+	idle    sync.Pool
+	blocked atomic.Int64
+	done    chan struct{}
+	once    sync.Once
+}
+
+func (b *syncPoolBackend[T]) get(ctx context.Context) (T, error) {
+	var zero T
+	select {
+	case b.sem <- struct{}{}:
+	default:
+		b.blocked.Add(1)
+		defer b.blocked.Add(-1)
+		select {
+		case b.sem <- struct{}{}:
+		case <-ctx.Done():
+			return zero, ctx.Err()
+		case <-b.done:
+			return zero, ErrPoolClosed
+		}
+	}
+	if v, ok := b.takeIdle(); ok {
+		return v, nil
+	}
+	return zero, nil
+}
+
+func (b *syncPoolBackend[T]) put(ctx context.Context, v T) error {
+	if ctx == nil {
+		select {
+		case <-b.sem:
+		default:
+			return ErrFailedToRelease
+		}
+	} else {
+		select {
+		case <-b.sem:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	b.idle.Put(v)
+	return nil
+}
+
+func (b *syncPoolBackend[T]) takeIdle() (T, bool) {
+	v, ok := b.idle.Get().(T)
+	return v, ok
+}
+
+func (b *syncPoolBackend[T]) putIdle(v T) {
+	b.idle.Put(v)
+}
+
+func (b *syncPoolBackend[T]) len() int {
+	return cap(b.sem) - len(b.sem)
+}
+
+func (b *syncPoolBackend[T]) cap() int {
+	return cap(b.sem)
+}
+
+func (b *syncPoolBackend[T]) waiting() int {
+	return int(b.blocked.Load())
+}
+
+func (b *syncPoolBackend[T]) close() {
+	b.once.Do(func() { close(b.done) })
+}
+
+// channel backend split into shards, a shard can hold all states so a put never
+// blocks on a full shard
+type shardedBackend[T comparable] struct {
+	shards []chan T
+	// states released while acquirers are waiting, waiters can't watch all
+	// shards at once
+	handoff chan T
+	waiters atomic.Int64
+	// idle states, may be ahead of the channels while a state is moved in or
+	// out
+	idle atomic.Int64
+	size int
+	done chan struct{}
+	once sync.Once
+}
+
+// how often a release into a full pool checks for room again
+const fullPollInterval = time.Millisecond
+
+func newShardedBackend[T comparable](size int, n int) *shardedBackend[T] {
+	b := &shardedBackend[T]{
+		shards:  make([]chan T, n),
+		handoff: make(chan T, size),
+		size:    size,
+		done:    make(chan struct{}),
+	}
+	for i := range b.shards {
+		b.shards[i] = make(chan T, size)
+	}
+	return b
+}
+
+func (b *shardedBackend[T]) get(ctx context.Context) (T, error) {
+	if v, ok := b.takeIdle(); ok {
+		return v, nil
+	}
+	b.waiters.Add(1)
+	defer b.waiters.Add(-1)
+	// states released before waiting was incremented went to the shards
+	if v, ok := b.takeIdle(); ok {
+		return v, nil
+	}
+	select {
+	case v := <-b.handoff:
+		b.idle.Add(-1)
+		return v, nil
+	case v := <-b.shards[rand.IntN(len(b.shards))]:
+		b.idle.Add(-1)
+		return v, nil
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	case <-b.done:
+		var zero T
+		return zero, ErrPoolClosed
+	}
+}
+
+func (b *shardedBackend[T]) put(ctx context.Context, v T) error {
+	for !b.reserve() {
+		// the pool is full, only happens if more states are released than
+		// were acquired
+		if ctx == nil {
+			return ErrFailedToRelease
+		}
+		select {
+		case <-time.After(fullPollInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	b.send(v)
+	return nil
+}
+
+// reserves room for an idle state
+func (b *shardedBackend[T]) reserve() bool {
+	if b.idle.Add(1) > int64(b.size) {
+		b.idle.Add(-1)
+		return false
+	}
+	return true
+}
+
+func (b *shardedBackend[T]) send(v T) {
+	if b.waiters.Load() > 0 {
+		b.handoff <- v
+		return
+	}
+	shard := b.shards[rand.IntN(len(b.shards))]
+	shard <- v
+	if b.waiters.Load() > 0 {
+		// an acquirer started waiting meanwhile and may have missed v when
+		// checking the shards
+		select {
+		case v := <-shard:
+			b.handoff <- v
+		default:
+		}
+	}
+}
+
+func (b *shardedBackend[T]) takeIdle() (T, bool) {
+	select {
+	case v := <-b.handoff:
+		b.idle.Add(-1)
+		return v, true
+	default:
+	}
+	start := rand.IntN(len(b.shards))
+	for i := range b.shards {
+		select {
+		case v := <-b.shards[(start+i)%len(b.shards)]:
+			b.idle.Add(-1)
+			return v, true
+		default:
+		}
+	}
+	var zero T
+	return zero, false
+}
+
+func (b *shardedBackend[T]) putIdle(v T) {
+	b.idle.Add(1)
+	b.send(v)
+}
+
+func (b *shardedBackend[T]) len() int {
+	return int(b.idle.Load())
+}
+
+func (b *shardedBackend[T]) cap() int {
+	return b.size
+}
+
+func (b *shardedBackend[T]) waiting() int {
+	return int(b.waiters.Load())
+}
+
+func (b *shardedBackend[T]) close() {
+	b.once.Do(func() { close(b.done) })
+}
+
+func fullSemaphore(size int) chan struct{} {
+	sem := make(chan struct{}, size)
+	for range size {
+		sem <- struct{}{}
+	}
+	return sem
+}
+
+// semaphore plus a list of the idle states guarded by one mutex. Released
+// states are handed to waiting acquirers directly, in the order they started
+// waiting.
+type listBackend[T comparable] struct {
+	order Order
+	size  int
+
+	mux    sync.Mutex
+	closed bool
+	// slots in use, starts at size until the pool is filled
+	inUse   int
+	waiters []*waiter[T]
+	// ring buffer, idle[head] is the least recently released state
+	idle []T
+	head int
+	n    int
+}
+
+type waiter[T comparable] struct {
+	// slots requested
+	weight int
+	// closed once the slots are granted
+	ready chan struct{}
+	// idle state handed over with the slot, zero if there was none
+	v T
+	// set instead if the pool was closed
+	err error
+}
+
+func newListBackend[T comparable](size int, order Order) *listBackend[T] {
+	return &listBackend[T]{
+		order: order,
+		size:  size,
+		inUse: size,
+		idle:  make([]T, size),
+	}
+}
+
+func (b *listBackend[T]) get(ctx context.Context) (T, error) {
+	return b.getWeighted(ctx, 1)
+}
+
+// takes weight slots but returns a single state, the idle states of the other
+// slots stay in the list. As a state is only released into the list with its
+// slots there is always an idle state for granted slots.
+func (b *listBackend[T]) getWeighted(ctx context.Context, weight int) (T, error) {
+	b.mux.Lock()
+	if b.closed {
+		b.mux.Unlock()
+		var zero T
+		return zero, ErrPoolClosed
+	}
+	if b.inUse+weight <= b.size && len(b.waiters) == 0 {
+		b.inUse += weight
+		v, _ := b.pop()
+		b.mux.Unlock()
+		return v, nil
+	}
+	w := &waiter[T]{weight: weight, ready: make(chan struct{})}
+	b.waiters = append(b.waiters, w)
+	b.mux.Unlock()
+
+	select {
+	case <-w.ready:
+		return w.v, w.err
+	case <-ctx.Done():
+	}
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	select {
+	case <-w.ready:
+		// granted meanwhile
+		return w.v, w.err
+	default:
+	}
+	for i, other := range b.waiters {
+		if other == w {
+			b.waiters = append(b.waiters[:i], b.waiters[i+1:]...)
+			break
+		}
+	}
+	// waiters behind a heavy one may fit now
+	b.grant()
+	var zero T
+	return zero, ctx.Err()
+}
+
+func (b *listBackend[T]) put(ctx context.Context, v T) error {
+	return b.putWeighted(ctx, v, 1)
+}
+
+func (b *listBackend[T]) putWeighted(ctx context.Context, v T, weight int) error {
+	for !b.tryPut(v, weight) {
+		// all slots are free, only happens if more states are released than
+		// were acquired
+		if ctx == nil {
+			return ErrFailedToRelease
+		}
+		select {
+		case <-time.After(fullPollInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (b *listBackend[T]) tryPut(v T, weight int) bool {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if b.inUse < weight {
+		return false
+	}
+	b.push(v)
+	b.inUse -= weight
+	b.grant()
+	return true
+}
+
+// hands free slots to waiters in order, a waiter whose weight doesn't fit
+// blocks the ones behind it so heavy acquirers don't starve. Requires b.mux.
+func (b *listBackend[T]) grant() {
+	for len(b.waiters) > 0 && b.inUse+b.waiters[0].weight <= b.size {
+		w := b.waiters[0]
+		b.waiters[0] = nil
+		b.waiters = b.waiters[1:]
+		b.inUse += w.weight
+		w.v, _ = b.pop()
+		close(w.ready)
+	}
+}
+
+func (b *listBackend[T]) takeIdle() (T, bool) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if b.n == 0 {
+		var zero T
+		return zero, false
+	}
+	b.inUse++
+	return b.pop()
+}
+
+func (b *listBackend[T]) putIdle(v T) {
+	b.tryPut(v, 1)
+}
+
+// requires b.mux
+func (b *listBackend[T]) push(v T) {
+	b.idle[(b.head+b.n)%len(b.idle)] = v
+	b.n++
+}
+
+func (b *listBackend[T]) getMatching(ctx context.Context, match func(T) bool) (T, error) {
+	b.mux.Lock()
+	if !b.closed && len(b.waiters) == 0 {
+		for i := range b.n {
+			if v := b.idle[(b.head+i)%len(b.idle)]; match(v) {
+				b.removeAt(i)
+				b.inUse++
+				b.mux.Unlock()
+				return v, nil
+			}
+		}
+	}
+	b.mux.Unlock()
+	return b.get(ctx)
+}
+
+// removes the i-th idle state counted from head, requires b.mux
+func (b *listBackend[T]) removeAt(i int) {
+	var zero T
+	for ; i < b.n-1; i++ {
+		b.idle[(b.head+i)%len(b.idle)] = b.idle[(b.head+i+1)%len(b.idle)]
+	}
+	b.idle[(b.head+b.n-1)%len(b.idle)] = zero
+	b.n--
+}
+
+// requires b.mux
+func (b *listBackend[T]) pop() (T, bool) {
+	var zero T
+	if b.n == 0 {
+		return zero, false
+	}
+	var i int
+	if b.order == LIFO {
+		i = (b.head + b.n - 1) % len(b.idle)
+	} else {
+		i = b.head
+		b.head = (b.head + 1) % len(b.idle)
+	}
+	v := b.idle[i]
+	// don't keep states alive which are gone from the pool
+	b.idle[i] = zero
+	b.n--
+	return v, true
+}
+
+func (b *listBackend[T]) len() int {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return b.size - b.inUse
+}
+
+func (b *listBackend[T]) cap() int {
+	return b.size
+}
+
+func (b *listBackend[T]) waiting() int {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return len(b.waiters)
+}
+
+func (b *listBackend[T]) close() {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	b.closed = true
+	for _, w := range b.waiters {
+		w.err = ErrPoolClosed
+		close(w.ready)
+	}
+	b.waiters = nil
+}
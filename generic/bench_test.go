@@ -0,0 +1,115 @@
+package generic
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+)
+
+type benchBackend struct {
+	name string
+	opts []Option[*state]
+}
+
+// backends compared by the benchmarks, in a fixed order for benchstat
+func benchBackends() []benchBackend {
+	return []benchBackend{
+		{"semaphore", nil},
+		{"lifo", []Option[*state]{WithOrder[*state](LIFO)}},
+		{"sync.Pool", []Option[*state]{WithBackend[*state](SyncPoolBackend)}},
+		{"sharded", []Option[*state]{WithShards[*state](runtime.GOMAXPROCS(0))}},
+	}
+}
+
+var benchSizes = []int{1, 8, 64}
+
+// latency of an uncontended acquire and release
+func BenchmarkAcquireReleaseSerial(b *testing.B) {
+	for _, bb := range benchBackends() {
+		for _, size := range benchSizes {
+			b.Run(fmt.Sprintf("%s/size=%d", bb.name, size), func(b *testing.B) {
+				f := &factory{}
+				p := New(size, f.new, bb.opts...)
+				b.ReportAllocs()
+				b.ResetTimer()
+				for range b.N {
+					p.Release(p.Acquire())
+				}
+			})
+		}
+	}
+}
+
+// throughput with one goroutine per P, acquirers wait if the pool is smaller
+func BenchmarkAcquireRelease(b *testing.B) {
+	for _, bb := range benchBackends() {
+		for _, size := range benchSizes {
+			b.Run(fmt.Sprintf("%s/size=%d", bb.name, size), func(b *testing.B) {
+				f := &factory{}
+				p := New(size, f.new, bb.opts...)
+				b.ReportAllocs()
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					for pb.Next() {
+						p.Release(p.Acquire())
+					}
+				})
+			})
+		}
+	}
+}
+
+// throughput with 16 goroutines per P competing for a small pool, measures the
+// cost of waiting and handing over states
+func BenchmarkAcquireReleaseContended(b *testing.B) {
+	for _, bb := range benchBackends() {
+		b.Run(bb.name, func(b *testing.B) {
+			f := &factory{}
+			p := New(2, f.new, bb.opts...)
+			b.ReportAllocs()
+			b.SetParallelism(16)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					p.Release(p.Acquire())
+				}
+			})
+		})
+	}
+}
+
+// overhead of the context and timeout variants
+func BenchmarkAcquireVariants(b *testing.B) {
+	f := &factory{}
+	p := New(8, f.new)
+	ctx := context.Background()
+	b.Run("Acquire", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			p.Release(p.Acquire())
+		}
+	})
+	b.Run("AcquireWithContext", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			v, _ := p.AcquireWithContext(ctx)
+			p.Release(v)
+		}
+	})
+	b.Run("AcquireWithTimeout", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			v, _ := p.AcquireWithTimeout(time.Second)
+			p.Release(v)
+		}
+	})
+	b.Run("AcquireWeighted", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			v, _ := p.AcquireWeighted(ctx, 2)
+			p.Release(v)
+		}
+	})
+}
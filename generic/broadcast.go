@@ -0,0 +1,145 @@
+package generic
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var ErrStateRemoved = fmt.Errorf("state removed from the pool")
+
+// Outcome of RunOnAll for a single state
+type RunResult struct {
+	// see Info
+	ID  uint64
+	Err error
+}
+
+// a pending RunOnAll call
+type broadcast[T comparable] struct {
+	fn      func(T) error
+	mux     sync.Mutex
+	results []RunResult
+	pending int
+	done    chan struct{}
+}
+
+func (b *broadcast[T]) report(id uint64, err error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if b.pending == 0 {
+		// RunOnAll returned already
+		return
+	}
+	b.results = append(b.results, RunResult{ID: id, Err: err})
+	b.pending--
+	if b.pending == 0 {
+		close(b.done)
+	}
+}
+
+// Calls fn with every state of the pool, right away for idle states and on
+// release for acquired ones, e.g. to push configuration into all states
+// without replacing them. States created later, e.g. replacements, are not
+// covered. Waits until fn ran for every state or ctx is done, states fn didn't
+// run for by then report the error of ctx, states removed from the pool before
+// ErrStateRemoved, states fn is still running for are left out. Returns the
+// results ordered by ID. Waits forever if the caller holds a state and ctx
+// never ends.
+func (p *Pool[T]) RunOnAll(ctx context.Context, fn func(T) error) []RunResult {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	b := &broadcast[T]{fn: fn, done: make(chan struct{})}
+	p.statesMux.Lock()
+	for v := range p.states {
+		if _, ok := p.lost[v]; ok {
+			continue
+		}
+		p.runs[v] = append(p.runs[v], b)
+		b.pending++
+	}
+	p.pendingRuns.Add(int64(b.pending))
+	p.statesMux.Unlock()
+	if b.pending == 0 {
+		return nil
+	}
+
+	p.EachIdle(p.runPending)
+	select {
+	case <-b.done:
+	case <-ctx.Done():
+		p.cancelRuns(b, ctx.Err())
+	}
+	b.mux.Lock()
+	results := b.results
+	// results of runs still in progress are dropped
+	b.pending = 0
+	b.mux.Unlock()
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].ID < results[j].ID
+	})
+	return results
+}
+
+// runs the functions of RunOnAll pending for v
+func (p *Pool[T]) runPending(v T) {
+	if p.pendingRuns.Load() <= 0 {
+		return
+	}
+	p.statesMux.Lock()
+	runs := p.runs[v]
+	delete(p.runs, v)
+	p.pendingRuns.Add(-int64(len(runs)))
+	var id uint64
+	if info := p.states[v]; info != nil {
+		id = info.ID
+	}
+	p.statesMux.Unlock()
+	for _, b := range runs {
+		b.report(id, b.fn(v))
+	}
+}
+
+// reports ErrStateRemoved for the runs pending for v, requires statesMux
+func (p *Pool[T]) dropRuns(v T, id uint64) {
+	runs, ok := p.runs[v]
+	if !ok {
+		return
+	}
+	delete(p.runs, v)
+	p.pendingRuns.Add(-int64(len(runs)))
+	for _, b := range runs {
+		b.report(id, ErrStateRemoved)
+	}
+}
+
+// reports err for the states b didn't run for yet
+func (p *Pool[T]) cancelRuns(b *broadcast[T], err error) {
+	p.statesMux.Lock()
+	defer p.statesMux.Unlock()
+	for v, runs := range p.runs {
+		i := -1
+		for j, r := range runs {
+			if r == b {
+				i = j
+				break
+			}
+		}
+		if i < 0 {
+			continue
+		}
+		if len(runs) == 1 {
+			delete(p.runs, v)
+		} else {
+			p.runs[v] = append(runs[:i:i], runs[i+1:]...)
+		}
+		p.pendingRuns.Add(-1)
+		var id uint64
+		if info := p.states[v]; info != nil {
+			id = info.ID
+		}
+		b.report(id, err)
+	}
+}
@@ -0,0 +1,78 @@
+package generic
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRunOnAll(t *testing.T) {
+	f := &factory{}
+	p := New(3, f.new)
+	held := p.Acquire()
+	done := make(chan []RunResult)
+	go func() {
+		done <- p.RunOnAll(context.Background(), func(s *state) error {
+			s.uses++
+			return nil
+		})
+	}()
+	// the idle states run right away, the held one when it is released
+	for p.pendingRuns.Load() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	p.Release(held)
+	results := <-done
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results but got %v", results)
+	}
+	for i, r := range results {
+		if r.Err != nil || (i > 0 && r.ID <= results[i-1].ID) {
+			t.Errorf("unexpected results %v", results)
+		}
+	}
+	for _, s := range f.created {
+		if s.uses != 1 {
+			t.Errorf("expected a single run for state %d but got %d", s.id, s.uses)
+		}
+	}
+}
+
+func TestRunOnAllCanceled(t *testing.T) {
+	f := &factory{}
+	p := New(2, f.new)
+	held := p.Acquire()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	results := p.RunOnAll(ctx, func(*state) error { return nil })
+	failed := 0
+	for _, r := range results {
+		if errors.Is(r.Err, context.DeadlineExceeded) {
+			failed++
+		}
+	}
+	if len(results) != 2 || failed != 1 {
+		t.Errorf("expected the held state to time out but got %v", results)
+	}
+	// nothing left to run on release
+	p.Release(held)
+	if held.uses != 0 || p.pendingRuns.Load() != 0 {
+		t.Errorf("expected the canceled run to be dropped")
+	}
+
+	// removed before it was released
+	held = p.Acquire()
+	done := make(chan []RunResult)
+	go func() {
+		done <- p.RunOnAll(context.Background(), func(*state) error { return nil })
+	}()
+	for p.pendingRuns.Load() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	p.Discard(held)
+	results = <-done
+	if len(results) != 2 || !(errors.Is(results[0].Err, ErrStateRemoved) || errors.Is(results[1].Err, ErrStateRemoved)) {
+		t.Errorf("expected %v but got %v", ErrStateRemoved, results)
+	}
+}
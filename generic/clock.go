@@ -0,0 +1,85 @@
+package generic
+
+import (
+	"context"
+	"time"
+)
+
+// Source of time for timeouts and timestamps, replaceable in tests to advance
+// time synthetically (see WithClock and pooltest.FakeClock)
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer of a Clock, see time.Timer
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+}
+
+// Clock backed by the time package (default)
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return systemTimer{time.NewTimer(d)}
+}
+
+type systemTimer struct {
+	t *time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time {
+	return t.t.C
+}
+
+func (t systemTimer) Stop() bool {
+	return t.t.Stop()
+}
+
+// Sets the clock used for timeouts and the creation time of states
+func WithClock[T comparable](clock Clock) Option[T] {
+	return func(p *Pool[T]) {
+		if clock != nil {
+			p.clock = clock
+		}
+	}
+}
+
+// Like context.WithTimeout but the deadline is measured by clock. Contexts of
+// other clocks than SystemClock report no deadline, as it would be compared to
+// the system time, but fail with context.DeadlineExceeded once it passed.
+func ContextWithTimeout(ctx context.Context, clock Clock, d time.Duration) (context.Context, context.CancelFunc) {
+	if clock == nil || clock == SystemClock {
+		return context.WithTimeout(ctx, d)
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	t := clock.NewTimer(d)
+	go func() {
+		select {
+		case <-t.C():
+			cancel(context.DeadlineExceeded)
+		case <-ctx.Done():
+			t.Stop()
+		}
+	}()
+	return clockContext{ctx}, func() { cancel(context.Canceled) }
+}
+
+type clockContext struct {
+	context.Context
+}
+
+func (c clockContext) Err() error {
+	err := c.Context.Err()
+	if err != nil && context.Cause(c.Context) == context.DeadlineExceeded {
+		return context.DeadlineExceeded
+	}
+	return err
+}
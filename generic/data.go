@@ -0,0 +1,34 @@
+package generic
+
+// Attaches a Go value to a state under key, e.g. a cache or tenant info. The
+// values are dropped together with the state. Returns false if v isn't a
+// state of the pool.
+func (p *Pool[T]) SetData(v T, key, value any) bool {
+	p.statesMux.Lock()
+	defer p.statesMux.Unlock()
+	if _, ok := p.states[v]; !ok {
+		return false
+	}
+	m := p.data[v]
+	if m == nil {
+		m = make(map[any]any)
+		p.data[v] = m
+	}
+	m[key] = value
+	return true
+}
+
+// Returns the value attached to a state under key, see SetData
+func (p *Pool[T]) Data(v T, key any) (any, bool) {
+	p.statesMux.Lock()
+	defer p.statesMux.Unlock()
+	value, ok := p.data[v][key]
+	return value, ok
+}
+
+// Removes the value attached to a state under key
+func (p *Pool[T]) DeleteData(v T, key any) {
+	p.statesMux.Lock()
+	defer p.statesMux.Unlock()
+	delete(p.data[v], key)
+}
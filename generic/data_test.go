@@ -0,0 +1,34 @@
+package generic
+
+import (
+	"testing"
+)
+
+func TestData(t *testing.T) {
+	f := &factory{}
+	p := New(1, f.new, WithCloser(Close[*state]))
+	s := p.Acquire()
+	if p.SetData(&state{}, "tenant", "acme") {
+		t.Errorf("expected foreign states to be rejected")
+	}
+	if !p.SetData(s, "tenant", "acme") {
+		t.Fatal("failed to attach data")
+	}
+	if v, ok := p.Data(s, "tenant"); !ok || v != "acme" {
+		t.Errorf("expected acme but got %v", v)
+	}
+	p.DeleteData(s, "tenant")
+	if _, ok := p.Data(s, "tenant"); ok {
+		t.Errorf("expected the data to be deleted")
+	}
+
+	// dropped with the state
+	p.SetData(s, "tenant", "acme")
+	p.Destroy(s)
+	p.statesMux.Lock()
+	n := len(p.data)
+	p.statesMux.Unlock()
+	if n != 0 {
+		t.Errorf("expected the data of destroyed states to be dropped")
+	}
+}
@@ -0,0 +1,50 @@
+package generic
+
+import (
+	"slices"
+)
+
+// A kind of state of a heterogeneous pool, see WithFlavors
+type Flavor[T any] struct {
+	// tag of the states created by Factory
+	Name string
+	// share of the states relative to the other flavors
+	Weight  int
+	Factory Factory[T]
+}
+
+// Creates the states with the factories of several flavors instead of the
+// factory of the pool, so a single pool can hold e.g. "full" and "lite" states.
+// Every new state is created by the flavor furthest below its share of the
+// live states and tagged with its name, AcquireWithTag selects a flavor.
+// Flavors with a weight below 1 are ignored.
+func WithFlavors[T comparable](flavors ...Flavor[T]) Option[T] {
+	return func(p *Pool[T]) {
+		p.flavors = slices.DeleteFunc(slices.Clone(flavors), func(f Flavor[T]) bool {
+			return f.Weight < 1 || f.Factory == nil
+		})
+	}
+}
+
+// picks the flavor of the next state
+func (p *Pool[T]) nextFlavor() Flavor[T] {
+	counts := make([]int, len(p.flavors))
+	p.statesMux.Lock()
+	for _, info := range p.states {
+		for i, f := range p.flavors {
+			if slices.Contains(info.Tags, f.Name) {
+				counts[i]++
+				break
+			}
+		}
+	}
+	p.statesMux.Unlock()
+	// lowest count per weight, compared by cross-multiplying
+	best := 0
+	for i, f := range p.flavors {
+		if counts[i]*p.flavors[best].Weight < counts[best]*f.Weight {
+			best = i
+		}
+	}
+	return p.flavors[best]
+}
@@ -0,0 +1,32 @@
+package generic
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestFlavors(t *testing.T) {
+	full, lite := &factory{}, &factory{}
+	p := New(4, nil, WithFlavors(
+		Flavor[*state]{Name: "full", Weight: 3, Factory: full.new},
+		Flavor[*state]{Name: "lite", Weight: 1, Factory: lite.new},
+		Flavor[*state]{Name: "unused", Factory: lite.new},
+	))
+	if len(full.created) != 3 || len(lite.created) != 1 {
+		t.Fatalf("expected 3 full and 1 lite states but got %d and %d", len(full.created), len(lite.created))
+	}
+	s, err := p.AcquireWithTag(context.Background(), "lite")
+	if err != nil || s != lite.created[0] {
+		t.Fatalf("expected the lite state but got %v", err)
+	}
+	// the replacement keeps the mix
+	p.Discard(s)
+	for p.Len() != 4 {
+		time.Sleep(time.Millisecond)
+	}
+	s, err = p.AcquireWithTag(context.Background(), "lite")
+	if err != nil || len(lite.created) != 2 || s != lite.created[1] {
+		t.Errorf("expected a lite replacement but got %v", err)
+	}
+}
@@ -0,0 +1,985 @@
+// Package generic implements the pooling logic of go-lua-pool for any kind of
+// expensive state, e.g. interpreters of other Lua bindings or languages. The
+// Lua VM pool of the parent package is a specialization of Pool.
+package generic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrFailedToRelease = fmt.Errorf("failed to release state")
+	ErrTimeout         = fmt.Errorf("timeout")
+	ErrInvalidWeight   = fmt.Errorf("invalid weight")
+	ErrPoolClosed      = fmt.Errorf("pool closed")
+	ErrNoTaggedState   = fmt.Errorf("no state with tag")
+)
+
+// Creates a new state
+type Factory[T any] func() T
+
+// Reports whether a released state may be used again, invalid states are
+// closed and replaced
+type Validator[T any] func(T) bool
+
+// Frees the resources of a state removed from the pool
+type Closer[T any] func(T)
+
+// Closer for states with a Close method, e.g. cgo based Lua states which must
+// be closed to free their C memory:
+//
+//	generic.New(size, factory, generic.WithCloser(generic.Close[*lua.State]))
+func Close[T interface{ Close() }](v T) {
+	v.Close()
+}
+
+// Option configures optional behaviour of a pool
+type Option[T comparable] func(*Pool[T])
+
+// Checks released states, see Validator
+func WithValidator[T comparable](validator Validator[T]) Option[T] {
+	return func(p *Pool[T]) {
+		p.validator = validator
+	}
+}
+
+// Closes states removed from the pool, see Closer
+func WithCloser[T comparable](closer Closer[T]) Option[T] {
+	return func(p *Pool[T]) {
+		p.closer = closer
+	}
+}
+
+// Cleans up released states before they are validated and returned to the pool
+func WithReset[T comparable](reset func(T)) Option[T] {
+	return func(p *Pool[T]) {
+		p.reset = reset
+	}
+}
+
+// Prepares new states knowing their ID and creation time, e.g. to expose the
+// ID to the state. Runs after the factory and before the tagger.
+func WithInit[T comparable](init func(v T, info Info)) Option[T] {
+	return func(p *Pool[T]) {
+		p.init = init
+	}
+}
+
+// Callbacks for state creation and removal, e.g. for logging. The info passed
+// to Destroyed is the zero value for states unknown to the pool.
+type Events[T any] struct {
+	Created   func(v T, info Info, took time.Duration)
+	Destroyed func(v T, info Info)
+}
+
+func WithEvents[T comparable](events Events[T]) Option[T] {
+	return func(p *Pool[T]) {
+		p.events = events
+	}
+}
+
+// How long Update waits for acquired states
+const DefaultUpdateTimeout = time.Minute
+
+// Sets how long Update waits for acquired states to be released. States still
+// acquired after d are considered leaked: they are replaced right away and
+// destroyed once they are released.
+func WithUpdateTimeout[T comparable](d time.Duration) Option[T] {
+	return func(p *Pool[T]) {
+		p.updateTimeout = d
+	}
+}
+
+// Common interface of pools of any state
+type IPool[T any] interface {
+	Len() int
+	Cap() int
+	Update()
+	UpdateWithTimeout(time.Duration) (int, int)
+	Acquire() T
+	AcquireWithTimeout(time.Duration) (T, error)
+	AcquireWithContext(context.Context) (T, error)
+	Release(T)
+	TryRelease(T) error
+	TryReleaseWithContext(context.Context, T) error
+	Stats() Stats
+}
+
+// ensure interface is satisfied
+var _ IPool[*struct{}] = &Pool[*struct{}]{}
+
+// Bookkeeping of a state created by a pool
+type Info struct {
+	// unique among all pools of the process
+	ID      uint64
+	Created time.Time
+	// generation of the pool the state was created in (see RollingUpdate)
+	Generation uint64
+	// see WithTagger and Tag
+	Tags []string
+}
+
+// Stats is a point-in-time snapshot of the pool state
+type Stats struct {
+	Capacity int
+	// states waiting in the pool
+	Idle int
+	// states currently acquired
+	InUse int
+	// acquirers waiting for a state
+	Waiting int
+}
+
+var idCounter atomic.Uint64
+
+// Creates a new pool of states with the given size/capacity, filled using
+// factory
+func New[T comparable](size int, factory Factory[T], opts ...Option[T]) *Pool[T] {
+	p := &Pool[T]{
+		factory:         factory,
+		clock:           SystemClock,
+		updateTimeout:   DefaultUpdateTimeout,
+		states:          make(map[T]*Info),
+		weights:         make(map[T]int),
+		released:        make(map[T]struct{}),
+		lost:            make(map[T]struct{}),
+		affinityKeys:    DefaultAffinityKeys,
+		affinity:        make(map[string]T),
+		affinityByState: make(map[T][]string),
+		data:            make(map[T]map[any]any),
+		runs:            make(map[T][]*broadcast[T]),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	p.backend = newBackend[T](p.backendType, size, p.shards, p.order)
+	for range size {
+		p.backend.put(context.Background(), p.create())
+	}
+	return p
+}
+
+// A fixed size pool of states. States are created by the factory, handed out by
+// the Acquire methods and returned by the Release methods. The zero value of T
+// can't be pooled, releasing it returns a new state to the pool instead.
+type Pool[T comparable] struct {
+	factory   Factory[T]
+	validator Validator[T]
+	closer    Closer[T]
+	reset     func(T)
+	init      func(T, Info)
+	// see WithFlavors
+	flavors []Flavor[T]
+	// see WithQuarantine
+	quarantineSize int
+	quarantined    []Quarantined[T]
+	quarantineMux  sync.Mutex
+	events         Events[T]
+	clock          Clock
+	// see WithTagger and WithTagLoader
+	tagger    func(T) []string
+	tagLoader func(T, string) error
+
+	backendType Backend
+	shards      int
+	order       Order
+	backend     backend[T]
+	// serializes Update and UpdateWithTimeout
+	mux           sync.Mutex
+	updateTimeout time.Duration
+	// coalesces concurrent updates, guarded by updateMux
+	updateMux sync.Mutex
+	running   *updateCall
+	pending   *updateCall
+
+	// all states created by the pool
+	states    map[T]*Info
+	statesMux sync.Mutex
+	// slots held by states acquired with a weight above 1, guarded by statesMux
+	weights map[T]int
+	// incremented by RollingUpdate, guarded by statesMux
+	generation uint64
+	// states of previous generations still in circulation
+	stale atomic.Int64
+	// stale states being released, guarded by statesMux
+	released map[T]struct{}
+	// states replaced by Update while acquired, guarded by statesMux
+	lost map[T]struct{}
+	// session keys of AcquireFor and their states, guarded by statesMux
+	affinityKeys    int
+	affinity        map[string]T
+	affinityByState map[T][]string
+	// see SetData, guarded by statesMux
+	data map[T]map[any]any
+	// functions of RunOnAll waiting for a state, guarded by statesMux
+	runs        map[T][]*broadcast[T]
+	pendingRuns atomic.Int64
+	// see Close
+	closed atomic.Bool
+	// slots held by acquirers, the source of Len and Stats
+	inUse atomic.Int64
+}
+
+// Returns the number of free slots, idle states or states about to be created
+func (p *Pool[T]) Len() int {
+	return p.Stats().Idle
+}
+
+func (p *Pool[T]) Cap() int {
+	return p.backend.cap()
+}
+
+// Returns a snapshot of the current pool state. Idle and InUse are derived from
+// a single counter updated by every acquire and release, so they always add
+// up to the capacity, maintenance like Update doesn't show up as states in
+// use. A closed pool reports no idle states.
+func (p *Pool[T]) Stats() Stats {
+	capacity := p.backend.cap()
+	inUse := min(max(int(p.inUse.Load()), 0), capacity)
+	idle := capacity - inUse
+	if p.closed.Load() {
+		idle = 0
+	}
+	return Stats{
+		Capacity: capacity,
+		Idle:     idle,
+		InUse:    inUse,
+		Waiting:  p.backend.waiting(),
+	}
+}
+
+// a single update pass shared by concurrent callers
+type updateCall struct {
+	done             chan struct{}
+	removed, created int
+}
+
+// Replaces all states of the pool. Idle states are replaced right away, states
+// in use when they are released. Waits until all of them are replaced but at
+// most the update timeout (see WithUpdateTimeout), states still acquired by then
+// are considered leaked and replaced without waiting for them.
+// Concurrent updates are coalesced: callers arriving while a pass is running
+// share a single follow-up pass and wait for its result.
+func (p *Pool[T]) Update() {
+	ctx, cancel := ContextWithTimeout(context.Background(), p.clock, p.updateTimeout)
+	defer cancel()
+	p.update(ctx, true)
+}
+
+// Like Update but stops waiting after the given duration. The pool keeps its
+// capacity: states not replaced by then, because they were still acquired or
+// the factory was too slow, are replaced when they are released or acquired.
+// Returns the number of states removed and created until then. A caller joining a pass started by
+// another one returns (0, 0) if the pass doesn't finish in time, the pass is
+// bounded by the timeout of the caller running it.
+func (p *Pool[T]) UpdateWithTimeout(to time.Duration) (removed int, created int) {
+	ctx, cancel := ContextWithTimeout(context.Background(), p.clock, to)
+	defer cancel()
+	return p.update(ctx, false)
+}
+
+// Like UpdateWithTimeout but stops waiting once ctx is done
+func (p *Pool[T]) UpdateWithContext(ctx context.Context) (removed int, created int) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return p.update(ctx, false)
+}
+
+func (p *Pool[T]) update(ctx context.Context, abandon bool) (removed int, created int) {
+	p.updateMux.Lock()
+	if p.running == nil {
+		// run the pending pass if nobody took it over yet
+		c := p.pending
+		if c == nil {
+			c = &updateCall{done: make(chan struct{})}
+		}
+		p.pending = nil
+		p.running = c
+		p.updateMux.Unlock()
+		return p.runUpdate(ctx, c, abandon)
+	}
+	// the running pass may have started before the call, so it doesn't count
+	prev := p.running
+	if p.pending == nil {
+		p.pending = &updateCall{done: make(chan struct{})}
+	}
+	c := p.pending
+	p.updateMux.Unlock()
+
+	select {
+	case <-prev.done:
+	case <-ctx.Done():
+		return 0, 0
+	}
+	p.updateMux.Lock()
+	if p.running == nil && p.pending == c {
+		p.pending = nil
+		p.running = c
+		p.updateMux.Unlock()
+		return p.runUpdate(ctx, c, abandon)
+	}
+	p.updateMux.Unlock()
+	select {
+	case <-c.done:
+		return c.removed, c.created
+	case <-ctx.Done():
+		return 0, 0
+	}
+}
+
+func (p *Pool[T]) runUpdate(ctx context.Context, c *updateCall, abandon bool) (int, int) {
+	c.removed, c.created = p.updatePass(ctx, abandon)
+	p.updateMux.Lock()
+	p.running = nil
+	p.updateMux.Unlock()
+	close(c.done)
+	return c.removed, c.created
+}
+
+// how often Update checks whether the acquired states were replaced
+const updatePollInterval = 5 * time.Millisecond
+
+// starts a new generation and waits until the states of the previous ones are
+// replaced, abandons the acquired ones if ctx is done first
+func (p *Pool[T]) updatePass(ctx context.Context, abandon bool) (removed int, created int) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if p.closed.Load() {
+		return 0, 0
+	}
+
+	p.statesMux.Lock()
+	p.generation++
+	total := len(p.states)
+	p.stale.Store(int64(total))
+	p.statesMux.Unlock()
+
+	forgotten := 0
+	p.replaceIdle(ctx)
+	for p.stale.Load() > 0 && !p.closed.Load() {
+		if p.backend.len() == p.backend.cap() {
+			// nothing is acquired, the remaining stale states were dropped
+			// by the backend (see SyncPoolBackend)
+			p.replaceIdle(ctx)
+			if p.backend.len() == p.backend.cap() && ctx.Err() == nil {
+				_, forgotten = p.abandon()
+				break
+			}
+		}
+		t := p.clock.NewTimer(updatePollInterval)
+		select {
+		case <-t.C():
+			continue
+		case <-ctx.Done():
+			t.Stop()
+		}
+		if abandon {
+			p.replaceIdle(context.Background())
+			_, forgotten = p.abandon()
+		}
+		break
+	}
+	if p.closed.Load() {
+		p.drain()
+	}
+	removed = max(total-int(p.stale.Load()), 0)
+	return removed, removed - forgotten
+}
+
+// replaces the idle states of previous generations until ctx is done, the
+// remaining ones are returned as they are and replaced when acquired. Returns
+// the number of replaced states.
+func (p *Pool[T]) replaceIdle(ctx context.Context) int {
+	var stale []T
+	for range p.Cap() {
+		v, ok := p.backend.takeIdle()
+		if !ok {
+			break
+		}
+		stale = append(stale, v)
+	}
+	// current states go back right away
+	n := 0
+	for _, v := range stale {
+		if p.IsStale(v) {
+			stale[n] = v
+			n++
+		} else {
+			p.putIdle(v)
+		}
+	}
+	stale = stale[:n]
+	replaced := 0
+	for _, v := range stale {
+		if ctx.Err() == nil {
+			p.Destroy(v)
+			v = p.create()
+			replaced++
+		}
+		p.putIdle(v)
+	}
+	return replaced
+}
+
+// replaces the stale states which are still acquired, they are destroyed once
+// released. Stale states which turn out not to hold a slot are forgotten.
+func (p *Pool[T]) abandon() (replaced int, forgotten int) {
+	p.statesMux.Lock()
+	var stale []T
+	for v, info := range p.states {
+		if info.Generation < p.generation {
+			stale = append(stale, v)
+		}
+	}
+	p.statesMux.Unlock()
+	for _, v := range stale {
+		r := p.create()
+		ok, forget := p.abandonState(v, r)
+		if ok {
+			replaced++
+			continue
+		}
+		if forget {
+			forgotten++
+		}
+		p.Destroy(r)
+	}
+	return
+}
+
+// puts r into the slot held by the stale state v
+func (p *Pool[T]) abandonState(v, r T) (ok bool, forgotten bool) {
+	p.statesMux.Lock()
+	defer p.statesMux.Unlock()
+	info := p.states[v]
+	if info == nil || info.Generation >= p.generation {
+		return false, false
+	}
+	if _, ok := p.released[v]; ok {
+		// replaced by the release in progress
+		return false, false
+	}
+	weight := max(p.weights[v], 1)
+	p.dropRuns(v, info.ID)
+	delete(p.states, v)
+	delete(p.weights, v)
+	delete(p.data, v)
+	p.forgetKeys(v)
+	p.stale.Add(-1)
+	p.inUse.Add(-int64(weight))
+	if err := p.put(nil, r, weight); err != nil {
+		// no slot is acquired, so v isn't either
+		p.inUse.Add(int64(weight))
+		return false, true
+	}
+	p.lost[v] = struct{}{}
+	return true, false
+}
+
+// Replaces all states of the pool without blocking: idle states are replaced
+// one at a time right away, states in use are replaced when they are released.
+// Returns the number of idle states which were replaced immediately.
+func (p *Pool[T]) RollingUpdate() int {
+	if p.closed.Load() {
+		return 0
+	}
+	p.statesMux.Lock()
+	p.generation++
+	p.stale.Store(int64(len(p.states)))
+	p.statesMux.Unlock()
+
+	replaced := 0
+	for range p.Cap() {
+		v, ok := p.backend.takeIdle()
+		if !ok {
+			break
+		}
+		if !p.IsStale(v) {
+			// all idle states are up to date
+			p.putIdle(v)
+			break
+		}
+		p.Destroy(v)
+		p.putIdle(p.create())
+		replaced++
+	}
+	return replaced
+}
+
+// returns an idle state without changing the slots in use, destroys it if the
+// pool was closed meanwhile
+func (p *Pool[T]) putIdle(v T) {
+	p.backend.putIdle(v)
+	if p.closed.Load() {
+		p.drain()
+	}
+}
+
+// Closes the pool: waiting and later acquirers fail with ErrPoolClosed, idle
+// states are destroyed right away and acquired ones when they are released.
+// Calling Close more than once has no effect.
+func (p *Pool[T]) Close() {
+	if p.closed.Swap(true) {
+		return
+	}
+	p.backend.close()
+	p.drain()
+	p.clearQuarantine()
+}
+
+// true once Close was called
+func (p *Pool[T]) Closed() bool {
+	return p.closed.Load()
+}
+
+// destroys the idle states of a closed pool. States released concurrently are
+// put into the backend before the releaser checks for Close, so either Close
+// or the releaser drains them.
+func (p *Pool[T]) drain() {
+	var zero T
+	for {
+		v, ok := p.backend.takeIdle()
+		if !ok {
+			return
+		}
+		if v != zero {
+			p.Destroy(v)
+		}
+	}
+}
+
+// Acquires a state from the pool (blocking), returns the zero value if the
+// pool is closed
+func (p *Pool[T]) Acquire() T {
+	v, _ := p.acquire(context.Background())
+	return v
+}
+
+// Acquires a state from the pool, fails with ErrTimeout after the given duration
+func (p *Pool[T]) AcquireWithTimeout(to time.Duration) (T, error) {
+	ctx, cancel := ContextWithTimeout(context.Background(), p.clock, to)
+	defer cancel()
+	v, err := p.acquire(ctx)
+	if err != nil && !errors.Is(err, ErrPoolClosed) {
+		return v, ErrTimeout
+	}
+	return v, err
+}
+
+// Acquires a state from the pool, fails with ctx.Err() once ctx is done
+func (p *Pool[T]) AcquireWithContext(ctx context.Context) (T, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return p.acquire(ctx)
+}
+
+// Acquires a state which takes weight slots of the pool until it is released,
+// e.g. to reserve capacity for an expensive task. Fails with ErrInvalidWeight
+// if weight exceeds the capacity or the backend doesn't support weights.
+func (p *Pool[T]) AcquireWeighted(ctx context.Context, weight int) (T, error) {
+	if weight == 1 {
+		return p.AcquireWithContext(ctx)
+	}
+	var zero T
+	wb, ok := p.backend.(weightedBackend[T])
+	if !ok || weight < 1 || weight > p.Cap() {
+		return zero, ErrInvalidWeight
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if p.closed.Load() {
+		return zero, ErrPoolClosed
+	}
+	v, err := wb.getWeighted(ctx, weight)
+	if err != nil {
+		return v, err
+	}
+	if v, err = p.checkOut(v); err != nil {
+		return v, err
+	}
+	p.inUse.Add(int64(weight))
+	p.statesMux.Lock()
+	p.weights[v] = weight
+	p.statesMux.Unlock()
+	return v, nil
+}
+
+func (p *Pool[T]) acquire(ctx context.Context) (T, error) {
+	if p.closed.Load() {
+		var zero T
+		return zero, ErrPoolClosed
+	}
+	v, err := p.backend.get(ctx)
+	if err != nil {
+		return v, err
+	}
+	if v, err = p.checkOut(v); err != nil {
+		return v, err
+	}
+	p.inUse.Add(1)
+	return v, nil
+}
+
+// returns a usable state for an acquired slot unless the pool was closed while
+// acquiring
+func (p *Pool[T]) checkOut(v T) (T, error) {
+	var zero T
+	if p.closed.Load() {
+		if v != zero {
+			p.Destroy(v)
+		}
+		return zero, ErrPoolClosed
+	}
+	return p.ensure(v), nil
+}
+
+// returns a usable state for an acquired slot
+func (p *Pool[T]) ensure(v T) T {
+	var zero T
+	if v == zero {
+		return p.create()
+	}
+	if p.IsStale(v) {
+		// not replaced by RollingUpdate yet
+		p.Destroy(v)
+		return p.create()
+	}
+	return v
+}
+
+// returns v with the slots held by the state
+func (p *Pool[T]) put(ctx context.Context, v T, weight int) error {
+	if weight == 1 {
+		return p.backend.put(ctx, v)
+	}
+	return p.backend.(weightedBackend[T]).putWeighted(ctx, v, weight)
+}
+
+// returns and forgets the slots held by an acquired state
+func (p *Pool[T]) takeWeight(v T) int {
+	p.statesMux.Lock()
+	defer p.statesMux.Unlock()
+	weight, ok := p.weights[v]
+	if !ok {
+		return 1
+	}
+	delete(p.weights, v)
+	return weight
+}
+
+// puts back the weight of a state which couldn't be released
+func (p *Pool[T]) restoreWeight(v T, weight int) {
+	if weight == 1 {
+		return
+	}
+	p.statesMux.Lock()
+	p.weights[v] = weight
+	p.statesMux.Unlock()
+}
+
+// Releases a state to the pool (blocking)
+// if v is the zero value a new state gets created on the fly. States released
+// in excess of the acquired ones are destroyed, so the pool never holds more
+// states than its capacity.
+func (p *Pool[T]) Release(v T) {
+	var zero T
+	if err := p.tryRelease(context.Background(), v); err != nil && v != zero {
+		p.Destroy(v)
+	}
+}
+
+// Tries to release a state to the pool (non-blocking), fails with
+// ErrFailedToRelease if no state is acquired, i.e. the pool is full
+// if v is the zero value a new state gets created on the fly
+func (p *Pool[T]) TryRelease(v T) error {
+	return p.tryRelease(nil, v)
+}
+
+// Tries to release a state to the pool until ctx is done, fails with
+// ErrFailedToRelease right away if the pool is full
+// if v is the zero value a new state gets created on the fly
+func (p *Pool[T]) TryReleaseWithContext(ctx context.Context, v T) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return p.tryRelease(ctx, v)
+}
+
+// doesn't block if ctx is nil
+func (p *Pool[T]) tryRelease(ctx context.Context, v T) error {
+	var zero T
+	created := v == zero
+	if !created && p.checkIn(v) {
+		// replaced by Update already
+		p.Destroy(v)
+		return nil
+	}
+	weight := 1
+	if !created {
+		weight = p.takeWeight(v)
+	}
+	if p.closed.Load() {
+		if !created {
+			p.inUse.Add(-int64(weight))
+			p.Destroy(v)
+		}
+		return nil
+	}
+	// counted as returned before the slot is free, so Stats never sees more
+	// slots in use than there are
+	if !p.giveBack(weight) {
+		// more states released than acquired, e.g. the zero value
+		if !created {
+			p.restoreWeight(v, weight)
+		}
+		return ErrFailedToRelease
+	}
+	if created {
+		v = p.create()
+	} else {
+		p.Reset(v)
+		p.runPending(v)
+	}
+	out := v
+	replace, invalid := p.replace(v)
+	if replace {
+		out = p.create()
+	}
+	if err := p.put(ctx, out, weight); err != nil {
+		p.inUse.Add(int64(weight))
+		if created {
+			p.Destroy(v)
+		} else {
+			p.restoreWeight(v, weight)
+		}
+		if out != v {
+			p.Destroy(out)
+		}
+		return err
+	}
+	if invalid {
+		p.quarantine(v, ErrInvalidState)
+	} else if out != v {
+		p.Destroy(v)
+	}
+	if p.closed.Load() {
+		p.drain()
+	}
+	return nil
+}
+
+// returns weight slots to the in-use counter, fails if fewer are in use
+func (p *Pool[T]) giveBack(weight int) bool {
+	for {
+		n := p.inUse.Load()
+		if n < int64(weight) {
+			return false
+		}
+		if p.inUse.CompareAndSwap(n, n-int64(weight)) {
+			return true
+		}
+	}
+}
+
+// Cleans up an acquired state using the reset function of the pool (see
+// WithReset). Called by the Release methods, can be used to reuse a held state
+// for several independent tasks.
+func (p *Pool[T]) Reset(v T) {
+	if p.reset != nil {
+		p.reset(v)
+	}
+}
+
+// true if v was abandoned by Update, marks stale states as being released
+// otherwise so Update doesn't replace them a second time
+func (p *Pool[T]) checkIn(v T) (lost bool) {
+	p.statesMux.Lock()
+	defer p.statesMux.Unlock()
+	if _, ok := p.lost[v]; ok {
+		delete(p.lost, v)
+		return true
+	}
+	if info := p.states[v]; info != nil && info.Generation < p.generation {
+		p.released[v] = struct{}{}
+	}
+	return false
+}
+
+// reports whether a released state must be replaced and if so whether it is
+// invalid
+func (p *Pool[T]) replace(v T) (replace bool, invalid bool) {
+	if p.IsStale(v) {
+		return true, false
+	}
+	invalid = p.validator != nil && !p.validator(v)
+	return invalid, invalid
+}
+
+// Removes an acquired state whose state can't be trusted anymore from the pool
+// and creates a replacement in the background, so the caller doesn't pay for it
+func (p *Pool[T]) Discard(v T) {
+	p.discard(v, p.Destroy)
+}
+
+// removes an acquired state with remove and replaces it in the background
+func (p *Pool[T]) discard(v T, remove func(T)) {
+	if p.checkIn(v) {
+		remove(v)
+		return
+	}
+	weight := p.takeWeight(v)
+	remove(v)
+	if p.closed.Load() {
+		p.inUse.Add(-int64(weight))
+		return
+	}
+	go func() {
+		p.inUse.Add(-int64(weight))
+		p.put(context.Background(), p.create(), weight)
+		if p.closed.Load() {
+			p.drain()
+		}
+	}()
+}
+
+// Calls fn for every idle state. The states are checked out one at a time so
+// busy states are skipped and concurrent acquirers are delayed as little as
+// possible. The states are returned to the pool as they are, fn must not leave
+// any state behind.
+func (p *Pool[T]) EachIdle(fn func(T)) {
+	p.ForEachIdle(context.Background(), func(v T) error {
+		fn(v)
+		return nil
+	})
+}
+
+// Like EachIdle but stops once ctx is done, returning its error, or at the
+// first error of fn, which is returned as well
+func (p *Pool[T]) ForEachIdle(ctx context.Context, fn func(T) error) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	seen := make(map[T]struct{})
+	for range p.Cap() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		v, ok := p.backend.takeIdle()
+		if !ok {
+			break
+		}
+		if _, ok := seen[v]; ok {
+			// every idle state was visited already
+			p.putIdle(v)
+			break
+		}
+		seen[v] = struct{}{}
+		err := fn(v)
+		p.putIdle(v)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// true if the state was created before the last RollingUpdate
+func (p *Pool[T]) IsStale(v T) bool {
+	if p.stale.Load() <= 0 {
+		return false
+	}
+	p.statesMux.Lock()
+	defer p.statesMux.Unlock()
+	info := p.states[v]
+	return info != nil && info.Generation < p.generation
+}
+
+// Returns the bookkeeping of a state, false for states not created by this pool
+func (p *Pool[T]) Info(v T) (Info, bool) {
+	p.statesMux.Lock()
+	defer p.statesMux.Unlock()
+	info := p.states[v]
+	if info == nil {
+		return Info{}, false
+	}
+	return *info, true
+}
+
+func (p *Pool[T]) create() T {
+	var start time.Time
+	if p.events.Created != nil {
+		start = p.clock.Now()
+	}
+	var v T
+	info := &Info{}
+	if len(p.flavors) > 0 {
+		f := p.nextFlavor()
+		v = f.Factory()
+		info.Tags = []string{f.Name}
+	} else {
+		v = p.factory()
+	}
+	info.ID = idCounter.Add(1)
+	info.Created = p.clock.Now()
+	if p.init != nil {
+		p.init(v, *info)
+	}
+	if p.tagger != nil {
+		info.Tags = append(info.Tags, p.tagger(v)...)
+	}
+	p.statesMux.Lock()
+	info.Generation = p.generation
+	p.states[v] = info
+	p.statesMux.Unlock()
+	if p.events.Created != nil {
+		p.events.Created(v, *info, p.clock.Now().Sub(start))
+	}
+	return v
+}
+
+// Removes a state from the pool bookkeeping and closes it (see WithCloser).
+// The state must not be in the pool.
+func (p *Pool[T]) Destroy(v T) {
+	p.close(v, p.forget(v))
+}
+
+// removes a state from the bookkeeping and returns its info, nil for unknown
+// states
+func (p *Pool[T]) forget(v T) *Info {
+	p.statesMux.Lock()
+	defer p.statesMux.Unlock()
+	info := p.states[v]
+	delete(p.states, v)
+	delete(p.released, v)
+	delete(p.data, v)
+	p.forgetKeys(v)
+	if info != nil {
+		p.dropRuns(v, info.ID)
+	}
+	if info != nil && info.Generation < p.generation {
+		p.stale.Add(-1)
+	}
+	return info
+}
+
+// closes a state removed from the bookkeeping
+func (p *Pool[T]) close(v T, info *Info) {
+	if p.closer != nil {
+		p.closer(v)
+	}
+	if p.events.Destroyed != nil {
+		var i Info
+		if info != nil {
+			i = *info
+		}
+		p.events.Destroyed(v, i)
+	}
+}
@@ -0,0 +1,521 @@
+package generic
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type state struct {
+	id     int
+	uses   int
+	closed bool
+}
+
+func (s *state) Close() {
+	s.closed = true
+}
+
+type factory struct {
+	mux     sync.Mutex
+	created []*state
+}
+
+func (f *factory) new() *state {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	s := &state{id: len(f.created) + 1}
+	f.created = append(f.created, s)
+	return s
+}
+
+func TestPool(t *testing.T) {
+	f := &factory{}
+	p := New(2, f.new,
+		WithReset(func(s *state) { s.uses++ }),
+		WithValidator(func(s *state) bool { return s.uses < 2 }),
+		WithCloser(Close[*state]),
+	)
+	if p.Len() != 2 || p.Cap() != 2 || len(f.created) != 2 {
+		t.Fatalf("expected a full pool of 2 states")
+	}
+
+	a, b := p.Acquire(), p.Acquire()
+	if _, err := p.AcquireWithTimeout(10 * time.Millisecond); !errors.Is(err, ErrTimeout) {
+		t.Errorf("expected %v but got %v", ErrTimeout, err)
+	}
+	p.Release(a)
+	p.Release(b)
+	if s := p.Stats(); s != (Stats{Capacity: 2, Idle: 2}) {
+		t.Errorf("unexpected stats %+v", s)
+	}
+
+	// states are closed and replaced once the validator rejects them
+	a = p.Acquire()
+	p.Release(a)
+	if !a.closed || len(f.created) != 3 {
+		t.Errorf("expected invalid state to be replaced")
+	}
+	if err := p.TryRelease(nil); !errors.Is(err, ErrFailedToRelease) {
+		t.Errorf("expected %v but got %v", ErrFailedToRelease, err)
+	}
+	if err := p.TryReleaseWithContext(context.Background(), nil); !errors.Is(err, ErrFailedToRelease) {
+		t.Errorf("expected %v but got %v", ErrFailedToRelease, err)
+	}
+	// surplus states are destroyed instead of blocking
+	p.Release(&state{})
+	if len(f.created) != 3 || p.Len() != 2 {
+		t.Errorf("expected no surplus state in the pool")
+	}
+}
+
+func TestRollingUpdate(t *testing.T) {
+	f := &factory{}
+	p := New(2, f.new, WithCloser(func(s *state) { s.closed = true }))
+	busy := p.Acquire()
+	if replaced := p.RollingUpdate(); replaced != 1 {
+		t.Errorf("expected 1 idle state to be replaced but got %d", replaced)
+	}
+	if !p.IsStale(busy) {
+		t.Errorf("expected busy state to be stale")
+	}
+	p.Release(busy)
+	if !busy.closed || len(f.created) != 4 {
+		t.Errorf("expected stale state to be replaced on release")
+	}
+
+	var ids []uint64
+	p.EachIdle(func(s *state) {
+		info, ok := p.Info(s)
+		if !ok || info.Generation != 1 {
+			t.Errorf("unexpected info %+v", info)
+		}
+		ids = append(ids, info.ID)
+	})
+	if len(ids) != 2 || ids[0] == ids[1] {
+		t.Errorf("expected 2 distinct idle states but got %v", ids)
+	}
+}
+
+func TestDiscard(t *testing.T) {
+	f := &factory{}
+	p := New(1, f.new)
+	s := p.Acquire()
+	p.Discard(s)
+	if _, ok := p.Info(s); ok {
+		t.Errorf("expected discarded state to be removed")
+	}
+	if _, err := p.AcquireWithTimeout(time.Second); err != nil {
+		t.Errorf("expected replacement but got %v", err)
+	}
+}
+
+func TestInit(t *testing.T) {
+	f := &factory{}
+	ids := make(map[*state]uint64)
+	p := New(2, f.new, WithInit(func(s *state, info Info) {
+		ids[s] = info.ID
+	}))
+	s := p.Acquire()
+	defer p.Release(s)
+	if info, _ := p.Info(s); info.ID == 0 || ids[s] != info.ID {
+		t.Errorf("expected init with the info of the state")
+	}
+	if len(ids) != 2 {
+		t.Errorf("expected 2 initialized states but got %d", len(ids))
+	}
+}
+
+func TestSyncPoolBackend(t *testing.T) {
+	f := &factory{}
+	p := New(2, f.new, WithBackend[*state](SyncPoolBackend))
+	a, b := p.Acquire(), p.Acquire()
+	if a == nil || b == nil || a == b {
+		t.Fatalf("expected 2 distinct states")
+	}
+	if s := p.Stats(); s != (Stats{Capacity: 2, InUse: 2}) {
+		t.Errorf("unexpected stats %+v", s)
+	}
+	if _, err := p.AcquireWithTimeout(10 * time.Millisecond); !errors.Is(err, ErrTimeout) {
+		t.Errorf("expected %v but got %v", ErrTimeout, err)
+	}
+	p.Release(a)
+	if err := p.TryRelease(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.TryRelease(b); !errors.Is(err, ErrFailedToRelease) {
+		t.Errorf("expected %v but got %v", ErrFailedToRelease, err)
+	}
+	if s := p.Stats(); s != (Stats{Capacity: 2, Idle: 2}) {
+		t.Errorf("unexpected stats %+v", s)
+	}
+
+	// states replaced by RollingUpdate are never handed out again
+	p.RollingUpdate()
+	for range 2 {
+		if s := p.Acquire(); p.IsStale(s) {
+			t.Errorf("expected a current state")
+		}
+	}
+	if removed, created := p.UpdateWithTimeout(10 * time.Millisecond); removed != 0 || created != 0 {
+		t.Errorf("expected update to time out but got %d, %d", removed, created)
+	}
+}
+
+func TestBackendsConcurrent(t *testing.T) {
+	for name, opts := range map[string][]Option[*state]{
+		"fifo":    nil,
+		"sharded": {WithShards[*state](3)},
+		"lifo":    {WithOrder[*state](LIFO)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			f := &factory{}
+			p := New(4, f.new, opts...)
+			var wg sync.WaitGroup
+			var mux sync.Mutex
+			held := make(map[*state]bool)
+			for range 16 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for range 200 {
+						s := p.Acquire()
+						mux.Lock()
+						if held[s] {
+							t.Errorf("state %d handed out twice", s.id)
+						}
+						held[s] = true
+						mux.Unlock()
+						runtime.Gosched()
+						mux.Lock()
+						delete(held, s)
+						mux.Unlock()
+						p.Release(s)
+					}
+				}()
+			}
+			wg.Wait()
+			if s := p.Stats(); s != (Stats{Capacity: 4, Idle: 4}) || len(f.created) != 4 {
+				t.Errorf("unexpected stats %+v after creating %d states", s, len(f.created))
+			}
+			if err := p.TryRelease(nil); !errors.Is(err, ErrFailedToRelease) {
+				t.Errorf("expected %v but got %v", ErrFailedToRelease, err)
+			}
+			p.Update()
+			// 4 initial states and 4 replacements
+			if len(f.created) != 8 || p.Len() != 4 {
+				t.Errorf("expected all states to be replaced")
+			}
+		})
+	}
+}
+
+func TestOrder(t *testing.T) {
+	for order, want := range map[Order]int{FIFO: 3, LIFO: 2} {
+		f := &factory{}
+		p := New(3, f.new, WithOrder[*state](order))
+		a, b := p.Acquire(), p.Acquire()
+		p.Release(a)
+		p.Release(b)
+		// state 3 was idle all the time
+		if s := p.Acquire(); s.id != want {
+			t.Errorf("%s: expected state %d but got %d", order, want, s.id)
+		}
+	}
+}
+
+func TestWaitersCancel(t *testing.T) {
+	f := &factory{}
+	p := New(1, f.new, WithOrder[*state](LIFO))
+	s := p.Acquire()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := p.AcquireWithContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected %v but got %v", context.DeadlineExceeded, err)
+	}
+	done := make(chan *state)
+	go func() {
+		done <- p.Acquire()
+	}()
+	time.Sleep(10 * time.Millisecond)
+	p.Release(s)
+	// the cancelled acquire doesn't swallow the released state
+	if got := <-done; got != s {
+		t.Errorf("expected released state to be handed to the waiter")
+	}
+}
+
+func TestAcquireWeighted(t *testing.T) {
+	f := &factory{}
+	p := New(3, f.new)
+	if _, err := p.AcquireWeighted(context.Background(), 4); !errors.Is(err, ErrInvalidWeight) {
+		t.Errorf("expected %v but got %v", ErrInvalidWeight, err)
+	}
+	heavy, err := p.AcquireWeighted(context.Background(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := p.Stats(); s.InUse != 2 || s.Idle != 1 {
+		t.Errorf("expected 2 slots in use but got %+v", s)
+	}
+	light := p.Acquire()
+	if _, err := p.AcquireWithTimeout(10 * time.Millisecond); !errors.Is(err, ErrTimeout) {
+		t.Errorf("expected %v but got %v", ErrTimeout, err)
+	}
+
+	// a waiting heavy acquire isn't overtaken by light ones
+	done := make(chan *state)
+	go func() {
+		s, _ := p.AcquireWeighted(context.Background(), 2)
+		done <- s
+	}()
+	time.Sleep(10 * time.Millisecond)
+	p.Release(light)
+	if _, err := p.AcquireWithTimeout(10 * time.Millisecond); !errors.Is(err, ErrTimeout) {
+		t.Errorf("expected light acquire to wait behind the heavy one but got %v", err)
+	}
+	// a plain release frees all slots of a heavy state
+	p.Release(heavy)
+	p.Release(<-done)
+	if s := p.Stats(); s != (Stats{Capacity: 3, Idle: 3}) {
+		t.Errorf("unexpected stats %+v", s)
+	}
+
+	if _, err := New(3, f.new, WithShards[*state](2)).AcquireWeighted(context.Background(), 2); !errors.Is(err, ErrInvalidWeight) {
+		t.Errorf("expected %v but got %v", ErrInvalidWeight, err)
+	}
+}
+
+func TestUpdateCoalesced(t *testing.T) {
+	f := &factory{}
+	p := New(2, f.new)
+	busy := p.Acquire()
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.Update()
+		}()
+	}
+	// the first pass waits for the busy state, all other calls join one
+	// follow-up pass
+	time.Sleep(20 * time.Millisecond)
+	p.Release(busy)
+	wg.Wait()
+	if len(f.created) != 6 || p.Len() != 2 {
+		t.Errorf("expected 2 update passes but got %d created states", len(f.created))
+	}
+}
+
+func TestUpdateLeaked(t *testing.T) {
+	f := &factory{}
+	p := New(3, f.new, WithCloser(Close[*state]), WithUpdateTimeout[*state](20*time.Millisecond))
+	leaked, busy := p.Acquire(), p.Acquire()
+	released := make(chan struct{})
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		p.Release(busy)
+		close(released)
+	}()
+	start := time.Now()
+	p.Update()
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("update took %v", d)
+	}
+	<-released
+	// the leaked state was replaced, the busy one replaced on release
+	if len(f.created) != 6 || p.Len() != 3 || !busy.closed {
+		t.Errorf("expected the pool to be refilled but got %d idle after creating %d states", p.Len(), len(f.created))
+	}
+	p.Release(leaked)
+	if !leaked.closed || p.Len() != 3 {
+		t.Errorf("expected the leaked state to be destroyed on release")
+	}
+	if err := p.TryRelease(nil); !errors.Is(err, ErrFailedToRelease) {
+		t.Errorf("expected %v but got %v", ErrFailedToRelease, err)
+	}
+}
+
+func TestUpdateWithTimeoutKeepsCapacity(t *testing.T) {
+	f := &factory{}
+	var slow atomic.Bool
+	p := New(4, func() *state {
+		if slow.Load() {
+			time.Sleep(20 * time.Millisecond)
+		}
+		return f.new()
+	})
+	slow.Store(true)
+	removed, created := p.UpdateWithTimeout(30 * time.Millisecond)
+	if removed == 0 || removed == 4 || created != removed {
+		t.Errorf("expected some states to be replaced in time but got %d, %d", removed, created)
+	}
+	if p.Len() != 4 {
+		t.Errorf("expected the pool to keep its capacity but got %d idle states", p.Len())
+	}
+	slow.Store(false)
+	// the remaining states are replaced when acquired
+	for range 4 {
+		if s := p.Acquire(); p.IsStale(s) {
+			t.Errorf("expected a current state")
+		}
+	}
+}
+
+func TestClose(t *testing.T) {
+	for name, opts := range map[string][]Option[*state]{
+		"list":     nil,
+		"sharded":  {WithShards[*state](2)},
+		"syncpool": {WithBackend[*state](SyncPoolBackend)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			f := &factory{}
+			p := New(2, f.new, append(opts, WithCloser(Close[*state]))...)
+			a, b := p.Acquire(), p.Acquire()
+			p.Release(a)
+			a = p.Acquire()
+			errs := make(chan error)
+			go func() {
+				_, err := p.AcquireWithContext(context.Background())
+				errs <- err
+			}()
+			time.Sleep(5 * time.Millisecond)
+			p.Close()
+			p.Close()
+			select {
+			case err := <-errs:
+				if !errors.Is(err, ErrPoolClosed) {
+					t.Errorf("expected %v but got %v", ErrPoolClosed, err)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("waiting acquirer wasn't woken by Close")
+			}
+			if _, err := p.AcquireWithTimeout(time.Second); !errors.Is(err, ErrPoolClosed) {
+				t.Errorf("expected %v but got %v", ErrPoolClosed, err)
+			}
+			if s := p.Acquire(); s != nil {
+				t.Errorf("expected no state from a closed pool")
+			}
+			p.Release(a)
+			if err := p.TryRelease(b); err != nil || !a.closed || !b.closed {
+				t.Errorf("expected the released states to be destroyed but got %v", err)
+			}
+			for _, s := range f.created {
+				if !s.closed && name != "syncpool" {
+					t.Errorf("state %d wasn't closed", s.id)
+				}
+			}
+		})
+	}
+}
+
+func TestCloseConcurrent(t *testing.T) {
+	f := &factory{}
+	p := New(4, f.new, WithCloser(Close[*state]))
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				s, err := p.AcquireWithContext(context.Background())
+				if err != nil {
+					return
+				}
+				runtime.Gosched()
+				p.Release(s)
+			}
+		}()
+	}
+	time.Sleep(5 * time.Millisecond)
+	p.Close()
+	wg.Wait()
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	for _, s := range f.created {
+		if !s.closed {
+			t.Errorf("state %d wasn't closed", s.id)
+		}
+	}
+}
+
+func TestStatsConsistent(t *testing.T) {
+	f := &factory{}
+	p := New(4, f.new)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				s := p.Acquire()
+				runtime.Gosched()
+				p.Release(s)
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for range 5 {
+			p.UpdateWithTimeout(time.Millisecond)
+		}
+	}()
+	for range 1000 {
+		s := p.Stats()
+		if s.Idle+s.InUse != s.Capacity || s.InUse > s.Capacity {
+			t.Fatalf("inconsistent stats %+v", s)
+		}
+	}
+	close(done)
+	wg.Wait()
+	if s := p.Stats(); s != (Stats{Capacity: 4, Idle: 4}) {
+		t.Errorf("unexpected stats %+v", s)
+	}
+}
+
+func TestForEachIdle(t *testing.T) {
+	f := &factory{}
+	p := New(3, f.new)
+	errStop := errors.New("stop")
+	n := 0
+	err := p.ForEachIdle(context.Background(), func(*state) error {
+		n++
+		if n == 2 {
+			return errStop
+		}
+		return nil
+	})
+	if !errors.Is(err, errStop) || n != 2 {
+		t.Errorf("expected to stop at the error but got %v after %d states", err, n)
+	}
+	if s := p.Stats(); s.Idle != 3 || p.Len() != 3 {
+		t.Errorf("expected all states to be returned but got %+v", s)
+	}
+}
+
+func TestUpdateWithContext(t *testing.T) {
+	f := &factory{}
+	p := New(2, f.new, WithCloser(Close[*state]))
+	busy := p.Acquire()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if removed, created := p.UpdateWithContext(ctx); removed != 1 || created != 1 {
+		t.Errorf("expected the idle state to be replaced but got %d, %d", removed, created)
+	}
+	p.Release(busy)
+	if !busy.closed || len(f.created) != 4 {
+		t.Errorf("expected the busy state to be replaced on release")
+	}
+}
@@ -0,0 +1,99 @@
+package generic
+
+import (
+	"fmt"
+	"time"
+)
+
+var ErrInvalidState = fmt.Errorf("state failed validation")
+
+// A state kept for inspection, see WithQuarantine
+type Quarantined[T any] struct {
+	State T
+	// bookkeeping of the state when it was quarantined
+	Info   Info
+	Reason error
+	Time   time.Time
+}
+
+// Keeps up to n states which failed validation (see WithValidator) or were
+// passed to Quarantine for inspection instead of closing them right away. The
+// states are replaced in the pool as usual and never handed out again. Once
+// the quarantine is full the oldest state is closed. Quarantined states are
+// closed by Recycle and Close.
+func WithQuarantine[T comparable](n int) Option[T] {
+	return func(p *Pool[T]) {
+		p.quarantineSize = n
+	}
+}
+
+// Removes an acquired state from the pool like Discard but moves it to the
+// quarantine with the reason instead of closing it. Without quarantine the
+// state is destroyed.
+func (p *Pool[T]) Quarantine(v T, reason error) {
+	p.discard(v, func(v T) {
+		p.quarantine(v, reason)
+	})
+}
+
+// Returns the quarantined states, oldest first
+func (p *Pool[T]) Quarantined() []Quarantined[T] {
+	p.quarantineMux.Lock()
+	defer p.quarantineMux.Unlock()
+	return append([]Quarantined[T](nil), p.quarantined...)
+}
+
+// Removes a state from the quarantine and closes it, false if it isn't
+// quarantined
+func (p *Pool[T]) Recycle(v T) bool {
+	p.quarantineMux.Lock()
+	for i, q := range p.quarantined {
+		if q.State == v {
+			p.quarantined = append(p.quarantined[:i], p.quarantined[i+1:]...)
+			p.quarantineMux.Unlock()
+			p.close(v, &q.Info)
+			return true
+		}
+	}
+	p.quarantineMux.Unlock()
+	return false
+}
+
+// moves a state which isn't in the pool to the quarantine
+func (p *Pool[T]) quarantine(v T, reason error) {
+	info := p.forget(v)
+	if p.quarantineSize <= 0 || p.closed.Load() {
+		p.close(v, info)
+		return
+	}
+	q := Quarantined[T]{State: v, Reason: reason, Time: p.clock.Now()}
+	if info != nil {
+		q.Info = *info
+	}
+	p.quarantineMux.Lock()
+	p.quarantined = append(p.quarantined, q)
+	var evicted []Quarantined[T]
+	if n := len(p.quarantined) - p.quarantineSize; n > 0 {
+		evicted = append(evicted, p.quarantined[:n]...)
+		p.quarantined = append(p.quarantined[:0], p.quarantined[n:]...)
+	}
+	p.quarantineMux.Unlock()
+	for _, q := range evicted {
+		p.close(q.State, &q.Info)
+	}
+	if p.closed.Load() {
+		// raced with Close
+		p.clearQuarantine()
+	}
+}
+
+// closes all quarantined states
+func (p *Pool[T]) clearQuarantine() {
+	p.quarantineMux.Lock()
+	quarantined := p.quarantined
+	p.quarantined = nil
+	p.quarantineMux.Unlock()
+	for _, q := range quarantined {
+		p.close(q.State, &q.Info)
+	}
+}
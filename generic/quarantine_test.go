@@ -0,0 +1,48 @@
+package generic
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestQuarantine(t *testing.T) {
+	f := &factory{}
+	p := New(2, f.new, WithCloser(Close[*state]), WithQuarantine[*state](2),
+		WithValidator(func(s *state) bool { return s.uses < 1 }))
+
+	// fails validation
+	s := p.Acquire()
+	s.uses++
+	p.Release(s)
+	q := p.Quarantined()
+	if len(q) != 1 || q[0].State != s || !errors.Is(q[0].Reason, ErrInvalidState) || q[0].Info.ID == 0 {
+		t.Fatalf("expected the invalid state in quarantine but got %+v", q)
+	}
+	if s.closed {
+		t.Errorf("expected the quarantined state to stay open")
+	}
+	if _, ok := p.Info(s); ok {
+		t.Errorf("expected the quarantined state to leave the pool")
+	}
+
+	// quarantined by the caller, the oldest state is closed once full
+	errBroken := errors.New("broken")
+	for range 2 {
+		p.Quarantine(p.Acquire(), errBroken)
+	}
+	for p.Len() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	q = p.Quarantined()
+	if len(q) != 2 || !s.closed || !errors.Is(q[1].Reason, errBroken) {
+		t.Errorf("expected the oldest state to be closed but got %+v", q)
+	}
+	if !p.Recycle(q[0].State) || !q[0].State.closed || p.Recycle(q[0].State) {
+		t.Errorf("expected the state to be recycled once")
+	}
+	p.Close()
+	if len(p.Quarantined()) != 0 || !q[1].State.closed {
+		t.Errorf("expected Close to clear the quarantine")
+	}
+}
@@ -0,0 +1,111 @@
+package generic
+
+import (
+	"context"
+	"fmt"
+	"slices"
+)
+
+// Tags new states with the returned tags, e.g. the script bundle the factory
+// loaded (see AcquireWithTag)
+func WithTagger[T comparable](tagger func(T) []string) Option[T] {
+	return func(p *Pool[T]) {
+		p.tagger = tagger
+	}
+}
+
+// Prepares a state acquired by AcquireWithTag which doesn't carry the tag yet,
+// e.g. by loading the script bundle named by the tag. The state is tagged if
+// load succeeds.
+func WithTagLoader[T comparable](load func(v T, tag string) error) Option[T] {
+	return func(p *Pool[T]) {
+		p.tagLoader = load
+	}
+}
+
+// Adds tags to a state created by the pool. Tags live as long as the state,
+// its replacement only gets the tags of the tagger.
+func (p *Pool[T]) Tag(v T, tags ...string) {
+	p.statesMux.Lock()
+	defer p.statesMux.Unlock()
+	info := p.states[v]
+	if info == nil {
+		return
+	}
+	for _, tag := range tags {
+		if !slices.Contains(info.Tags, tag) {
+			// Info copies share the old slice
+			info.Tags = append(slices.Clip(info.Tags), tag)
+		}
+	}
+}
+
+// true if the state carries tag
+func (p *Pool[T]) HasTag(v T, tag string) bool {
+	p.statesMux.Lock()
+	defer p.statesMux.Unlock()
+	info := p.states[v]
+	return info != nil && slices.Contains(info.Tags, tag)
+}
+
+// Acquires a state carrying tag. Idle states with the tag are preferred, if
+// none is available any state is taken and prepared by the tag loader (see
+// WithTagLoader). Without tag loader the state is released again and the
+// acquire fails with ErrNoTaggedState. If the loader fails the state is
+// discarded and its error returned. Only the SemaphoreBackend picks tagged
+// states, the other backends hand out any state.
+func (p *Pool[T]) AcquireWithTag(ctx context.Context, tag string) (T, error) {
+	var zero T
+	mb, ok := p.backend.(matchingBackend[T])
+	if !ok {
+		return p.acquireTagged(ctx, tag, p.AcquireWithContext)
+	}
+	// no locking while the backend holds its lock
+	p.statesMux.Lock()
+	tagged := make(map[T]struct{})
+	for v, info := range p.states {
+		if slices.Contains(info.Tags, tag) {
+			tagged[v] = struct{}{}
+		}
+	}
+	p.statesMux.Unlock()
+	return p.acquireTagged(ctx, tag, func(ctx context.Context) (T, error) {
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		if p.closed.Load() {
+			return zero, ErrPoolClosed
+		}
+		v, err := mb.getMatching(ctx, func(v T) bool {
+			_, ok := tagged[v]
+			return ok
+		})
+		if err != nil {
+			return v, err
+		}
+		if v, err = p.checkOut(v); err != nil {
+			return v, err
+		}
+		p.inUse.Add(1)
+		return v, nil
+	})
+}
+
+func (p *Pool[T]) acquireTagged(ctx context.Context, tag string, acquire func(context.Context) (T, error)) (T, error) {
+	var zero T
+	v, err := acquire(ctx)
+	if err != nil || p.HasTag(v, tag) {
+		return v, err
+	}
+	if p.tagLoader == nil {
+		p.Release(v)
+		return zero, fmt.Errorf("%w %q", ErrNoTaggedState, tag)
+	}
+	if err := p.tagLoader(v, tag); err != nil {
+		// may be partially prepared
+		p.Discard(v)
+		return zero, err
+	}
+	p.Tag(v, tag)
+	return v, nil
+}
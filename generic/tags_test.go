@@ -0,0 +1,55 @@
+package generic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestAcquireWithTag(t *testing.T) {
+	f := &factory{}
+	p := New(4, f.new, WithTagger(func(s *state) []string {
+		return []string{fmt.Sprintf("bundle%d", s.id%2)}
+	}))
+	ctx := context.Background()
+	s, err := p.AcquireWithTag(ctx, "bundle0")
+	if err != nil || s.id%2 != 0 {
+		t.Fatalf("expected a state of bundle0 but got %v", err)
+	}
+	// the other one of bundle0
+	other, err := p.AcquireWithTag(ctx, "bundle0")
+	if err != nil || other.id%2 != 0 || other == s {
+		t.Fatalf("expected another state of bundle0 but got %v", err)
+	}
+	if _, err := p.AcquireWithTag(ctx, "bundle0"); !errors.Is(err, ErrNoTaggedState) {
+		t.Errorf("expected %v but got %v", ErrNoTaggedState, err)
+	}
+	if p.Len() != 2 {
+		t.Errorf("expected the untagged state to be released again")
+	}
+	p.Release(s)
+	p.Release(other)
+
+	loaded := 0
+	p = New(2, f.new, WithTagLoader(func(s *state, tag string) error {
+		if tag == "broken" {
+			return errors.New("boom")
+		}
+		loaded++
+		return nil
+	}))
+	s, err = p.AcquireWithTag(ctx, "bundle")
+	if err != nil || !p.HasTag(s, "bundle") || loaded != 1 {
+		t.Fatalf("expected a loaded state but got %v", err)
+	}
+	p.Release(s)
+	if s, _ := p.AcquireWithTag(ctx, "bundle"); loaded != 1 {
+		t.Errorf("expected the loaded state to be reused")
+	} else {
+		p.Release(s)
+	}
+	if _, err := p.AcquireWithTag(ctx, "broken"); err == nil {
+		t.Errorf("expected the loader error")
+	}
+}
@@ -0,0 +1,33 @@
+// Package ginpool provides Gin middleware attaching a pooled Lua VM to every
+// request.
+package ginpool
+
+import (
+	"net/http"
+
+	pool "github.com/epikur-io/go-lua-pool"
+	"github.com/gin-gonic/gin"
+)
+
+// Returns middleware acquiring a VM of p for every request, which handlers get
+// by Lease or pool.FromContext(c.Request.Context()). The VM is released once
+// the handler chain returned, even if it panics. The acquire is bound to the
+// request context, requests without a VM are aborted with 503 Service
+// Unavailable.
+func Middleware(p pool.IPool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		lease, err := pool.NewLease(c.Request.Context(), p)
+		if err != nil {
+			c.AbortWithStatus(http.StatusServiceUnavailable)
+			return
+		}
+		defer lease.Release()
+		c.Request = c.Request.WithContext(pool.NewContext(c.Request.Context(), lease))
+		c.Next()
+	}
+}
+
+// Returns the lease of the request acquired by Middleware
+func Lease(c *gin.Context) (*pool.Lease, bool) {
+	return pool.FromContext(c.Request.Context())
+}
@@ -0,0 +1,41 @@
+package ginpool
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	pool "github.com/epikur-io/go-lua-pool"
+	"github.com/gin-gonic/gin"
+)
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	p := pool.NewPool(1, nil)
+	r := gin.New()
+	r.Use(Middleware(p))
+	r.GET("/", func(c *gin.Context) {
+		if _, ok := Lease(c); !ok {
+			t.Error("expected lease")
+		}
+		c.String(http.StatusOK, "ok")
+	})
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK || p.Stats().InUse != 0 {
+		t.Errorf("unexpected response %d or VM not released", rec.Code)
+	}
+
+	vm := p.Acquire()
+	defer p.Release(vm)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected %d but got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+}
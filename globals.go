@@ -0,0 +1,103 @@
+package pool
+
+import (
+	lua "github.com/epikur-io/go-lua"
+)
+
+// registry field holding the metatable of the throwaway environments
+const scratchMetaKey = "lua-pool.scratch"
+
+// Freezes the global table of every VM once it was set up by the factory and
+// preloaded scripts. Globals assigned later, by scripts or by Go via SetGlobal,
+// only live in a throwaway table which is discarded when the VM is released,
+// so the globals seen by the next user are always those of the factory.
+// Only the global table itself is protected: tables stored in globals, e.g.
+// string or math, can still be modified. Scripts can no longer enumerate the
+// globals with pairs(_G), and every global lookup costs two additional
+// metatable hops.
+func WithReadOnlyGlobals(enabled bool) Option {
+	return func(p *Pool) {
+		p.readOnlyGlobals = enabled
+	}
+}
+
+// moves all globals into a hidden base table and turns the global table into
+// a proxy reading from a throwaway table which falls back to the base table
+func freezeGlobals(vm *lua.State) {
+	vm.RawGetInt(lua.RegistryIndex, lua.RegistryIndexGlobals)
+	globals := vm.Top()
+
+	// the metatable of the throwaway tables refers to the base table
+	vm.NewTable()
+	vm.NewTable()
+	base := vm.Top()
+	vm.PushNil()
+	for vm.Next(globals) {
+		vm.PushValue(-2)
+		vm.Insert(-2)
+		vm.RawSet(base)
+	}
+	// go-lua doesn't allow removing entries during a traversal
+	vm.PushNil()
+	for vm.Next(base) {
+		vm.Pop(1)
+		vm.PushValue(-1)
+		vm.PushNil()
+		vm.RawSet(globals)
+	}
+	vm.SetField(-2, "__index")
+	vm.SetField(lua.RegistryIndex, scratchMetaKey)
+
+	vm.NewTable()
+	vm.PushBoolean(false)
+	// hide the metatable from getmetatable and setmetatable
+	vm.SetField(-2, "__metatable")
+	vm.SetMetaTable(globals)
+	vm.Pop(1)
+	resetGlobals(vm)
+}
+
+// replaces the throwaway table of a frozen global table with an empty one and
+// removes globals assigned by rawset
+func resetGlobals(vm *lua.State) {
+	top := vm.Top()
+	defer vm.SetTop(top)
+	vm.Field(lua.RegistryIndex, scratchMetaKey)
+	scratchMeta := vm.Top()
+	vm.RawGetInt(lua.RegistryIndex, lua.RegistryIndexGlobals)
+	globals := vm.Top()
+	if vm.IsNil(scratchMeta) || !vm.MetaTable(globals) {
+		return
+	}
+	meta := vm.Top()
+	vm.NewTable()
+	vm.PushValue(scratchMeta)
+	vm.SetMetaTable(-2)
+	vm.PushValue(-1)
+	vm.SetField(meta, "__index")
+	vm.SetField(meta, "__newindex")
+
+	// go-lua doesn't allow removing entries during a traversal, start over
+	// after every removal
+	vm.PushNil()
+	for vm.Next(globals) {
+		vm.Pop(1)
+		vm.PushNil()
+		vm.RawSet(globals)
+		vm.PushNil()
+	}
+}
+
+// sets the global name of a frozen global table to the value on top of the
+// stack in the base table, so it outlives releases, and pops the value
+func setFrozenGlobal(vm *lua.State, name string) {
+	vm.Field(lua.RegistryIndex, scratchMetaKey)
+	if !vm.IsTable(-1) {
+		vm.Pop(2)
+		return
+	}
+	vm.Field(-1, "__index")
+	vm.PushValue(-3)
+	vm.SetField(-2, name)
+	vm.Pop(3)
+}
@@ -0,0 +1,45 @@
+package pool
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+func TestReadOnlyGlobals(t *testing.T) {
+	lpool := NewPool(1, func() *lua.State {
+		vm := NewLuaVM()
+		lua.DoString(vm, "limit = 10 function double(n) return n * 2 end")
+		return vm
+	}, WithReadOnlyGlobals(true))
+	ctx := context.Background()
+
+	results, err := lpool.Eval(ctx, `
+		limit = 20
+		rawset(_G, "counter", 1)
+		added = true
+		return limit, added, double(limit), _G.limit`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(results, []any{20.0, true, 40.0, 20.0}) {
+		t.Errorf("unexpected results %v", results)
+	}
+	// writes are discarded after the execution
+	results, err = lpool.Eval(ctx, "return limit, added, counter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(results, []any{10.0, nil, nil}) {
+		t.Errorf("expected factory globals but got %v", results)
+	}
+
+	if _, err := lpool.Eval(ctx, "setmetatable(_G, nil)"); err == nil {
+		t.Errorf("expected the metatable of the globals to be protected")
+	}
+	if results, _ := lpool.Eval(ctx, "return getmetatable(_G)"); !reflect.DeepEqual(results, []any{false}) {
+		t.Errorf("expected hidden metatable but got %v", results)
+	}
+}
@@ -2,4 +2,11 @@ module github.com/epikur-io/go-lua-pool
 
 go 1.22.3
 
-require github.com/epikur-io/go-lua v0.0.0-20250224085517-17039441b5fb
+require (
+	github.com/epikur-io/go-lua v0.0.0-20250224085517-17039441b5fb
+	github.com/fsnotify/fsnotify v1.9.0
+	github.com/yuin/gopher-lua v1.1.1
+	golang.org/x/sync v0.7.0
+)
+
+require golang.org/x/sys v0.20.0 // indirect
@@ -0,0 +1,7 @@
+module github.com/epikur-io/go-lua-pool/golua
+
+go 1.22.3
+
+require github.com/epikur-io/go-lua-pool v0.0.0-00010101000000-000000000000
+
+replace github.com/epikur-io/go-lua-pool => ../
@@ -0,0 +1,61 @@
+// Package golua pools *lua.State instances of the cgo based
+// github.com/aarzilli/golua with the same machinery as the go-lua pool (see
+// package generic). It is a separate module so the pool itself stays cgo free.
+// The Lua version is selected with the build tags of golua, e.g. lua54 or
+// luajit.
+package golua
+
+import (
+	"context"
+
+	"github.com/aarzilli/golua/lua"
+	"github.com/epikur-io/go-lua-pool/generic"
+)
+
+// ensure interface is satisfied
+var _ generic.IPool[*lua.State] = &Pool{}
+
+// Default factory function to create Lua states with the standard libraries
+func NewLuaState() *lua.State {
+	L := lua.NewState()
+	L.OpenLibs()
+	return L
+}
+
+// Pool of golua states. Released states get their stack cleared, removed
+// states are closed to free their C memory.
+type Pool struct {
+	*generic.Pool[*lua.State]
+}
+
+// Creates a new pool of Lua states with the given size/capacity, factory
+// defaults to NewLuaState. opts are applied after the defaults, e.g. to add a
+// validator.
+func NewPool(size int, factory func() *lua.State, opts ...generic.Option[*lua.State]) *Pool {
+	if factory == nil {
+		factory = NewLuaState
+	}
+	opts = append([]generic.Option[*lua.State]{
+		generic.WithReset(func(L *lua.State) { L.SetTop(0) }),
+		generic.WithCloser(generic.Close[*lua.State]),
+	}, opts...)
+	return &Pool{generic.New(size, factory, opts...)}
+}
+
+// Acquires a state, runs fn on it and releases the state again, even if fn
+// panics. ctx only bounds the wait for a state: golua can't interrupt running
+// Lua code, so fn isn't called once ctx is done but isn't aborted either.
+func (p *Pool) Do(ctx context.Context, fn func(*lua.State) error) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	L, err := p.AcquireWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer p.Release(L)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return fn(L)
+}
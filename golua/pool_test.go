@@ -0,0 +1,48 @@
+package golua
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aarzilli/golua/lua"
+)
+
+func TestPool(t *testing.T) {
+	p := NewPool(1, nil)
+	defer p.Close()
+	err := p.Do(context.Background(), func(L *lua.State) error {
+		return L.DoString("answer = 42")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	L := p.Acquire()
+	L.GetGlobal("answer")
+	if v := L.ToInteger(-1); v != 42 {
+		t.Errorf("expected state to be reused but got %v", v)
+	}
+	p.Release(L)
+
+	// the stack is cleared on release
+	L = p.Acquire()
+	defer p.Release(L)
+	if L.GetTop() != 0 {
+		t.Errorf("expected an empty stack but got %d values", L.GetTop())
+	}
+}
+
+func TestDoCanceled(t *testing.T) {
+	p := NewPool(1, nil)
+	defer p.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	called := false
+	err := p.Do(ctx, func(*lua.State) error {
+		called = true
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) || called {
+		t.Errorf("expected %v without calling fn but got %v", context.Canceled, err)
+	}
+}
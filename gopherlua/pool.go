@@ -0,0 +1,63 @@
+// Package gopherlua pools *lua.LState instances of github.com/yuin/gopher-lua
+// with the same machinery as the go-lua pool (see package generic).
+package gopherlua
+
+import (
+	"context"
+
+	"github.com/epikur-io/go-lua-pool/generic"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// ensure interface is satisfied
+var _ generic.IPool[*lua.LState] = &Pool{}
+
+// Default factory function to create Lua states
+func NewLuaState() *lua.LState {
+	return lua.NewState()
+}
+
+// Pool of gopher-lua states. Released states get their stack cleared, closed
+// states are replaced and removed states are closed.
+type Pool struct {
+	*generic.Pool[*lua.LState]
+}
+
+// Creates a new pool of Lua states with the given size/capacity, factory
+// defaults to NewLuaState. opts are applied after the defaults, e.g. to add a
+// stricter validator.
+func NewPool(size int, factory func() *lua.LState, opts ...generic.Option[*lua.LState]) *Pool {
+	if factory == nil {
+		factory = NewLuaState
+	}
+	opts = append([]generic.Option[*lua.LState]{
+		generic.WithReset(func(l *lua.LState) { l.SetTop(0) }),
+		generic.WithValidator(func(l *lua.LState) bool { return !l.IsClosed() }),
+		generic.WithCloser(func(l *lua.LState) {
+			// closing twice panics
+			if !l.IsClosed() {
+				l.Close()
+			}
+		}),
+	}, opts...)
+	return &Pool{generic.New(size, factory, opts...)}
+}
+
+// Acquires a state, runs fn on it and releases the state again, even if fn
+// panics. ctx bounds both the wait for a state and the execution of Lua code
+// inside fn.
+func (p *Pool) Do(ctx context.Context, fn func(*lua.LState) error) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	l, err := p.AcquireWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer p.Release(l)
+	if ctx.Done() != nil {
+		l.SetContext(ctx)
+		defer l.RemoveContext()
+	}
+	return fn(l)
+}
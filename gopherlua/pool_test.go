@@ -0,0 +1,48 @@
+package gopherlua
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestPool(t *testing.T) {
+	p := NewPool(1, nil)
+	err := p.Do(context.Background(), func(l *lua.LState) error {
+		return l.DoString("answer = 42")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := p.Acquire()
+	if v := l.GetGlobal("answer"); v != lua.LNumber(42) {
+		t.Errorf("expected state to be reused but got %v", v)
+	}
+	l.Push(lua.LTrue)
+	l.Close()
+	p.Release(l)
+
+	// closed states are replaced
+	l = p.Acquire()
+	defer p.Release(l)
+	if l.IsClosed() || l.GetTop() != 0 || l.GetGlobal("answer") != lua.LNil {
+		t.Errorf("expected a fresh state")
+	}
+	if s := p.Stats(); s.InUse != 1 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+}
+
+func TestDoAbortsScript(t *testing.T) {
+	p := NewPool(1, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := p.Do(ctx, func(l *lua.LState) error {
+		return l.DoString("while true do end")
+	})
+	if err == nil {
+		t.Errorf("expected script to be aborted")
+	}
+}
@@ -0,0 +1,346 @@
+package pool
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	lua "github.com/epikur-io/go-lua"
+	"github.com/epikur-io/go-lua-pool/generic"
+)
+
+// Group lazily creates and holds pools keyed by name, e.g. one pool per tenant,
+// script bundle or environment. All pools share the size, factory and options
+// given to NewGroup unless a key is configured differently (see Configure and
+// SetProvider).
+type Group struct {
+	size    int
+	factory func() *lua.State
+	opts    []Option
+
+	mux   sync.Mutex
+	pools map[string]*list.Element
+	// pools by last use, most recent first
+	lru *list.List
+	// per-key configuration, see Configure
+	configs map[string]PoolConfig
+	// see SetProvider
+	provider func(key string) (PoolConfig, bool)
+	// pools of the VMs acquired by Acquire, which may be evicted meanwhile
+	owners map[*lua.State]*Pool
+	// see SetEviction
+	ttl      time.Duration
+	maxPools int
+	// see SetClock
+	clock generic.Clock
+	// see Close
+	closed bool
+}
+
+type groupEntry struct {
+	key      string
+	pool     *Pool
+	lastUsed time.Time
+}
+
+// Overrides of the group defaults for the pool of a key, zero values keep the
+// defaults
+type PoolConfig struct {
+	Size    int
+	Factory func() *lua.State
+	// default quota of the executions, see WithQuotaProfile
+	Quota *QuotaProfile
+	// applied after the options of the group
+	Options []Option
+}
+
+// Creates an empty group, pools are created by the first use of their key.
+// Fails like New with ErrInvalidSize if size is below 1 and with
+// ErrInvalidOption for invalid options.
+func NewGroup(size int, vmFactoryFunc func() *lua.State, opts ...Option) (*Group, error) {
+	if size < 1 {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidSize, size)
+	}
+	probe := &Pool{size: size, creator: vmFactoryFunc}
+	for _, opt := range opts {
+		opt(probe)
+	}
+	if err := probe.validate(); err != nil {
+		return nil, err
+	}
+	return &Group{
+		size:    size,
+		factory: vmFactoryFunc,
+		opts:    opts,
+		pools:   make(map[string]*list.Element),
+		lru:     list.New(),
+		configs: make(map[string]PoolConfig),
+		owners:  make(map[*lua.State]*Pool),
+		clock:   generic.SystemClock,
+	}, nil
+}
+
+// Sets the clock measuring the eviction ttl, the pools of the group use the
+// clock passed with WithClock
+func (g *Group) SetClock(clock generic.Clock) {
+	if clock == nil {
+		clock = generic.SystemClock
+	}
+	g.mux.Lock()
+	g.clock = clock
+	g.mux.Unlock()
+}
+
+// Sets the size of the pool of key and options applied after the shared ones.
+// Only affects pools created afterwards, a size of 0 keeps the shared size.
+// Takes precedence over the provider.
+func (g *Group) Configure(key string, size int, opts ...Option) {
+	g.ConfigureWith(key, PoolConfig{Size: size, Options: opts})
+}
+
+// Like Configure but with all overrides of PoolConfig
+func (g *Group) ConfigureWith(key string, cfg PoolConfig) {
+	g.mux.Lock()
+	g.configs[key] = cfg
+	g.mux.Unlock()
+}
+
+// Sets a callback returning the overrides for keys which aren't configured by
+// Configure, e.g. looked up from the plan of a tenant. Keys it returns false
+// for use the group defaults. It's called when a pool gets created, with the
+// group locked, so it must not use the group.
+func (g *Group) SetProvider(provider func(key string) (PoolConfig, bool)) {
+	g.mux.Lock()
+	g.provider = provider
+	g.mux.Unlock()
+}
+
+// Evicts pools which weren't used within ttl and the least recently used ones
+// beyond maxPools, so rarely active keys don't pin their idle VMs forever.
+// Pools with acquired VMs or waiting acquires are never evicted. Evicted pools
+// are closed, dropping their idle VMs, and recreated on their next use.
+// Eviction happens whenever a pool is looked up (see Evict), a ttl or maxPools
+// of 0 disables the respective limit.
+func (g *Group) SetEviction(ttl time.Duration, maxPools int) {
+	g.mux.Lock()
+	g.ttl, g.maxPools = ttl, maxPools
+	g.evict(g.clock.Now(), 0)
+	g.mux.Unlock()
+}
+
+// Evicts expired and surplus pools right away, returns the number of evicted
+// pools. Useful with a ticker if the group isn't used for a long time.
+func (g *Group) Evict() int {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	return g.evict(g.clock.Now(), 0)
+}
+
+// evicts idle pools which expired or exceed maxPools-reserve, requires g.mux
+func (g *Group) evict(now time.Time, reserve int) int {
+	evicted := 0
+	for e := g.lru.Back(); e != nil; {
+		prev := e.Prev()
+		entry := e.Value.(*groupEntry)
+		expired := g.ttl > 0 && now.Sub(entry.lastUsed) > g.ttl
+		surplus := g.maxPools > 0 && g.lru.Len()+reserve > g.maxPools
+		if !expired && !surplus {
+			// all other pools were used more recently
+			break
+		}
+		if s := entry.pool.Stats(); s.InUse == 0 && s.Waiting == 0 {
+			g.lru.Remove(e)
+			delete(g.pools, entry.key)
+			entry.pool.Close()
+			evicted++
+		}
+		e = prev
+	}
+	return evicted
+}
+
+// Returns the pool of key, creating it if necessary. Pools closed by their
+// user are replaced. After Close the returned pools are closed.
+func (g *Group) Pool(key string) *Pool {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	now := g.clock.Now()
+	if e, ok := g.pools[key]; ok {
+		if entry := e.Value.(*groupEntry); !entry.pool.Closed() {
+			entry.lastUsed = now
+			g.lru.MoveToFront(e)
+			g.evict(now, 0)
+			return entry.pool
+		}
+		g.lru.Remove(e)
+		delete(g.pools, key)
+	}
+	g.evict(now, 1)
+	size, factory, opts := g.size, g.factory, g.opts
+	cfg, ok := g.configs[key]
+	if !ok && g.provider != nil {
+		cfg, ok = g.provider(key)
+	}
+	if ok {
+		if cfg.Size > 0 {
+			size = cfg.Size
+		}
+		if cfg.Factory != nil {
+			factory = cfg.Factory
+		}
+		opts = opts[:len(opts):len(opts)]
+		if cfg.Quota != nil {
+			opts = append(opts, WithQuotaProfile(*cfg.Quota))
+		}
+		opts = append(opts, cfg.Options...)
+	}
+	p := NewPool(size, factory, opts...)
+	if g.closed {
+		p.Close()
+		return p
+	}
+	g.pools[key] = g.lru.PushFront(&groupEntry{key: key, pool: p, lastUsed: now})
+	return p
+}
+
+// Closes and removes all pools, VMs still acquired from them can be released.
+// Later uses of the group fail with ErrPoolClosed.
+func (g *Group) Close() {
+	g.mux.Lock()
+	g.closed = true
+	var pools []*Pool
+	for e := g.lru.Front(); e != nil; e = e.Next() {
+		pools = append(pools, e.Value.(*groupEntry).pool)
+	}
+	g.pools = make(map[string]*list.Element)
+	g.lru.Init()
+	g.mux.Unlock()
+	for _, p := range pools {
+		p.Close()
+	}
+}
+
+// true if acquiring from p failed because it was evicted meanwhile
+func (g *Group) evicted(p *Pool) bool {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	return !g.closed && p.Closed()
+}
+
+// Returns the pool of key if it exists
+func (g *Group) Lookup(key string) (*Pool, bool) {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	if e, ok := g.pools[key]; ok {
+		return e.Value.(*groupEntry).pool, true
+	}
+	return nil, false
+}
+
+// Removes the pool of key from the group, VMs still acquired from it can be
+// released to the returned pool
+func (g *Group) Remove(key string) (*Pool, bool) {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	e, ok := g.pools[key]
+	if !ok {
+		return nil, false
+	}
+	g.lru.Remove(e)
+	delete(g.pools, key)
+	return e.Value.(*groupEntry).pool, true
+}
+
+// Returns the sorted keys of the existing pools
+func (g *Group) Keys() []string {
+	g.mux.Lock()
+	keys := make([]string, 0, len(g.pools))
+	for key := range g.pools {
+		keys = append(keys, key)
+	}
+	g.mux.Unlock()
+	sort.Strings(keys)
+	return keys
+}
+
+// Acquires a VM from the pool of key (blocking), returns nil once the group
+// is closed
+func (g *Group) Acquire(key string) *lua.State {
+	for {
+		p := g.Pool(key)
+		vm := p.Acquire()
+		if vm != nil {
+			g.own(vm, p)
+			return vm
+		}
+		if !g.evicted(p) {
+			return nil
+		}
+	}
+}
+
+func (g *Group) AcquireWithContext(ctx context.Context, key string) (*lua.State, error) {
+	for {
+		p := g.Pool(key)
+		vm, err := p.AcquireWithContext(ctx)
+		if err == nil {
+			g.own(vm, p)
+			return vm, nil
+		}
+		if !errors.Is(err, ErrPoolClosed) || !g.evicted(p) {
+			return nil, err
+		}
+	}
+}
+
+func (g *Group) own(vm *lua.State, p *Pool) {
+	g.mux.Lock()
+	g.owners[vm] = p
+	g.mux.Unlock()
+}
+
+// Releases a VM acquired by Acquire to its pool
+func (g *Group) Release(vm *lua.State) {
+	g.mux.Lock()
+	p, ok := g.owners[vm]
+	delete(g.owners, vm)
+	g.mux.Unlock()
+	if ok {
+		p.Release(vm)
+	}
+}
+
+// Runs fn on a VM of the pool of key, see Pool.DoWithContext
+func (g *Group) Do(ctx context.Context, key string, fn func(*lua.State) error) error {
+	for {
+		p := g.Pool(key)
+		ran := false
+		err := p.DoWithContext(ctx, func(vm *lua.State) error {
+			ran = true
+			return fn(vm)
+		})
+		// retried if the pool was evicted before fn got a VM
+		if ran || !errors.Is(err, ErrPoolClosed) || !g.evicted(p) {
+			return err
+		}
+	}
+}
+
+// Returns the statistics of all pools by key
+func (g *Group) Stats() map[string]Stats {
+	g.mux.Lock()
+	pools := make(map[string]*Pool, len(g.pools))
+	for key, e := range g.pools {
+		pools[key] = e.Value.(*groupEntry).pool
+	}
+	g.mux.Unlock()
+	stats := make(map[string]Stats, len(pools))
+	for key, p := range pools {
+		stats[key] = p.Stats()
+	}
+	return stats
+}
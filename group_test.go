@@ -0,0 +1,153 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+func TestGroup(t *testing.T) {
+	g, err := NewGroup(2, nil, WithDeniedFunctions("os"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.Configure("b", 1, WithDeniedFunctions("string"))
+
+	for key, want := range map[string]string{"a": "nil table", "b": "nil nil"} {
+		err := g.Do(context.Background(), key, func(vm *lua.State) error {
+			if err := lua.DoString(vm, "return type(os) .. ' ' .. type(string)"); err != nil {
+				return err
+			}
+			if got, _ := vm.ToString(-1); got != want {
+				t.Errorf("%s: expected %q but got %q", key, want, got)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if keys := g.Keys(); !slices.Equal(keys, []string{"a", "b"}) {
+		t.Errorf("unexpected keys %v", keys)
+	}
+	if p := g.Pool("b"); p.Cap() != 1 {
+		t.Errorf("expected configured size 1 but got %d", p.Cap())
+	}
+
+	vm := g.Acquire("a")
+	if s := g.Stats()["a"]; s.InUse != 1 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+	g.Release(vm)
+	if p, ok := g.Remove("a"); !ok || p.Len() != 2 {
+		t.Errorf("expected removed pool to be returned")
+	}
+	if _, ok := g.Lookup("a"); ok {
+		t.Errorf("expected pool to be removed")
+	}
+}
+
+func TestGroupEviction(t *testing.T) {
+	g, err := NewGroup(1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.SetEviction(0, 2)
+	vm := g.Acquire("a")
+	g.Pool("b")
+	// a is busy, so b is evicted instead
+	g.Pool("c")
+	if keys := g.Keys(); !slices.Equal(keys, []string{"a", "c"}) {
+		t.Errorf("unexpected keys %v", keys)
+	}
+	g.Release(vm)
+	g.Pool("c")
+	g.Pool("d")
+	if keys := g.Keys(); !slices.Equal(keys, []string{"c", "d"}) {
+		t.Errorf("expected least recently used pool to be evicted but got %v", keys)
+	}
+
+	g.SetEviction(time.Millisecond, 0)
+	time.Sleep(5 * time.Millisecond)
+	g.Evict()
+	if keys := g.Keys(); len(keys) != 0 {
+		t.Errorf("expected expired pools to be evicted but got %v", keys)
+	}
+}
+
+func TestGroupClosesEvictedPools(t *testing.T) {
+	g, err := NewGroup(1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := g.Pool("a")
+	g.SetEviction(0, 1)
+	g.Pool("b")
+	if !a.Closed() {
+		t.Errorf("expected the evicted pool to be closed")
+	}
+	// recreated on the next use
+	if err := g.Do(context.Background(), "a", func(*lua.State) error { return nil }); err != nil {
+		t.Error(err)
+	}
+
+	b, _ := g.Lookup("a")
+	g.Close()
+	if !b.Closed() || len(g.Keys()) != 0 {
+		t.Errorf("expected all pools to be closed and removed")
+	}
+	if _, err := g.AcquireWithContext(context.Background(), "a"); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("expected %v but got %v", ErrPoolClosed, err)
+	}
+	if vm := g.Acquire("a"); vm != nil {
+		t.Errorf("expected no VM from a closed group")
+	}
+}
+
+func TestGroupProvider(t *testing.T) {
+	g, err := NewGroup(1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.SetProvider(func(key string) (PoolConfig, bool) {
+		if key != "premium" {
+			return PoolConfig{}, false
+		}
+		return PoolConfig{
+			Size:  4,
+			Quota: &QuotaProfile{Instructions: 100},
+			Factory: func() *lua.State {
+				vm := NewLuaVM()
+				lua.DoString(vm, "plan = 'premium'")
+				return vm
+			},
+		}, true
+	})
+	g.Configure("other", 2)
+
+	for key, want := range map[string]int{"free": 1, "premium": 4, "other": 2} {
+		if got := g.Pool(key).Cap(); got != want {
+			t.Errorf("%s: expected size %d but got %d", key, want, got)
+		}
+	}
+	res, err := g.Pool("premium").Eval(context.Background(), "return plan")
+	if err != nil || len(res) != 1 || res[0] != "premium" {
+		t.Errorf("expected VM of the provided factory but got %v, %v", res, err)
+	}
+	if _, err := g.Pool("premium").Eval(context.Background(), "while true do end"); !errors.Is(err, ErrInstructionLimit) {
+		t.Errorf("expected %v but got %v", ErrInstructionLimit, err)
+	}
+}
+
+func TestGroupValidation(t *testing.T) {
+	if _, err := NewGroup(0, nil); !errors.Is(err, ErrInvalidSize) {
+		t.Errorf("expected %v but got %v", ErrInvalidSize, err)
+	}
+	if _, err := NewGroup(1, nil, WithShards(-1)); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("expected %v but got %v", ErrInvalidOption, err)
+	}
+}
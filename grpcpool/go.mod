@@ -0,0 +1,19 @@
+module github.com/epikur-io/go-lua-pool/grpcpool
+
+go 1.22.3
+
+require (
+	github.com/epikur-io/go-lua v0.0.0-20250224085517-17039441b5fb
+	github.com/epikur-io/go-lua-pool v0.0.0-00010101000000-000000000000
+	google.golang.org/grpc v1.64.0
+)
+
+require (
+	golang.org/x/net v0.25.0 // indirect
+	golang.org/x/sys v0.20.0 // indirect
+	golang.org/x/text v0.15.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240318140521-94a12d6c2237 // indirect
+	google.golang.org/protobuf v1.34.1 // indirect
+)
+
+replace github.com/epikur-io/go-lua-pool => ../
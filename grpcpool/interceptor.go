@@ -0,0 +1,136 @@
+// Package grpcpool provides gRPC server interceptors attaching a pooled Lua VM
+// to the context of every RPC.
+package grpcpool
+
+import (
+	"context"
+	"time"
+
+	lua "github.com/epikur-io/go-lua"
+	pool "github.com/epikur-io/go-lua-pool"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Option configures the interceptors
+type Option func(*config)
+
+type config struct {
+	timeout  time.Duration
+	timeouts map[string]time.Duration
+	observe  func(method string, wait, held time.Duration, err error)
+}
+
+// Bounds every RPC, including the wait for a VM, to d unless a method has its
+// own timeout
+func WithTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.timeout = d
+	}
+}
+
+// Bounds the RPCs of the given full method name, e.g. "/pkg.Service/Method"
+func WithMethodTimeout(method string, d time.Duration) Option {
+	return func(c *config) {
+		c.timeouts[method] = d
+	}
+}
+
+// Reports every RPC with the time spent waiting for the VM, the time it was
+// held and the error of the acquire or the handler, e.g. to export metrics
+func WithObserver(observe func(method string, wait, held time.Duration, err error)) Option {
+	return func(c *config) {
+		c.observe = observe
+	}
+}
+
+func newConfig(opts []Option) *config {
+	c := &config{timeouts: make(map[string]time.Duration)}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// runs handler with a VM of p attached to its context
+func (c *config) run(ctx context.Context, p pool.IPool, method string, handler func(context.Context) error) error {
+	timeout, ok := c.timeouts[method]
+	if !ok {
+		timeout = c.timeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	lease, err := pool.NewLease(ctx, p)
+	wait := time.Since(start)
+	if err != nil {
+		err = acquireError(ctx, err)
+		if c.observe != nil {
+			c.observe(method, wait, 0, err)
+		}
+		return err
+	}
+	acquired := time.Now()
+	defer func() {
+		lease.Release()
+		if c.observe != nil {
+			c.observe(method, wait, time.Since(acquired), err)
+		}
+	}()
+	err = handler(pool.NewContext(ctx, lease))
+	return err
+}
+
+func acquireError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return status.FromContextError(ctx.Err()).Err()
+	}
+	return status.Error(codes.ResourceExhausted, err.Error())
+}
+
+// Returns a unary interceptor acquiring a VM of p for every RPC, which
+// handlers get by pool.FromContext or VM. The VM is released when the handler
+// returns, even if it panics. RPCs failing to get a VM in time end with
+// DeadlineExceeded or Canceled, other acquire errors with ResourceExhausted.
+func UnaryServerInterceptor(p pool.IPool, opts ...Option) grpc.UnaryServerInterceptor {
+	c := newConfig(opts)
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		var resp any
+		err := c.run(ctx, p, info.FullMethod, func(ctx context.Context) error {
+			var err error
+			resp, err = handler(ctx, req)
+			return err
+		})
+		return resp, err
+	}
+}
+
+// Like UnaryServerInterceptor for streaming RPCs, the VM is held for the whole
+// stream
+func StreamServerInterceptor(p pool.IPool, opts ...Option) grpc.StreamServerInterceptor {
+	c := newConfig(opts)
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return c.run(ss.Context(), p, info.FullMethod, func(ctx context.Context) error {
+			return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+		})
+	}
+}
+
+// ServerStream with the context carrying the VM
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// Returns the VM attached to the context of an RPC by the interceptors
+func VM(ctx context.Context) (*lua.State, bool) {
+	return pool.VMFromContext(ctx)
+}
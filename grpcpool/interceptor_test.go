@@ -0,0 +1,79 @@
+package grpcpool
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	pool "github.com/epikur-io/go-lua-pool"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type stream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *stream) Context() context.Context {
+	return s.ctx
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	p := pool.NewPool(1, nil)
+	var observed []error
+	interceptor := UnaryServerInterceptor(p,
+		WithMethodTimeout("/test.Service/Slow", 10*time.Millisecond),
+		WithObserver(func(method string, wait, held time.Duration, err error) {
+			observed = append(observed, err)
+		}),
+	)
+	errFailed := errors.New("failed")
+	handler := func(ctx context.Context, req any) (any, error) {
+		if _, ok := VM(ctx); !ok {
+			t.Error("expected VM in context")
+		}
+		return req, errFailed
+	}
+
+	resp, err := interceptor(context.Background(), "req", &grpc.UnaryServerInfo{FullMethod: "/test.Service/Fast"}, handler)
+	if resp != "req" || !errors.Is(err, errFailed) {
+		t.Errorf("unexpected result %v, %v", resp, err)
+	}
+	if s := p.Stats(); s.InUse != 0 {
+		t.Errorf("expected VM to be released but got %+v", s)
+	}
+
+	vm := p.Acquire()
+	defer p.Release(vm)
+	_, err = interceptor(context.Background(), "req", &grpc.UnaryServerInfo{FullMethod: "/test.Service/Slow"}, handler)
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("expected %s but got %v", codes.DeadlineExceeded, err)
+	}
+	if len(observed) != 2 || !errors.Is(observed[0], errFailed) || status.Code(observed[1]) != codes.DeadlineExceeded {
+		t.Errorf("unexpected observations %v", observed)
+	}
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	p := pool.NewPool(1, nil)
+	interceptor := StreamServerInterceptor(p)
+	err := interceptor(nil, &stream{ctx: context.Background()}, &grpc.StreamServerInfo{FullMethod: "/test.Service/Stream"},
+		func(srv any, ss grpc.ServerStream) error {
+			if _, ok := VM(ss.Context()); !ok {
+				t.Error("expected VM in stream context")
+			}
+			if s := p.Stats(); s.InUse != 1 {
+				t.Errorf("expected VM to be held but got %+v", s)
+			}
+			return nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := p.Stats(); s.InUse != 0 {
+		t.Errorf("expected VM to be released but got %+v", s)
+	}
+}
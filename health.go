@@ -0,0 +1,59 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	lua "github.com/epikur-io/go-lua"
+	"github.com/epikur-io/go-lua-pool/generic"
+)
+
+var ErrUnhealthy = fmt.Errorf("pool unhealthy")
+
+// deadline used by Healthy if the given context has none
+const defaultHealthTimeout = 5 * time.Second
+
+// Runs the given Lua code on a VM during every health check (see Healthy)
+func WithHealthCheckScript(code string) Option {
+	return func(p *Pool) {
+		p.healthScript = code
+	}
+}
+
+// Healthy verifies the pool is able to serve by acquiring and releasing a VM
+// within the deadline of ctx (5 seconds if ctx has none). If a health check
+// script is configured it is executed on the acquired VM as well.
+// Suitable for readiness probes, the returned error wraps ErrUnhealthy.
+func (p *Pool) Healthy(ctx context.Context) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = generic.ContextWithTimeout(ctx, p.clock, defaultHealthTimeout)
+		defer cancel()
+	}
+	vm, err := p.AcquireWithContext(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: acquire: %w", ErrUnhealthy, err)
+	}
+	defer p.Release(vm)
+	if p.healthScript == "" {
+		return nil
+	}
+	if err := runHealthScript(ctx, vm, p.healthScript); err != nil {
+		return fmt.Errorf("%w: script: %w", ErrUnhealthy, err)
+	}
+	return nil
+}
+
+func runHealthScript(ctx context.Context, vm *lua.State, code string) error {
+	top := vm.Top()
+	restore := bindContext(vm, ctx)
+	defer func() {
+		restore()
+		vm.SetTop(top)
+	}()
+	return lua.DoString(vm, code)
+}
@@ -0,0 +1,38 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHealthy(t *testing.T) {
+	lpool := NewPool(1, nil, WithHealthCheckScript("return 1 + 1"))
+	if err := lpool.Healthy(context.Background()); err != nil {
+		t.Fatalf("expected healthy pool but got %v", err)
+	}
+	if lpool.Len() != 1 {
+		t.Errorf("expected vm to be released after health check")
+	}
+}
+
+func TestHealthyExhaustedPool(t *testing.T) {
+	lpool := NewPool(1, nil)
+	lvm := lpool.Acquire()
+	defer lpool.Release(lvm)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := lpool.Healthy(ctx)
+	if !errors.Is(err, ErrUnhealthy) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected unhealthy deadline error but got %v", err)
+	}
+}
+
+func TestHealthyFailingScript(t *testing.T) {
+	lpool := NewPool(1, nil, WithHealthCheckScript("error('broken')"))
+	if err := lpool.Healthy(context.Background()); !errors.Is(err, ErrUnhealthy) {
+		t.Errorf("expected unhealthy error but got %v", err)
+	}
+}
@@ -0,0 +1,24 @@
+package pool
+
+import (
+	lua "github.com/epikur-io/go-lua"
+)
+
+// Suggested name of the global holding the VM ID, see WithVMIDGlobal
+const DefaultVMIDGlobal = "__POOL_VM_ID"
+
+// Stores the ID of every VM (see VMID) in the given global before preloads run,
+// so scripts can include it in their logs. An empty name disables it.
+func WithVMIDGlobal(name string) Option {
+	return func(p *Pool) {
+		p.idGlobal = name
+	}
+}
+
+// Returns the ID of a VM of the pool, unique among all pools of the process
+// and stable for the life of the VM. It is used by the debug logs and acquire
+// tracking.
+func (p *Pool) VMID(vm *lua.State) (uint64, bool) {
+	info, ok := p.core.Info(vm)
+	return info.ID, ok
+}
@@ -0,0 +1,52 @@
+package pool
+
+import (
+	"context"
+	"testing"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+func TestVMID(t *testing.T) {
+	lpool := NewPool(1, nil, WithVMIDGlobal(DefaultVMIDGlobal),
+		WithGlobalsSnapshot(true), WithReadOnlyGlobals(true))
+	lease, err := NewLease(context.Background(), lpool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, ok := lpool.VMID(lease.VM)
+	if !ok || id == 0 || lease.ID() != id {
+		t.Fatalf("expected the ID of the VM but got %d and %d", id, lease.ID())
+	}
+	if got := luaID(t, lease.VM); got != id {
+		t.Errorf("expected global %d but got %d", id, got)
+	}
+	lease.Release()
+
+	// survives releases, a replacement gets another ID
+	vm := lpool.Acquire()
+	if got := luaID(t, vm); got != id {
+		t.Errorf("expected global %d after release but got %d", id, got)
+	}
+	lpool.Release(vm)
+	lpool.Update()
+	vm = lpool.Acquire()
+	defer lpool.Release(vm)
+	if got, _ := lpool.VMID(vm); got == id || luaID(t, vm) != got {
+		t.Errorf("expected a new ID after the update")
+	}
+	if _, ok := lpool.VMID(NewLuaVM()); ok {
+		t.Errorf("expected no ID of a foreign VM")
+	}
+}
+
+func luaID(t *testing.T, vm *lua.State) uint64 {
+	t.Helper()
+	vm.Global(DefaultVMIDGlobal)
+	defer vm.Pop(1)
+	n, ok := vm.ToInteger(-1)
+	if !ok {
+		t.Fatalf("%s is not set", DefaultVMIDGlobal)
+	}
+	return uint64(n)
+}
@@ -0,0 +1,216 @@
+package pool
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	lua "github.com/epikur-io/go-lua"
+	"github.com/epikur-io/go-lua-pool/generic"
+)
+
+// Hooks are called by an InstrumentedPool, nil hooks are skipped
+type Hooks struct {
+	// called after every acquire with the time spent waiting, ctx is
+	// context.Background() for acquires without a context
+	Acquired func(ctx context.Context, vm *lua.State, wait time.Duration, err error)
+	// called after every release with the time the VM was held, which is 0 for
+	// VMs not acquired through the wrapper
+	Released func(vm *lua.State, held time.Duration, err error)
+}
+
+// InstrumentedPool decorates an IPool with hooks for metrics, tracing and
+// logging, see NewInstrumentedPool
+type InstrumentedPool struct {
+	IPool
+	hooks []Hooks
+	clock generic.Clock
+
+	// acquire times of the held VMs
+	acquired map[*lua.State]time.Time
+	mux      sync.Mutex
+}
+
+// ensure interface is satisfied
+var _ IPool = &InstrumentedPool{}
+var _ StatsProvider = &InstrumentedPool{}
+
+// Returns the stats of the wrapped pool, zero if it doesn't implement
+// StatsProvider
+func (ip *InstrumentedPool) Stats() Stats {
+	return statsOf(ip.IPool)
+}
+
+// Wraps p so that hooks observe all acquires and releases, which works for any
+// IPool implementation without modifying it. Wait and hold times are measured
+// by the clock of p if it is a *Pool, see SetClock.
+func NewInstrumentedPool(p IPool, hooks ...Hooks) *InstrumentedPool {
+	return &InstrumentedPool{
+		IPool:    p,
+		hooks:    hooks,
+		clock:    clockOf(p),
+		acquired: make(map[*lua.State]time.Time),
+	}
+}
+
+// Sets the clock measuring the wait and hold times, call it before the pool
+// is used
+func (ip *InstrumentedPool) SetClock(clock generic.Clock) {
+	if clock == nil {
+		clock = generic.SystemClock
+	}
+	ip.clock = clock
+}
+
+func (ip *InstrumentedPool) Acquire() *lua.State {
+	start := ip.clock.Now()
+	vm := ip.IPool.Acquire()
+	ip.acquiredHook(context.Background(), vm, start, nil)
+	return vm
+}
+
+func (ip *InstrumentedPool) AcquireWithTimeout(to time.Duration) (*lua.State, error) {
+	start := ip.clock.Now()
+	vm, err := ip.IPool.AcquireWithTimeout(to)
+	ip.acquiredHook(context.Background(), vm, start, err)
+	return vm, err
+}
+
+func (ip *InstrumentedPool) AcquireWithContext(ctx context.Context) (*lua.State, error) {
+	start := ip.clock.Now()
+	vm, err := ip.IPool.AcquireWithContext(ctx)
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ip.acquiredHook(ctx, vm, start, err)
+	return vm, err
+}
+
+func (ip *InstrumentedPool) Release(vm *lua.State) {
+	held := ip.held(vm)
+	ip.IPool.Release(vm)
+	ip.releasedHook(vm, held, nil)
+}
+
+func (ip *InstrumentedPool) TryRelease(vm *lua.State) error {
+	return ip.tryRelease(vm, ip.IPool.TryRelease)
+}
+
+func (ip *InstrumentedPool) TryReleaseWithContext(ctx context.Context, vm *lua.State) error {
+	return ip.tryRelease(vm, func(vm *lua.State) error {
+		return ip.IPool.TryReleaseWithContext(ctx, vm)
+	})
+}
+
+func (ip *InstrumentedPool) tryRelease(vm *lua.State, release func(*lua.State) error) error {
+	start, ok := ip.untrack(vm)
+	err := release(vm)
+	if err != nil && ok {
+		// still held by the caller
+		ip.mux.Lock()
+		ip.acquired[vm] = start
+		ip.mux.Unlock()
+	}
+	var held time.Duration
+	if ok {
+		held = ip.clock.Now().Sub(start)
+	}
+	ip.releasedHook(vm, held, err)
+	return err
+}
+
+func (ip *InstrumentedPool) acquiredHook(ctx context.Context, vm *lua.State, start time.Time, err error) {
+	now := ip.clock.Now()
+	if err == nil {
+		ip.mux.Lock()
+		ip.acquired[vm] = now
+		ip.mux.Unlock()
+	}
+	for _, h := range ip.hooks {
+		if h.Acquired != nil {
+			h.Acquired(ctx, vm, now.Sub(start), err)
+		}
+	}
+}
+
+func (ip *InstrumentedPool) releasedHook(vm *lua.State, held time.Duration, err error) {
+	for _, h := range ip.hooks {
+		if h.Released != nil {
+			h.Released(vm, held, err)
+		}
+	}
+}
+
+func (ip *InstrumentedPool) untrack(vm *lua.State) (time.Time, bool) {
+	ip.mux.Lock()
+	defer ip.mux.Unlock()
+	start, ok := ip.acquired[vm]
+	delete(ip.acquired, vm)
+	return start, ok
+}
+
+// returns for how long vm was held and forgets it
+func (ip *InstrumentedPool) held(vm *lua.State) time.Duration {
+	if start, ok := ip.untrack(vm); ok {
+		return ip.clock.Now().Sub(start)
+	}
+	return 0
+}
+
+// Counters maintained by MetricsHooks
+type Metrics struct {
+	Acquires        atomic.Uint64
+	AcquireFailures atomic.Uint64
+	Releases        atomic.Uint64
+	ReleaseFailures atomic.Uint64
+	// total time spent waiting for and holding VMs in nanoseconds
+	WaitTime atomic.Int64
+	HeldTime atomic.Int64
+}
+
+// Returns hooks counting acquires and releases in m
+func MetricsHooks(m *Metrics) Hooks {
+	return Hooks{
+		Acquired: func(_ context.Context, _ *lua.State, wait time.Duration, err error) {
+			m.WaitTime.Add(int64(wait))
+			if err != nil {
+				m.AcquireFailures.Add(1)
+				return
+			}
+			m.Acquires.Add(1)
+		},
+		Released: func(_ *lua.State, held time.Duration, err error) {
+			if err != nil {
+				m.ReleaseFailures.Add(1)
+				return
+			}
+			m.Releases.Add(1)
+			m.HeldTime.Add(int64(held))
+		},
+	}
+}
+
+// Returns hooks logging acquires and releases at debug level and failures at
+// warn level
+func LogHooks(logger *slog.Logger) Hooks {
+	return Hooks{
+		Acquired: func(ctx context.Context, _ *lua.State, wait time.Duration, err error) {
+			if err != nil {
+				logger.WarnContext(ctx, "lua pool: acquire failed",
+					slog.Duration("wait", wait),
+					slog.Any("error", err))
+				return
+			}
+			logger.DebugContext(ctx, "lua pool: vm acquired", slog.Duration("wait", wait))
+		},
+		Released: func(_ *lua.State, held time.Duration, err error) {
+			if err != nil {
+				logger.Warn("lua pool: release failed", slog.Any("error", err))
+				return
+			}
+			logger.Debug("lua pool: vm released", slog.Duration("held", held))
+		},
+	}
+}
@@ -0,0 +1,50 @@
+package pool
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInstrumentedPool(t *testing.T) {
+	var m Metrics
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	p := NewInstrumentedPool(NewPool(1, nil), MetricsHooks(&m), LogHooks(logger))
+
+	vm := p.Acquire()
+	if _, err := p.AcquireWithTimeout(10 * time.Millisecond); err == nil {
+		t.Errorf("expected acquire to time out")
+	}
+	time.Sleep(time.Millisecond)
+	if err := p.TryRelease(vm); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.TryRelease(vm); !errors.Is(err, ErrFailedToReleaseVM) {
+		t.Errorf("expected %v but got %v", ErrFailedToReleaseVM, err)
+	}
+	vm, err := p.AcquireWithContext(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Release(vm)
+
+	if m.Acquires.Load() != 2 || m.AcquireFailures.Load() != 1 || m.Releases.Load() != 2 || m.ReleaseFailures.Load() != 1 {
+		t.Errorf("unexpected metrics %d %d %d %d", m.Acquires.Load(), m.AcquireFailures.Load(), m.Releases.Load(), m.ReleaseFailures.Load())
+	}
+	if m.WaitTime.Load() < int64(10*time.Millisecond) || m.HeldTime.Load() < int64(time.Millisecond) {
+		t.Errorf("expected wait and held times to be recorded")
+	}
+	if s := p.Stats(); s.Idle != 1 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+	for _, msg := range []string{"vm acquired", "acquire failed", "vm released", "release failed"} {
+		if !strings.Contains(buf.String(), msg) {
+			t.Errorf("expected %q to be logged", msg)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package pool
+
+import (
+	"context"
+	"sync"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+// Lease is a VM acquired from a pool together with the pool it has to be
+// released to, so it can be passed around, e.g. in a context (see NewContext).
+type Lease struct {
+	VM   *lua.State
+	pool IPool
+	once sync.Once
+}
+
+// Acquires a VM of p bound to ctx
+func NewLease(ctx context.Context, p IPool) (*Lease, error) {
+	vm, err := p.AcquireWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Lease{VM: vm, pool: p}, nil
+}
+
+// Returns the VM to its pool, further calls are no-ops
+func (l *Lease) Release() {
+	l.once.Do(func() {
+		l.pool.Release(l.VM)
+	})
+}
+
+// Returns the ID of the VM (see Pool.VMID), 0 if the pool doesn't assign IDs
+func (l *Lease) ID() uint64 {
+	if p, ok := l.pool.(interface {
+		VMID(*lua.State) (uint64, bool)
+	}); ok {
+		id, _ := p.VMID(l.VM)
+		return id
+	}
+	return 0
+}
+
+type leaseKey struct{}
+
+// Returns a context carrying the lease, so deep call stacks can get the VM
+// without passing it through every function
+func NewContext(ctx context.Context, lease *Lease) context.Context {
+	return context.WithValue(ctx, leaseKey{}, lease)
+}
+
+// Returns the lease stored by NewContext
+func FromContext(ctx context.Context) (*Lease, bool) {
+	lease, ok := ctx.Value(leaseKey{}).(*Lease)
+	return lease, ok
+}
+
+// Returns the VM of the lease stored by NewContext
+func VMFromContext(ctx context.Context) (*lua.State, bool) {
+	if lease, ok := FromContext(ctx); ok {
+		return lease.VM, true
+	}
+	return nil, false
+}
@@ -0,0 +1,29 @@
+package pool
+
+import (
+	"context"
+	"testing"
+)
+
+func TestLeaseContext(t *testing.T) {
+	lpool := NewPool(1, nil)
+	lease, err := NewLease(context.Background(), lpool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := NewContext(context.Background(), lease)
+	if got, ok := FromContext(ctx); !ok || got != lease {
+		t.Errorf("expected lease in context")
+	}
+	if vm, ok := VMFromContext(ctx); !ok || vm != lease.VM {
+		t.Errorf("expected VM of the lease")
+	}
+	if _, ok := FromContext(context.Background()); ok {
+		t.Errorf("expected no lease")
+	}
+	lease.Release()
+	lease.Release()
+	if s := lpool.Stats(); s.Idle != 1 || s.InUse != 0 {
+		t.Errorf("expected a single release but got %+v", s)
+	}
+}
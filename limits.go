@@ -0,0 +1,180 @@
+package pool
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"time"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+var (
+	ErrInstructionLimit = fmt.Errorf("instruction limit exceeded")
+	ErrCPUQuota         = fmt.Errorf("cpu quota exceeded")
+	ErrExecTimeout      = fmt.Errorf("execution timeout")
+)
+
+// number of instructions between two CPU time samples
+const cpuSampleInterval = 10000
+
+// number of instructions between two hook calls when counting instructions for
+// an ExecResult
+const instructionCountInterval = 100
+
+// Limits the number of Lua instructions a single execution may run (Do,
+// DoWithContext, Eval, CallGlobal, Run, ...), independent of the speed of the
+// host. Exceeding the limit raises an error in the script which is returned as
+// ErrInstructionLimit, the VM is replaced afterwards. Instructions of Go
+// functions called by the script are not counted. 0 disables the limit.
+// Sets QuotaProfile.Instructions of the pool.
+func WithInstructionLimit(n int) Option {
+	return func(p *Pool) {
+		p.quota.Instructions = n
+	}
+}
+
+// Limits the CPU time a single execution may consume, see WithInstructionLimit
+// for the covered executions. Unlike a timeout, time spent waiting, e.g. in Go
+// functions doing IO, doesn't count. The CPU time of the executing thread is
+// sampled every few thousand instructions, so the quota is enforced with a
+// small delay; exceeding it returns ErrCPUQuota and the VM is replaced.
+// Thread CPU time is only available on Linux, other platforms fall back to
+// wall-clock time. 0 disables the quota. Sets QuotaProfile.CPUTime of the pool.
+func WithCPUQuota(d time.Duration) Option {
+	return func(p *Pool) {
+		p.quota.CPUTime = d
+	}
+}
+
+// count hook raising an error once an execution exceeds its quota
+type limitHook struct {
+	vm *lua.State
+	// instructions between two hook calls
+	interval int
+	executed int
+
+	instructionLimit int
+	cpuQuota         time.Duration
+	cpuStart         time.Duration
+
+	// the exceeded limit
+	violation error
+
+	// samples the call stack if set, see WithProfiling
+	profiler   *profiler
+	lastSample time.Time
+
+	// hook installed before
+	prev      lua.Hook
+	prevMask  byte
+	prevCount int
+}
+
+// installs the hook enforcing the limits of the quota, counting the executed
+// instructions if count is set and sampling the call stack for the profiler
+// unless it is nil, returns nil if there is nothing to do
+func installLimits(vm *lua.State, q QuotaProfile, count bool, prof *profiler) *limitHook {
+	if q.Instructions <= 0 && q.CPUTime <= 0 && !count && prof == nil {
+		return nil
+	}
+	h := &limitHook{
+		vm:               vm,
+		interval:         q.Instructions,
+		instructionLimit: q.Instructions,
+		cpuQuota:         q.CPUTime,
+		prev:             lua.DebugHook(vm),
+		prevMask:         lua.DebugHookMask(vm),
+		prevCount:        lua.DebugHookCount(vm),
+		profiler:         prof,
+	}
+	if h.cpuQuota > 0 {
+		if h.interval <= 0 || h.interval > cpuSampleInterval {
+			h.interval = cpuSampleInterval
+		}
+		// keep the execution on the thread whose CPU time is measured
+		runtime.LockOSThread()
+		h.cpuStart = threadCPUTime()
+	}
+	if count && (h.interval <= 0 || h.interval > instructionCountInterval) {
+		h.interval = instructionCountInterval
+	}
+	if prof != nil {
+		if h.interval <= 0 || h.interval > profileCheckInterval {
+			h.interval = profileCheckInterval
+		}
+		h.lastSample = time.Now()
+	}
+	lua.SetDebugHook(vm, h.hook, lua.MaskCount, h.interval)
+	return h
+}
+
+func (h *limitHook) hook(l *lua.State, _ lua.Debug) {
+	if h.violation == nil {
+		h.executed += h.interval
+		if h.profiler != nil {
+			if now := time.Now(); now.Sub(h.lastSample) >= h.profiler.interval {
+				h.lastSample = now
+				h.profiler.sample(l)
+			}
+		}
+		switch {
+		case h.instructionLimit > 0 && h.executed >= h.instructionLimit:
+			h.violation = ErrInstructionLimit
+		case h.cpuQuota > 0 && threadCPUTime()-h.cpuStart > h.cpuQuota:
+			h.violation = ErrCPUQuota
+		default:
+			return
+		}
+		// fail on every further instruction so scripts can't recover by pcall
+		lua.SetDebugHook(l, h.hook, lua.MaskCount, 1)
+	}
+	lua.Errorf(l, "%s", h.violation.Error())
+}
+
+// restores the previous hook
+func (h *limitHook) restore() {
+	lua.SetDebugHook(h.vm, h.prev, h.prevMask, h.prevCount)
+	if h.cpuQuota > 0 {
+		runtime.UnlockOSThread()
+	}
+}
+
+// ViolationPolicy decides what happens to a VM after an execution violated its quota
+type ViolationPolicy int
+
+const (
+	// the VM is discarded and replaced by a new one in the background (default)
+	RecycleVM ViolationPolicy = iota
+	// the VM is returned to the pool and reused
+	ReuseVM
+)
+
+// quota violations interrupting a running script
+var violations = []error{ErrInstructionLimit, ErrCPUQuota, ErrExecTimeout}
+
+// Sets the policy for VMs interrupted by the given violation, which is one of
+// ErrInstructionLimit, ErrCPUQuota or ErrExecTimeout. Interrupted scripts may leave
+// globals and other VM state half updated, so reuse VMs only if the scripts
+// can cope with that.
+func WithViolationPolicy(violation error, policy ViolationPolicy) Option {
+	return func(p *Pool) {
+		if p.violationPolicies == nil {
+			p.violationPolicies = make(map[error]ViolationPolicy)
+		}
+		p.violationPolicies[violation] = policy
+	}
+}
+
+// true if a VM must be replaced after an execution failed with err
+func (p *Pool) mustRecycle(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, v := range violations {
+		if errors.Is(err, v) {
+			return p.violationPolicies[v] == RecycleVM
+		}
+	}
+	return false
+}
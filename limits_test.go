@@ -0,0 +1,97 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+func TestInstructionLimit(t *testing.T) {
+	lpool := NewPool(1, nil, WithInstructionLimit(10000))
+	lvm := lpool.Acquire()
+	lpool.Release(lvm)
+	ctx := context.Background()
+
+	for _, code := range []string{
+		"while true do end",
+		// catching the error doesn't help
+		"while true do pcall(function() while true do end end) end",
+	} {
+		if _, err := lpool.Eval(ctx, code); !errors.Is(err, ErrInstructionLimit) {
+			t.Errorf("%s: expected instruction limit error but got %v", code, err)
+		}
+	}
+	if results, err := lpool.Eval(ctx, "local n = 0 for i = 1, 100 do n = n + i end return n"); err != nil || !reflect.DeepEqual(results, []any{5050.0}) {
+		t.Errorf("expected 5050 but got %v, %v", results, err)
+	}
+
+	vm := lpool.Acquire()
+	defer lpool.Release(vm)
+	if vm == lvm {
+		t.Errorf("expected the VM to be replaced after exceeding the limit")
+	}
+}
+
+func TestCPUQuota(t *testing.T) {
+	lpool := NewPool(1, func() *lua.State {
+		vm := NewLuaVM()
+		vm.Register("sleep", func(l *lua.State) int {
+			time.Sleep(30 * time.Millisecond)
+			return 0
+		})
+		return vm
+	}, WithCPUQuota(50*time.Millisecond))
+	ctx := context.Background()
+
+	if _, err := lpool.Eval(ctx, "while true do end"); !errors.Is(err, ErrCPUQuota) {
+		t.Errorf("expected cpu quota error but got %v", err)
+	}
+	if runtime.GOOS == "linux" {
+		// waiting doesn't consume CPU time
+		if _, err := lpool.Eval(ctx, "for i = 1, 3 do sleep() for j = 1, 10000 do end end"); err != nil {
+			t.Errorf("expected sleeping script to pass but got %v", err)
+		}
+	}
+}
+
+func TestViolationPolicy(t *testing.T) {
+	lpool := NewPool(1, nil,
+		WithInstructionLimit(10000),
+		WithViolationPolicy(ErrInstructionLimit, ReuseVM),
+	)
+	lvm := lpool.Acquire()
+	lpool.Release(lvm)
+	ctx := context.Background()
+
+	if _, err := lpool.Eval(ctx, "while true do end"); !errors.Is(err, ErrInstructionLimit) {
+		t.Errorf("expected instruction limit error but got %v", err)
+	}
+	vm := lpool.Acquire()
+	lpool.Release(vm)
+	if vm != lvm {
+		t.Errorf("expected the VM to be reused")
+	}
+	// the limit still applies to the reused VM
+	if _, err := lpool.Eval(ctx, "while true do end"); !errors.Is(err, ErrInstructionLimit) {
+		t.Errorf("expected instruction limit error but got %v", err)
+	}
+	if results, err := lpool.Eval(ctx, "return 1"); err != nil || !reflect.DeepEqual(results, []any{1.0}) {
+		t.Errorf("expected 1 but got %v, %v", results, err)
+	}
+
+	// timeouts are still recycled
+	ctx = ContextWithQuota(ctx, QuotaProfile{Timeout: 10 * time.Millisecond})
+	if _, err := lpool.Eval(ctx, "while true do end"); !errors.Is(err, ErrExecTimeout) {
+		t.Errorf("expected timeout but got %v", err)
+	}
+	vm = lpool.Acquire()
+	defer lpool.Release(vm)
+	if vm == lvm {
+		t.Errorf("expected the VM to be replaced after the timeout")
+	}
+}
@@ -0,0 +1,139 @@
+// Package luajson provides a Go implemented json module for Lua VMs.
+//
+//	local json = require("json")
+//	local s = json.encode({ name = "lua", list = {1, 2, 3} })
+//	local t = json.decode(s)
+//
+// Empty tables are encoded as objects, JSON null values decode to nil.
+package luajson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	lua "github.com/epikur-io/go-lua"
+	pool "github.com/epikur-io/go-lua-pool"
+)
+
+// name used by Preload
+const ModuleName = "json"
+
+// Options limit the work done by the module
+type Options struct {
+	// maximum nesting of encoded and decoded values
+	MaxDepth int
+	// maximum number of table entries to encode
+	MaxItems int
+	// maximum size in bytes of encoded output and decoded input
+	MaxSize int
+}
+
+var DefaultOptions = Options{
+	MaxDepth: 64,
+	MaxItems: 1 << 16,
+	MaxSize:  8 << 20,
+}
+
+// Loader opens the module with DefaultOptions
+var Loader = NewLoader(DefaultOptions)
+
+// Returns a loader opening the module with the given options, zero values fall
+// back to DefaultOptions
+func NewLoader(opts Options) lua.Function {
+	if opts.MaxDepth <= 0 {
+		opts.MaxDepth = DefaultOptions.MaxDepth
+	}
+	if opts.MaxItems <= 0 {
+		opts.MaxItems = DefaultOptions.MaxItems
+	}
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = DefaultOptions.MaxSize
+	}
+	m := &module{opts: opts}
+	return func(l *lua.State) int {
+		lua.NewLibrary(l, []lua.RegistryFunction{
+			{Name: "encode", Function: m.encode},
+			{Name: "decode", Function: m.decode},
+		})
+		return 1
+	}
+}
+
+// Makes the module with DefaultOptions available to require("json")
+func Preload(vm *lua.State) {
+	PreloadWithOptions(vm, DefaultOptions)
+}
+
+// Makes the module with the given options available to require("json")
+func PreloadWithOptions(vm *lua.State, opts Options) {
+	lua.SubTable(vm, lua.RegistryIndex, "_PRELOAD")
+	vm.PushGoFunction(NewLoader(opts))
+	vm.SetField(-2, ModuleName)
+	vm.Pop(1)
+}
+
+type module struct {
+	opts Options
+}
+
+func (m *module) encode(l *lua.State) int {
+	lua.CheckAny(l, 1)
+	limits := pool.ConvertLimits{
+		MaxDepth:     m.opts.MaxDepth,
+		MaxItems:     m.opts.MaxItems,
+		MaxStringLen: m.opts.MaxSize,
+	}
+	v, err := limits.ToValue(l, 1)
+	if err != nil {
+		lua.Errorf(l, "json.encode: %s", err.Error())
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		lua.Errorf(l, "json.encode: %s", err.Error())
+	}
+	if len(data) > m.opts.MaxSize {
+		lua.Errorf(l, "json.encode: output exceeds %d bytes", m.opts.MaxSize)
+	}
+	l.PushString(string(data))
+	return 1
+}
+
+func (m *module) decode(l *lua.State) int {
+	s := lua.CheckString(l, 1)
+	if len(s) > m.opts.MaxSize {
+		lua.Errorf(l, "json.decode: input exceeds %d bytes", m.opts.MaxSize)
+	}
+	if err := checkDepth([]byte(s), m.opts.MaxDepth); err != nil {
+		lua.Errorf(l, "json.decode: %s", err.Error())
+	}
+	var v any
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		lua.Errorf(l, "json.decode: %s", err.Error())
+	}
+	if err := pool.PushValue(l, v); err != nil {
+		lua.Errorf(l, "json.decode: %s", err.Error())
+	}
+	return 1
+}
+
+// rejects documents nested deeper than max before decoding them
+func checkDepth(data []byte, max int) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			// syntax errors are reported by json.Unmarshal
+			return nil
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			if depth++; depth > max {
+				return fmt.Errorf("nesting exceeds %d levels", max)
+			}
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+	}
+}
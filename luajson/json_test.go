@@ -0,0 +1,48 @@
+package luajson
+
+import (
+	"strings"
+	"testing"
+
+	lua "github.com/epikur-io/go-lua"
+	pool "github.com/epikur-io/go-lua-pool"
+)
+
+func newVM(opts Options) *lua.State {
+	vm := pool.NewLuaVM()
+	PreloadWithOptions(vm, opts)
+	return vm
+}
+
+func TestEncodeDecode(t *testing.T) {
+	vm := newVM(DefaultOptions)
+	err := lua.DoString(vm, `
+		local json = require("json")
+		local s = json.encode({ name = "lua", list = {1, 2, 3}, flag = true })
+		local t = json.decode(s)
+		assert(t.name == "lua", "name")
+		assert(#t.list == 3 and t.list[3] == 3, "list")
+		assert(t.flag == true, "flag")
+		assert(json.encode({1, "a"}) == '[1,"a"]', "array")
+		assert(json.decode("null") == nil, "null")
+	`)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	vm := newVM(Options{MaxDepth: 2, MaxSize: 32})
+	for _, code := range []string{
+		`require("json").encode({ a = { b = { c = 1 } } })`,
+		`require("json").encode({ string.rep("x", 64) })`,
+		`require("json").decode('[[[1]]]')`,
+		`require("json").decode('"` + strings.Repeat("x", 64) + `"')`,
+		`require("json").decode('{broken')`,
+		`require("json").encode(print)`,
+	} {
+		if err := lua.DoString(vm, code); err == nil {
+			t.Errorf("expected error for %s", code)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package pool
+
+import (
+	"context"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+// Runs fn on the idle VMs of the pool for maintenance, e.g. garbage collection,
+// trimming caches or collecting metrics. The VMs are checked out one at a time
+// and returned as they are, so busy VMs are skipped and at most one VM is
+// withheld from acquirers at any time. fn runs like in DoWithContext. Stops
+// once ctx is done or at the first error of fn and returns that error.
+func (p *Pool) ForEachIdle(ctx context.Context, fn func(*lua.State) error) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	q := p.quotaFor(ctx, "")
+	return p.core.ForEachIdle(ctx, func(vm *lua.State) error {
+		return p.exec(ctx, vm, q, nil, fn)
+	})
+}
@@ -0,0 +1,48 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+func TestForEachIdle(t *testing.T) {
+	lpool := NewPool(3, nil)
+	held := lpool.Acquire()
+	seen := make(map[*lua.State]bool)
+	err := lpool.ForEachIdle(context.Background(), func(vm *lua.State) error {
+		seen[vm] = true
+		vm.PushString("left behind")
+		return nil
+	})
+	if err != nil || len(seen) != 2 || seen[held] {
+		t.Errorf("expected the 2 idle VMs but got %d, %v", len(seen), err)
+	}
+	lpool.Release(held)
+	if s := lpool.Stats(); s.Idle != 3 || s.InUse != 0 {
+		t.Errorf("expected all VMs to be idle but got %+v", s)
+	}
+	for vm := range seen {
+		if vm.Top() != 0 {
+			t.Errorf("expected a clean stack")
+		}
+	}
+
+	errStop := errors.New("stop")
+	n := 0
+	err = lpool.ForEachIdle(context.Background(), func(*lua.State) error {
+		n++
+		return errStop
+	})
+	if !errors.Is(err, errStop) || n != 1 {
+		t.Errorf("expected to stop at the first error but got %v after %d VMs", err, n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := lpool.ForEachIdle(ctx, func(*lua.State) error { return nil }); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v but got %v", context.Canceled, err)
+	}
+}
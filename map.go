@@ -0,0 +1,58 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+var ErrPanic = fmt.Errorf("panic while using VM")
+
+// Calls fn for every item on a pooled VM with at most concurrency calls at a
+// time (defaults to the pool capacity) and returns the results in the order of
+// the items. Lua code run by fn is aborted once ctx is done and items not
+// started yet are skipped. Panics in fn are recovered and reported as
+// ErrPanic. The returned error joins the errors of all failed items, their
+// results are left as zero values.
+func Map[T, R any](ctx context.Context, p *Pool, items []T, fn func(*lua.State, T) (R, error), concurrency int) ([]R, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if concurrency <= 0 {
+		concurrency = p.Cap()
+	}
+	results := make([]R, len(items))
+	errs := make([]error, len(items))
+	skipped := make([]bool, len(items))
+	fanOut(len(items), concurrency, func(i int) {
+		if ctx.Err() != nil {
+			skipped[i] = true
+			return
+		}
+		errs[i] = p.DoWithContext(ctx, func(vm *lua.State) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("%w: %v", ErrPanic, r)
+				}
+			}()
+			results[i], err = fn(vm, items[i])
+			return err
+		})
+	})
+
+	var joined []error
+	for i, err := range errs {
+		if err != nil {
+			joined = append(joined, fmt.Errorf("item %d: %w", i, err))
+		}
+	}
+	for _, s := range skipped {
+		if s {
+			joined = append(joined, ctx.Err())
+			break
+		}
+	}
+	return results, errors.Join(joined...)
+}
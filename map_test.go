@@ -0,0 +1,63 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+func TestMap(t *testing.T) {
+	lpool := NewPool(2, nil)
+	square := func(vm *lua.State, n int) (int, error) {
+		if err := lua.LoadString(vm, "local n = ... return n * n"); err != nil {
+			return 0, err
+		}
+		vm.PushInteger(n)
+		vm.Call(1, 1)
+		r, _ := vm.ToInteger(-1)
+		return r, nil
+	}
+	results, err := Map(context.Background(), lpool, []int{1, 2, 3, 4, 5}, square, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(results, []int{1, 4, 9, 16, 25}) {
+		t.Errorf("unexpected results %v", results)
+	}
+}
+
+func TestMapErrors(t *testing.T) {
+	lpool := NewPool(2, nil)
+	failing := errors.New("failing")
+	results, err := Map(context.Background(), lpool, []int{1, 2, 3}, func(vm *lua.State, n int) (int, error) {
+		switch n {
+		case 1:
+			return 0, failing
+		case 2:
+			panic("boom")
+		}
+		return n, nil
+	}, 1)
+	if !errors.Is(err, failing) || !errors.Is(err, ErrPanic) {
+		t.Errorf("expected joined errors but got %v", err)
+	}
+	if !reflect.DeepEqual(results, []int{0, 0, 3}) {
+		t.Errorf("unexpected results %v", results)
+	}
+	// VMs are returned after panics
+	if s := lpool.Stats(); s.Idle != 2 {
+		t.Errorf("expected all VMs to be idle but got %+v", s)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Map(ctx, lpool, []int{1, 2}, func(vm *lua.State, n int) (int, error) {
+		t.Error("canceled items must not run")
+		return n, nil
+	}, 1); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context canceled but got %v", err)
+	}
+}
@@ -0,0 +1,302 @@
+package pool
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+// Pushes a Go value onto the Lua stack.
+//
+// Booleans, numbers and strings are pushed as the matching Lua types, []byte as
+// string, nil pointers, interfaces, maps and slices as nil and lua.Function as Go
+// function. Slices and arrays become sequences, maps with string, number or bool
+// keys become tables. Structs become tables of their exported fields, the field
+// name can be changed by a `lua:"name"` tag, `lua:"-"` skips the field and the
+// omitempty option skips zero values (e.g. `lua:"name,omitempty"`). Fields of
+// embedded structs are promoted like in encoding/json.
+func PushValue(vm *lua.State, v any) error {
+	return pushValue(vm, v, 0)
+}
+
+func pushValue(vm *lua.State, v any, depth int) error {
+	if !vm.CheckStack(3) {
+		return errStackOverflow
+	}
+	// fast paths for the most common types
+	switch v := v.(type) {
+	case nil:
+		vm.PushNil()
+		return nil
+	case bool:
+		vm.PushBoolean(v)
+		return nil
+	case int:
+		vm.PushInteger(v)
+		return nil
+	case float64:
+		vm.PushNumber(v)
+		return nil
+	case string:
+		vm.PushString(v)
+		return nil
+	case []byte:
+		vm.PushString(string(v))
+		return nil
+	case lua.Function:
+		vm.PushGoFunction(v)
+		return nil
+	case []any:
+		if err := checkDepth(depth); err != nil {
+			return err
+		}
+		vm.CreateTable(len(v), 0)
+		for i, e := range v {
+			if err := pushValue(vm, e, depth+1); err != nil {
+				vm.Pop(1)
+				return err
+			}
+			vm.RawSetInt(-2, i+1)
+		}
+		return nil
+	case map[string]any:
+		if err := checkDepth(depth); err != nil {
+			return err
+		}
+		vm.CreateTable(0, len(v))
+		for k, e := range v {
+			vm.PushString(k)
+			if err := pushValue(vm, e, depth+1); err != nil {
+				vm.Pop(2)
+				return err
+			}
+			vm.RawSet(-3)
+		}
+		return nil
+	}
+	return pushReflect(vm, reflect.ValueOf(v), depth)
+}
+
+func pushReflect(vm *lua.State, rv reflect.Value, depth int) error {
+	if !vm.CheckStack(3) {
+		return errStackOverflow
+	}
+	switch rv.Kind() {
+	case reflect.Invalid:
+		vm.PushNil()
+	case reflect.Bool:
+		vm.PushBoolean(rv.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		vm.PushNumber(float64(rv.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		vm.PushNumber(float64(rv.Uint()))
+	case reflect.Float32, reflect.Float64:
+		vm.PushNumber(rv.Float())
+	case reflect.String:
+		vm.PushString(rv.String())
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			vm.PushNil()
+			return nil
+		}
+		if err := checkDepth(depth); err != nil {
+			return err
+		}
+		return pushReflect(vm, rv.Elem(), depth+1)
+	case reflect.Func:
+		f, ok := rv.Interface().(lua.Function)
+		if !ok {
+			if !rv.Type().ConvertibleTo(luaFunctionType) {
+				return fmt.Errorf("%w: %s", ErrUnsupportedType, rv.Type())
+			}
+			f = rv.Convert(luaFunctionType).Interface().(lua.Function)
+		}
+		if f == nil {
+			vm.PushNil()
+			return nil
+		}
+		vm.PushGoFunction(f)
+	case reflect.Slice:
+		if rv.IsNil() {
+			vm.PushNil()
+			return nil
+		}
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			vm.PushString(string(rv.Bytes()))
+			return nil
+		}
+		return pushSequence(vm, rv, depth)
+	case reflect.Array:
+		return pushSequence(vm, rv, depth)
+	case reflect.Map:
+		if rv.IsNil() {
+			vm.PushNil()
+			return nil
+		}
+		return pushMap(vm, rv, depth)
+	case reflect.Struct:
+		return pushStruct(vm, rv, depth)
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedType, rv.Type())
+	}
+	return nil
+}
+
+var luaFunctionType = reflect.TypeOf(lua.Function(nil))
+
+func pushSequence(vm *lua.State, rv reflect.Value, depth int) error {
+	if err := checkDepth(depth); err != nil {
+		return err
+	}
+	vm.CreateTable(rv.Len(), 0)
+	for i := 0; i < rv.Len(); i++ {
+		if err := pushReflect(vm, rv.Index(i), depth+1); err != nil {
+			vm.Pop(1)
+			return err
+		}
+		vm.RawSetInt(-2, i+1)
+	}
+	return nil
+}
+
+func pushMap(vm *lua.State, rv reflect.Value, depth int) error {
+	if err := checkDepth(depth); err != nil {
+		return err
+	}
+	switch rv.Type().Key().Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+	default:
+		return fmt.Errorf("%w: map key %s", ErrUnsupportedType, rv.Type().Key())
+	}
+	vm.CreateTable(0, rv.Len())
+	iter := rv.MapRange()
+	for iter.Next() {
+		if err := pushReflect(vm, iter.Key(), depth+1); err != nil {
+			vm.Pop(1)
+			return err
+		}
+		if err := pushReflect(vm, iter.Value(), depth+1); err != nil {
+			vm.Pop(2)
+			return err
+		}
+		vm.RawSet(-3)
+	}
+	return nil
+}
+
+func pushStruct(vm *lua.State, rv reflect.Value, depth int) error {
+	if err := checkDepth(depth); err != nil {
+		return err
+	}
+	fields := structFields(rv.Type())
+	vm.CreateTable(0, len(fields))
+	for _, f := range fields {
+		fv, err := rv.FieldByIndexErr(f.index)
+		if err != nil {
+			// field of a nil embedded pointer
+			continue
+		}
+		if f.omitEmpty && fv.IsZero() {
+			continue
+		}
+		if err := pushReflect(vm, fv, depth+1); err != nil {
+			vm.Pop(1)
+			return err
+		}
+		vm.SetField(-2, f.name)
+	}
+	return nil
+}
+
+func checkDepth(depth int) error {
+	if depth >= maxConvertDepth {
+		return fmt.Errorf("%w: nesting exceeds %d levels", ErrLimitExceeded, maxConvertDepth)
+	}
+	return nil
+}
+
+// a struct field converted from or to a Lua table field
+type structField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+var structFieldCache sync.Map // map[reflect.Type][]structField
+
+// returns the exported fields of a struct type including promoted fields of
+// embedded structs, fields of outer structs shadow fields of embedded ones
+func structFields(t reflect.Type) []structField {
+	if cached, ok := structFieldCache.Load(t); ok {
+		return cached.([]structField)
+	}
+	var fields []structField
+	seen := make(map[string]bool)
+	collectStructFields(t, nil, seen, &fields, 0)
+	structFieldCache.Store(t, fields)
+	return fields
+}
+
+func collectStructFields(t reflect.Type, index []int, seen map[string]bool, fields *[]structField, depth int) {
+	var embedded []reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("lua")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if sf.Anonymous && name == "" {
+			ft := sf.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				// promoted fields are collected after the fields of this level
+				embedded = append(embedded, sf)
+				continue
+			}
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		*fields = append(*fields, structField{
+			name:      name,
+			index:     append(append([]int(nil), index...), i),
+			omitEmpty: opts == "omitempty",
+		})
+	}
+	if depth >= maxConvertDepth {
+		return
+	}
+	for _, sf := range embedded {
+		ft := sf.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		collectStructFields(ft, append(append([]int(nil), index...), sf.Index...), seen, fields, depth+1)
+	}
+}
+
+// Converts v to a Lua value (see PushValue) and assigns it to the global name,
+// e.g. to preload configuration in a VM factory.
+func SetGlobal(vm *lua.State, name string, v any) error {
+	if err := PushValue(vm, v); err != nil {
+		return err
+	}
+	vm.SetGlobal(name)
+	return nil
+}
@@ -0,0 +1,103 @@
+package pool
+
+import (
+	"errors"
+	"testing"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+type testBase struct {
+	ID      int
+	Created string `lua:"created"`
+}
+
+type testConfig struct {
+	testBase
+	Name     string            `lua:"name"`
+	Port     uint16            `lua:"port"`
+	Ratio    float32           `lua:"ratio"`
+	Tags     []string          `lua:"tags"`
+	Limits   map[string]int    `lua:"limits"`
+	Backends map[int]*testBase `lua:"backends"`
+	Empty    string            `lua:"empty,omitempty"`
+	Secret   string            `lua:"-"`
+	Enabled  bool
+	internal int
+}
+
+func TestPushValueStruct(t *testing.T) {
+	vm := NewLuaVM()
+	cfg := testConfig{
+		testBase: testBase{ID: 7, Created: "today"},
+		Name:     "api",
+		Port:     8080,
+		Ratio:    0.5,
+		Tags:     []string{"a", "b"},
+		Limits:   map[string]int{"rps": 100},
+		Backends: map[int]*testBase{1: {ID: 1}, 2: nil},
+		Secret:   "hidden",
+		Enabled:  true,
+		internal: 1,
+	}
+	if err := SetGlobal(vm, "cfg", cfg); err != nil {
+		t.Fatal(err)
+	}
+	err := lua.DoString(vm, `
+		assert(cfg.ID == 7, "ID")
+		assert(cfg.created == "today", "created")
+		assert(cfg.name == "api", "name")
+		assert(cfg.port == 8080, "port")
+		assert(cfg.ratio == 0.5, "ratio")
+		assert(#cfg.tags == 2 and cfg.tags[2] == "b", "tags")
+		assert(cfg.limits.rps == 100, "limits")
+		assert(cfg.backends[1].ID == 1 and cfg.backends[2] == nil, "backends")
+		assert(cfg.empty == nil, "empty")
+		assert(cfg.Secret == nil and cfg.secret == nil, "secret")
+		assert(cfg.Enabled == true, "Enabled")
+		assert(cfg.internal == nil, "internal")
+	`)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPushValuePointerAndNil(t *testing.T) {
+	vm := NewLuaVM()
+	var nilMap map[string]int
+	for _, v := range []any{(*testBase)(nil), nilMap, []int(nil)} {
+		if err := PushValue(vm, v); err != nil {
+			t.Fatal(err)
+		}
+		if !vm.IsNil(-1) {
+			t.Errorf("expected nil for %#v", v)
+		}
+		vm.Pop(1)
+	}
+	if err := PushValue(vm, &testBase{ID: 3}); err != nil {
+		t.Fatal(err)
+	}
+	vm.Field(-1, "ID")
+	if id, _ := vm.ToInteger(-1); id != 3 {
+		t.Errorf("expected ID 3 but got %d", id)
+	}
+}
+
+func TestPushValueErrors(t *testing.T) {
+	vm := NewLuaVM()
+	if err := PushValue(vm, make(chan int)); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("expected %v but got %v", ErrUnsupportedType, err)
+	}
+	if err := PushValue(vm, map[testBase]int{{}: 1}); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("expected %v but got %v", ErrUnsupportedType, err)
+	}
+	type node struct{ Next *node }
+	n := &node{}
+	n.Next = n
+	if err := PushValue(vm, n); err == nil {
+		t.Errorf("expected nesting error for cyclic value")
+	}
+	if vm.Top() != 0 {
+		t.Errorf("expected clean stack after errors but got %d values", vm.Top())
+	}
+}
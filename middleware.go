@@ -0,0 +1,22 @@
+package pool
+
+import "net/http"
+
+// Returns net/http middleware acquiring a VM from p for every request, which
+// handlers get by FromContext(r.Context()) or VMFromContext. The VM is
+// released once the handler returned, even if it panics. The acquire is bound
+// to the request context, so it honors its deadline; requests without a VM are
+// answered with 503 Service Unavailable.
+func Middleware(p IPool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lease, err := NewLease(r.Context(), p)
+			if err != nil {
+				http.Error(w, "no Lua VM available", http.StatusServiceUnavailable)
+				return
+			}
+			defer lease.Release()
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), lease)))
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package pool
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+func TestMiddleware(t *testing.T) {
+	lpool := NewPool(1, nil)
+	handler := Middleware(lpool)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		vm, ok := VMFromContext(r.Context())
+		if !ok {
+			t.Fatal("expected VM in request context")
+		}
+		if err := lua.DoString(vm, "return 'ok'"); err != nil {
+			t.Fatal(err)
+		}
+		s, _ := vm.ToString(-1)
+		w.Write([]byte(s))
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "ok" {
+		t.Errorf("unexpected response %d %q", rec.Code, rec.Body.String())
+	}
+	if s := lpool.Stats(); s.InUse != 0 {
+		t.Errorf("expected VM to be released but got %+v", s)
+	}
+
+	// the acquire honors the request deadline
+	vm := lpool.Acquire()
+	defer lpool.Release(vm)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected %d but got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+}
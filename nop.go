@@ -0,0 +1,121 @@
+package pool
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	lua "github.com/epikur-io/go-lua"
+	"github.com/epikur-io/go-lua-pool/generic"
+)
+
+// NopPool implements IPool without reusing VMs: every acquire creates a new VM
+// and every release drops it. Useful as a correctness baseline and to find out
+// whether a bug is caused by state reuse.
+type NopPool struct {
+	// only used to set up VMs like a Pool with the same options would
+	setup *Pool
+	slots chan struct{}
+
+	mux  sync.Mutex
+	held map[*lua.State]bool
+}
+
+// ensure interface is satisfied
+var _ IPool = &NopPool{}
+
+// Creates a pass-through pool allowing up to size VMs at a time. The options
+// which configure VMs (sandboxing, preloads, ...) are applied to every new VM.
+func NewNopPool(size int, vmFactoryFunc func() *lua.State, opts ...Option) *NopPool {
+	setup := &Pool{size: size, creator: vmFactoryFunc}
+	for _, opt := range opts {
+		opt(setup)
+	}
+	setup.initLogger()
+	return &NopPool{
+		setup: setup,
+		slots: make(chan struct{}, size),
+		held:  make(map[*lua.State]bool),
+	}
+}
+
+// Returns the number of VMs which can be acquired without waiting
+func (p *NopPool) Len() int {
+	return cap(p.slots) - len(p.slots)
+}
+
+func (p *NopPool) Cap() int {
+	return cap(p.slots)
+}
+
+// Nothing to replace, all VMs are fresh
+func (p *NopPool) Update() {}
+
+// Nothing to replace, all VMs are fresh
+func (p *NopPool) UpdateWithTimeout(time.Duration) (int, int) {
+	return 0, 0
+}
+
+func (p *NopPool) Acquire() *lua.State {
+	p.slots <- struct{}{}
+	return p.create()
+}
+
+func (p *NopPool) AcquireWithTimeout(to time.Duration) (*lua.State, error) {
+	t := time.NewTimer(to)
+	defer t.Stop()
+	select {
+	case p.slots <- struct{}{}:
+		return p.create(), nil
+	case <-t.C:
+		return nil, generic.ErrTimeout
+	}
+}
+
+func (p *NopPool) AcquireWithContext(ctx context.Context) (*lua.State, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	select {
+	case p.slots <- struct{}{}:
+		return p.create(), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (p *NopPool) create() *lua.State {
+	vm := p.setup.createVM()
+	p.mux.Lock()
+	p.held[vm] = true
+	p.mux.Unlock()
+	return vm
+}
+
+// Drops vm and frees its slot, VMs not acquired from the pool are ignored
+func (p *NopPool) Release(vm *lua.State) {
+	p.TryRelease(vm)
+}
+
+func (p *NopPool) TryRelease(vm *lua.State) error {
+	p.mux.Lock()
+	if !p.held[vm] {
+		p.mux.Unlock()
+		return ErrFailedToReleaseVM
+	}
+	delete(p.held, vm)
+	p.mux.Unlock()
+	<-p.slots
+	return nil
+}
+
+func (p *NopPool) TryReleaseWithContext(ctx context.Context, vm *lua.State) error {
+	if ctx != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return p.TryRelease(vm)
+}
+
+func (p *NopPool) Stats() Stats {
+	return Stats{Capacity: cap(p.slots), InUse: len(p.slots)}
+}
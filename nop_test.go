@@ -0,0 +1,34 @@
+package pool
+
+import (
+	"errors"
+	"testing"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+func TestNopPool(t *testing.T) {
+	p := NewNopPool(1, nil, WithDeniedFunctions("os"))
+	vm := p.Acquire()
+	if err := lua.DoString(vm, "x = 1; assert(os == nil)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.AcquireWithTimeout(0); err == nil {
+		t.Errorf("expected pool to be exhausted")
+	}
+	p.Release(vm)
+	if err := p.TryRelease(vm); !errors.Is(err, ErrFailedToReleaseVM) {
+		t.Errorf("expected %v but got %v", ErrFailedToReleaseVM, err)
+	}
+
+	next := p.Acquire()
+	if next == vm {
+		t.Errorf("expected a fresh VM")
+	}
+	if err := lua.DoString(next, "assert(x == nil)"); err != nil {
+		t.Errorf("expected no state of the previous VM: %v", err)
+	}
+	if s := p.Stats(); s != (Stats{Capacity: 1, InUse: 1}) {
+		t.Errorf("unexpected stats %+v", s)
+	}
+}
@@ -0,0 +1,54 @@
+package pool
+
+import (
+	"time"
+
+	"github.com/epikur-io/go-lua-pool/generic"
+)
+
+// Option configures optional behaviour of a pool
+type Option func(*Pool)
+
+// Selects how idle VMs are stored. generic.SyncPoolBackend lowers the acquire
+// overhead and lets the garbage collector drop idle VMs under low load, Len
+// and Stats then report free slots instead of idle VMs.
+func WithBackend(backend generic.Backend) Option {
+	return func(p *Pool) {
+		p.backend = backend
+	}
+}
+
+// Splits the idle VMs into n sub-pools to reduce contention when hundreds of
+// goroutines acquire and release concurrently. Stats and Len report the totals
+// of all shards.
+func WithShards(n int) Option {
+	return func(p *Pool) {
+		p.shards = n
+	}
+}
+
+// Sets the order in which idle VMs are handed out. generic.LIFO reuses the
+// most recently released VM first, which keeps its caches warm and leaves
+// rarely needed VMs untouched under low load.
+func WithOrder(order generic.Order) Option {
+	return func(p *Pool) {
+		p.order = order
+	}
+}
+
+// Sets the clock used for timeouts, timestamps and durations, e.g. a
+// pooltest.FakeClock to test timeouts without sleeping
+func WithClock(clock generic.Clock) Option {
+	return func(p *Pool) {
+		p.clock = clock
+	}
+}
+
+// Sets how long Update waits for acquired VMs to be released (default
+// generic.DefaultUpdateTimeout). VMs still acquired after d are considered
+// leaked: they are replaced right away and closed once they are released.
+func WithUpdateTimeout(d time.Duration) Option {
+	return func(p *Pool) {
+		p.updateTimeout = d
+	}
+}
@@ -4,13 +4,21 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	lua "github.com/epikur-io/go-lua"
+	"github.com/epikur-io/go-lua-pool/generic"
 )
 
-var ErrFailedToReleaseVM = fmt.Errorf("failed to release vm")
+var (
+	ErrFailedToReleaseVM = fmt.Errorf("failed to release vm")
+	ErrInvalidSize       = fmt.Errorf("invalid pool size")
+	ErrInvalidOption     = fmt.Errorf("invalid option")
+	ErrPoolClosed        = generic.ErrPoolClosed
+)
 
 // Lua VM pool
 
@@ -27,8 +35,31 @@ type IPool interface {
 	TryReleaseWithContext(context.Context, *lua.State) error
 }
 
+// StatsProvider is implemented by pools reporting their Stats, like Pool and
+// the wrappers of this package if the wrapped pool does
+type StatsProvider interface {
+	Stats() Stats
+}
+
 // ensure interface is satisfied
 var _ IPool = &Pool{}
+var _ StatsProvider = &Pool{}
+
+// returns the stats of p, zero if it doesn't implement StatsProvider
+func statsOf(p IPool) Stats {
+	if sp, ok := p.(StatsProvider); ok {
+		return sp.Stats()
+	}
+	return Stats{}
+}
+
+// returns the clock of p if it is a *Pool, the system clock otherwise
+func clockOf(p IPool) generic.Clock {
+	if lp, ok := p.(*Pool); ok {
+		return lp.clock
+	}
+	return generic.SystemClock
+}
 
 // Default factory function to create Lua VMs
 func NewLuaVM() *lua.State {
@@ -37,157 +68,417 @@ func NewLuaVM() *lua.State {
 	return lvm
 }
 
-// Creates a new pool of Lua VMs with the given size/capacity
-func NewPool(size int, vmFactoryFunc func() *lua.State) *Pool {
-	lp := Pool{size: size, creator: vmFactoryFunc}
+// Creates a new pool of Lua VMs with the given size/capacity, panics if the
+// size or an option is invalid (see New)
+func NewPool(size int, vmFactoryFunc func() *lua.State, opts ...Option) *Pool {
+	lp, err := New(size, vmFactoryFunc, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return lp
+}
+
+// Creates a new pool of Lua VMs with the given size/capacity. Fails with
+// ErrInvalidSize if size is below 1 and with ErrInvalidOption for invalid
+// options. A nil vmFactoryFunc creates the VMs with NewLuaVM.
+func New(size int, vmFactoryFunc func() *lua.State, opts ...Option) (*Pool, error) {
+	if size < 1 {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidSize, size)
+	}
+	lp := &Pool{size: size, creator: vmFactoryFunc}
+	for _, opt := range opts {
+		opt(lp)
+	}
+	if err := lp.validate(); err != nil {
+		return nil, err
+	}
 	lp.init()
-	return &lp
+	return lp, nil
+}
+
+func (p *Pool) validate() error {
+	switch {
+	case p.backend != generic.SemaphoreBackend && p.backend != generic.SyncPoolBackend:
+		return fmt.Errorf("%w: unknown backend %d", ErrInvalidOption, p.backend)
+	case p.order != generic.FIFO && p.order != generic.LIFO:
+		return fmt.Errorf("%w: unknown order %d", ErrInvalidOption, p.order)
+	case p.shards < 0:
+		return fmt.Errorf("%w: %d shards", ErrInvalidOption, p.shards)
+	case p.updateTimeout < 0:
+		return fmt.Errorf("%w: negative update timeout", ErrInvalidOption)
+	case p.affinityKeys < 0:
+		return fmt.Errorf("%w: negative affinity keys", ErrInvalidOption)
+	case p.maxErrors < 0 || p.quarantineSize < 0:
+		return fmt.Errorf("%w: negative quarantine limits", ErrInvalidOption)
+	case p.autoRecycle < 0:
+		return fmt.Errorf("%w: negative auto recycle threshold", ErrInvalidOption)
+	case p.profileInterval < 0:
+		return fmt.Errorf("%w: negative profiling interval", ErrInvalidOption)
+	case p.chaos != nil:
+		if err := p.chaos.validate(); err != nil {
+			return err
+		}
+	}
+	if err := p.errorPolicy.validate(); err != nil {
+		return err
+	}
+	return p.validateFlavors()
 }
 
 type Pool struct {
 	// size of the pool
 	size int
-	// factory function to create Lua VMs
-	creator func() *lua.State
-	pool    chan *lua.State
-	mux     sync.Mutex
+	// factory function to create Lua VMs, replaced by UpdateFactory and
+	// PromoteCanary
+	creator    func() *lua.State
+	creatorMux sync.Mutex
+	// factory replaced last, see Rollback
+	previous    func() *lua.State
+	hasPrevious bool
+	// pooling of the VMs created by newVM and set up by setupVM
+	core *generic.Pool[*lua.State]
+	// see WithBackend
+	backend generic.Backend
+	// see WithShards
+	shards int
+	// see WithOrder
+	order generic.Order
+	// see WithUpdateTimeout
+	updateTimeout time.Duration
+	// see WithClock
+	clock generic.Clock
+
+	// acquire-site recording (see WithAcquireTracking)
+	trackAcquires bool
+	sites         map[*lua.State]AcquireSite
+	sitesMux      sync.Mutex
+
+	// acquire times, only maintained in debug mode
+	acquired    map[*lua.State]time.Time
+	acquiredMux sync.Mutex
+
+	debug  bool
+	logger *slog.Logger
+
+	// optional Lua code executed by Healthy
+	healthScript string
+
+	// scripts available to Run
+	scripts *ScriptRegistry
+	// called after every script execution (see WithScriptHook)
+	scriptHooks []func(ctx context.Context, name string, duration time.Duration, err error)
+	// scripts executed in every new VM
+	preloads []string
+	// default limits of executions, see WithQuotaProfile
+	quota QuotaProfile
+	// what happens to VMs after quota violations, see WithViolationPolicy
+	violationPolicies map[error]ViolationPolicy
+	// see WithReadOnlyGlobals
+	readOnlyGlobals bool
+	// see WithGlobalsSnapshot
+	snapshotGlobals bool
+	// see WithRegistryScrub
+	scrubRegistry bool
+	registryKeep  []string
+	// see WithPackagePath, WithPackageCPath and WithSearcher
+	packagePath  *string
+	packageCPath *string
+	searchers    []lua.Function
+	// see WithModule
+	modules []lua.RegistryFunction
+	// see WithAllowedFunctions and WithDeniedFunctions
+	allowedFunctions []string
+	deniedFunctions  []string
+	// see WithDeterministic
+	deterministic *DeterministicOptions
+	// see WithAccessPolicy
+	accessPolicy AccessPolicy
+	// see WithGCOnRelease
+	gcMode GCMode
+	// see WithCloning
+	cloning     bool
+	prototype   *lua.State
+	cloneFailed bool
+	protoMux    sync.Mutex
+	// see WithBytecodeSnapshot
+	bytecodeSnapshot atomic.Pointer[BytecodeSnapshot]
+	// see WithChaos
+	chaos *ChaosOptions
+	// see WithAffinityKeys
+	affinityKeys int
+	// see WithTagger and WithTagLoader
+	tagger    func(*lua.State) []string
+	tagLoader func(*lua.State, string) error
+	// see WithVMIDGlobal
+	idGlobal string
+	// see WithFactory
+	flavors []flavor
+	// see CanaryUpdate
+	canary        *canary
+	canaryMetrics *execMetrics
+	stableMetrics *execMetrics
+	canaryActive  atomic.Bool
+	canaryMux     sync.Mutex
+	// see WithQuarantine
+	maxErrors      int
+	quarantineSize int
+	// see WithErrorPolicy
+	errorPolicy ErrorPolicy
+	// see WithAutoRecycle
+	autoRecycle int
+	// see WithProfiling, profiler is nil if it is disabled
+	profileInterval time.Duration
+	profiler        *profiler
 }
 
 func (p *Pool) init() {
-	p.mux = sync.Mutex{}
-	p.pool = make(chan *lua.State, p.size)
-	// fill the pool
-	for i := 0; i < p.size; i++ {
-		p.pool <- p.createVM()
+	if p.clock == nil {
+		p.clock = generic.SystemClock
+	}
+	p.sites = make(map[*lua.State]AcquireSite)
+	p.initLogger()
+	if p.profileInterval > 0 {
+		p.profiler = newProfiler(p.profileInterval)
+	}
+	if p.scripts != nil {
+		p.scripts.attach(p)
+	}
+	opts := []generic.Option[*lua.State]{
+		generic.WithReset(p.reset),
+		generic.WithInit(p.setupVM),
+		generic.WithBackend[*lua.State](p.backend),
+		generic.WithShards[*lua.State](p.shards),
+		generic.WithOrder[*lua.State](p.order),
+		generic.WithClock[*lua.State](p.clock),
+	}
+	if p.updateTimeout > 0 {
+		opts = append(opts, generic.WithUpdateTimeout[*lua.State](p.updateTimeout))
+	}
+	if p.chaos != nil || p.autoRecycle > 0 {
+		opts = append(opts, generic.WithValidator(p.validVM))
+	}
+	// adds CanaryTag
+	opts = append(opts, generic.WithTagger(p.tagVM))
+	if p.tagLoader != nil {
+		opts = append(opts, generic.WithTagLoader(p.tagLoader))
+	}
+	if p.affinityKeys > 0 {
+		opts = append(opts, generic.WithAffinityKeys[*lua.State](p.affinityKeys))
+	}
+	if len(p.flavors) > 0 {
+		opts = append(opts, generic.WithFlavors(p.genericFlavors()...))
+	}
+	if p.quarantineSize > 0 {
+		opts = append(opts, generic.WithQuarantine[*lua.State](p.quarantineSize))
 	}
+	if p.debug {
+		p.acquired = make(map[*lua.State]time.Time)
+		opts = append(opts, generic.WithEvents(generic.Events[*lua.State]{
+			Created:   p.logCreate,
+			Destroyed: p.logDestroy,
+		}))
+	}
+	// fills the pool
+	p.core = generic.New(p.size, func() *lua.State {
+		p.injectSlowCreation()
+		return p.newVM()
+	}, opts...)
 }
 
+// returns a VM set up like the pooled ones but without ID
 func (p *Pool) createVM() *lua.State {
-	var lvm *lua.State
-	if p.creator != nil {
-		lvm = p.creator()
-	} else {
-		lvm = NewLuaVM()
-	}
+	p.injectSlowCreation()
+	lvm := p.newVM()
+	p.setupVM(lvm, generic.Info{})
 	return lvm
 }
 
+// applies the options to a VM as created by the factory
+func (p *Pool) setupVM(lvm *lua.State, info generic.Info) {
+	p.applySnapshot(lvm)
+	if p.idGlobal != "" && info.ID != 0 {
+		lvm.PushNumber(float64(info.ID))
+		lvm.SetGlobal(p.idGlobal)
+	}
+	if len(p.allowedFunctions) > 0 {
+		AllowFunctions(lvm, p.allowedFunctions...)
+	}
+	if len(p.deniedFunctions) > 0 {
+		DenyFunctions(lvm, p.deniedFunctions...)
+	}
+	if p.accessPolicy != nil {
+		installAccessPolicy(lvm, p.accessPolicy)
+	}
+	if p.deterministic != nil {
+		makeDeterministic(lvm, p.deterministic)
+	}
+	p.setupPackage(lvm)
+	if len(p.preloads) > 0 {
+		p.preload(lvm)
+	}
+	if p.snapshotGlobals {
+		snapshotGlobals(lvm)
+	}
+	if p.readOnlyGlobals {
+		freezeGlobals(lvm)
+	}
+	if p.scrubRegistry {
+		snapshotRegistry(lvm, p.registryKeep)
+	}
+}
+
 func (p *Pool) Len() int {
-	return len(p.pool)
+	return p.core.Len()
 }
 
 func (p *Pool) Cap() int {
-	return cap(p.pool)
+	return p.core.Cap()
 }
 
-func (p *Pool) Update() {
-	// Make sure the pool is empty so we don't miss a vm because
-	// it was acquired by an other function
-	// So this loop can take a while if some vm's are already acquired and busy.
-	p.mux.Lock()
-	defer p.mux.Unlock()
-
-	for i := 0; i < cap(p.pool); i++ {
-		// empty the Pool
-		<-p.pool
-	}
-	for i := 0; i < cap(p.pool); i++ {
-		// fill the Pool
-		p.pool <- p.createVM()
+// Closes the pool: waiting and later acquirers fail with ErrPoolClosed (Acquire
+// returns nil), idle VMs are dropped right away and acquired ones when they
+// are released. Calling Close more than once has no effect.
+func (p *Pool) Close() {
+	p.core.Close()
+	if p.scripts != nil {
+		p.scripts.detach(p)
 	}
 }
 
+// true once Close was called
+func (p *Pool) Closed() bool {
+	return p.core.Closed()
+}
+
+// Replaces all VMs of the pool. Idle VMs are replaced right away, acquired ones
+// when they are released. Waits until all VMs are replaced but at most the
+// update timeout (see WithUpdateTimeout), VMs still acquired by then are
+// considered leaked and replaced without waiting for them. Concurrent calls
+// are coalesced into a single follow-up pass.
+func (p *Pool) Update() {
+	p.resetPrototype()
+	p.core.Update()
+}
+
+// Like Update but stops waiting after the given duration. The pool keeps its
+// capacity: VMs not replaced by then are replaced when they are released or
+// acquired. Returns the number of VMs removed and created until then.
 func (p *Pool) UpdateWithTimeout(to time.Duration) (removedInstanceCount int, newInstanceCount int) {
-	p.mux.Lock()
-	defer p.mux.Unlock()
-
-	c := time.After(to)
-	for i := 0; i < cap(p.pool); i++ {
-		// try to empty the Pool
-		select {
-		case <-p.pool:
-			removedInstanceCount++
-		case <-c:
-			return
-		}
-	}
-	for i := 0; i < cap(p.pool); i++ {
-		// try to fill the Pool
-		select {
-		case p.pool <- p.createVM():
-			newInstanceCount++
-		case <-c:
-			return
-		}
+	p.resetPrototype()
+	return p.core.UpdateWithTimeout(to)
+}
 
-	}
-	return
+// Replaces all VMs of the pool without blocking: idle VMs are replaced one at a
+// time right away, VMs in use are replaced when they are released.
+// Returns the number of idle VMs which were replaced immediately.
+func (p *Pool) RollingUpdate() int {
+	p.resetPrototype()
+	return p.core.RollingUpdate()
 }
 
 func (p *Pool) AcquireWithTimeout(to time.Duration) (*lua.State, error) {
-	c := time.After(to)
-	select {
-	case vm := <-p.pool:
-		return vm, nil
-	case <-c:
-		return nil, errors.New("timeout")
-	}
+	start := p.debugNow()
+	vm, err := p.core.AcquireWithTimeout(to)
+	return p.finishAcquire(vm, start, err)
 }
 
 func (p *Pool) AcquireWithContext(ctx context.Context) (*lua.State, error) {
-	if ctx == nil {
-		ctx = context.Background()
+	start := p.debugNow()
+	vm, err := p.core.AcquireWithContext(ctx)
+	return p.finishAcquire(vm, start, err)
+}
+
+// Acquire a vm from the pool (blocking), nil if the pool is closed
+func (p *Pool) Acquire() *lua.State {
+	start := p.debugNow()
+	vm := p.core.Acquire()
+	if vm == nil {
+		// closed
+		return nil
 	}
-	select {
-	case <-ctx.Done():
-		return nil, ctx.Err()
-	case vm := <-p.pool:
-		return vm, nil
+	p.acquireDone(vm, start)
+	return vm
+}
+
+// finishes the acquires which can fail: logs failures, injects faults (see
+// WithChaos) and does the bookkeeping of acquired VMs
+func (p *Pool) finishAcquire(vm *lua.State, start time.Time, err error) (*lua.State, error) {
+	if err != nil {
+		if p.debug {
+			p.logAcquireFailed(start, err)
+		}
+		return nil, err
 	}
+	if err := p.injectAcquireFault(vm); err != nil {
+		return nil, err
+	}
+	p.acquireDone(vm, start)
+	return vm, nil
 }
 
-// Acquire a vm from the pool (blocking)
-func (p *Pool) Acquire() *lua.State {
-	return <-p.pool
+// tracks the acquire site and logs the wait of an acquired VM
+func (p *Pool) acquireDone(vm *lua.State, start time.Time) {
+	p.trackAcquire(vm)
+	if p.debug {
+		p.logAcquire(vm, start)
+	}
 }
 
 // Releases a vm to the pool (blocking)
-// if vm is nil a new vm gets created on the fly
+// if vm is nil a new vm gets created on the fly. VMs released in excess of the
+// acquired ones are dropped, so the pool never holds more VMs than its capacity.
 func (p *Pool) Release(vm *lua.State) {
-	if vm == nil {
-		p.pool <- p.createVM()
-		return
+	if vm != nil {
+		p.untrackAcquire(vm)
+		if p.debug {
+			info, _ := p.core.Info(vm)
+			p.logRelease(vm, info)
+		}
 	}
-	p.pool <- vm
+	p.core.Release(vm)
 }
 
-// Try to release a vm to the pool (non-blocking)
+// Try to release a vm to the pool (non-blocking), fails with
+// ErrFailedToReleaseVM if no VM is acquired, i.e. the pool is full
 // if vm is nil a new vm gets created on the fly
 func (p *Pool) TryRelease(vm *lua.State) error {
-	if vm == nil {
-		vm = p.createVM()
-	}
-	select {
-	case p.pool <- vm:
-	default:
-		return ErrFailedToReleaseVM
-	}
-	return nil
+	return p.tryRelease(vm, p.core.TryRelease)
 }
 
 // Try to release a vm to the pool (non-blocking)
 // if vm is nil a new vm gets created on the fly
 func (p *Pool) TryReleaseWithContext(ctx context.Context, vm *lua.State) error {
-	if ctx == nil {
-		ctx = context.Background()
-	}
+	return p.tryRelease(vm, func(vm *lua.State) error {
+		return p.core.TryReleaseWithContext(ctx, vm)
+	})
+}
+
+// keeps the acquire site of vm if release fails
+func (p *Pool) tryRelease(vm *lua.State, release func(*lua.State) error) error {
 	if vm == nil {
-		vm = p.createVM()
+		return releaseError(release(nil))
+	}
+	site, tracked := p.untrackAcquire(vm)
+	var info generic.Info
+	if p.debug {
+		// vm may be replaced during the release
+		info, _ = p.core.Info(vm)
 	}
-	select {
-	case p.pool <- vm:
-	case <-ctx.Done():
-		return ctx.Err()
+	if err := release(vm); err != nil {
+		if tracked {
+			p.restoreAcquire(vm, site)
+		}
+		return releaseError(err)
+	}
+	if p.debug {
+		p.logRelease(vm, info)
 	}
 	return nil
 }
+
+func releaseError(err error) error {
+	if errors.Is(err, generic.ErrFailedToRelease) {
+		return ErrFailedToReleaseVM
+	}
+	return err
+}
@@ -1,10 +1,14 @@
 package pool
 
 import (
+	"context"
+	"errors"
+	"sync"
 	"testing"
 	"time"
 
 	lua "github.com/epikur-io/go-lua"
+	"github.com/epikur-io/go-lua-pool/generic"
 )
 
 func TestAqcuireAndRelease(t *testing.T) {
@@ -74,3 +78,171 @@ func TestUpdateTimeout(t *testing.T) {
 		t.Errorf("expected %d updated instances but got %d", lpool.Len(), updatedInstances)
 	}
 }
+
+func TestRollingUpdate(t *testing.T) {
+	lpool := NewPool(2, nil)
+	busy := lpool.Acquire()
+	idle := lpool.Acquire()
+	lpool.Release(idle)
+
+	if replaced := lpool.RollingUpdate(); replaced != 1 {
+		t.Errorf("expected 1 idle instance to be replaced but got %d", replaced)
+	}
+	// busy instances get replaced on release
+	lpool.Release(busy)
+
+	for range 2 {
+		lvm := lpool.Acquire()
+		defer lpool.Release(lvm)
+		if lvm == busy || lvm == idle {
+			t.Errorf("expected all instances to be replaced")
+		}
+	}
+	if lpool.Len() != 0 {
+		t.Errorf("expected pool to keep its size but got %d idle instances", lpool.Len())
+	}
+}
+
+// waits for VMs replaced in the background to arrive in the pool
+func waitIdle(t *testing.T, p *Pool, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for p.Stats().Idle != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d idle VMs but got %+v", n, p.Stats())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSyncPoolBackend(t *testing.T) {
+	lpool := NewPool(2, nil, WithBackend(generic.SyncPoolBackend))
+	vm := lpool.Acquire()
+	if err := lpool.Do(func(vm *lua.State) error { return lua.DoString(vm, "x = 1") }); err != nil {
+		t.Fatal(err)
+	}
+	if s := lpool.Stats(); s.InUse != 1 || s.Capacity != 2 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+	lpool.Release(vm)
+	if lpool.Len() != 2 {
+		t.Errorf("expected 2 free slots but got %d", lpool.Len())
+	}
+}
+
+func TestShards(t *testing.T) {
+	lpool := NewPool(4, nil, WithShards(2))
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 50 {
+				if err := lpool.Do(func(vm *lua.State) error { return lua.DoString(vm, "return 1") }); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if s := lpool.Stats(); s.Idle != 4 || s.InUse != 0 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+}
+
+func TestLIFO(t *testing.T) {
+	lpool := NewPool(3, nil, WithOrder(generic.LIFO))
+	vm := lpool.Acquire()
+	lpool.Release(vm)
+	for range 3 {
+		next := lpool.Acquire()
+		if next != vm {
+			t.Errorf("expected most recently used VM")
+		}
+		lpool.Release(next)
+	}
+}
+
+func TestAcquireWeighted(t *testing.T) {
+	lpool := NewPool(3, nil)
+	ctx := ContextWithWeight(context.Background(), 3)
+	err := lpool.DoWithContext(ctx, func(vm *lua.State) error {
+		if s := lpool.Stats(); s.InUse != 3 {
+			t.Errorf("expected heavy execution to take all slots but got %+v", s)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lpool.AcquireWeighted(context.Background(), 4); !errors.Is(err, ErrInvalidWeight) {
+		t.Errorf("expected %v but got %v", ErrInvalidWeight, err)
+	}
+	if s := lpool.Stats(); s.Idle != 3 || s.InUse != 0 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+}
+
+func TestUpdateLeakedVM(t *testing.T) {
+	lpool := NewPool(2, nil, WithUpdateTimeout(10*time.Millisecond))
+	leaked := lpool.Acquire()
+	lpool.Update()
+	if lpool.Len() != 2 {
+		t.Errorf("expected the leaked VM to be replaced but got %d idle VMs", lpool.Len())
+	}
+	lpool.Release(leaked)
+	if lpool.Len() != 2 {
+		t.Errorf("expected the leaked VM to be dropped on release but got %d idle VMs", lpool.Len())
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, size := range []int{0, -1} {
+		if _, err := New(size, nil); !errors.Is(err, ErrInvalidSize) {
+			t.Errorf("size %d: expected %v but got %v", size, ErrInvalidSize, err)
+		}
+	}
+	if _, err := New(1, nil, WithShards(-1)); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("expected %v but got %v", ErrInvalidOption, err)
+	}
+	lpool, err := New(2, nil)
+	if err != nil || lpool.Cap() != 2 {
+		t.Fatalf("expected a pool of 2 VMs but got %v", err)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected NewPool to panic")
+		}
+	}()
+	NewPool(0, nil)
+}
+
+func TestClose(t *testing.T) {
+	lpool := NewPool(2, nil)
+	vm := lpool.Acquire()
+	lpool.Close()
+	if !lpool.Closed() || lpool.Len() != 0 {
+		t.Errorf("expected the idle VMs to be dropped")
+	}
+	if _, err := lpool.AcquireWithContext(context.Background()); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("expected %v but got %v", ErrPoolClosed, err)
+	}
+	if lpool.Acquire() != nil {
+		t.Errorf("expected no VM from a closed pool")
+	}
+	if err := lpool.TryRelease(vm); err != nil || lpool.Len() != 0 {
+		t.Errorf("expected the VM to be dropped on release but got %v", err)
+	}
+}
+
+func TestReleaseSurplus(t *testing.T) {
+	lpool := NewPool(2, nil)
+	lpool.Release(nil)
+	lpool.Release(NewLuaVM())
+	if s := lpool.Stats(); s.Idle != 2 || s.InUse != 0 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+	if err := lpool.TryRelease(nil); !errors.Is(err, ErrFailedToReleaseVM) {
+		t.Errorf("expected %v but got %v", ErrFailedToReleaseVM, err)
+	}
+}
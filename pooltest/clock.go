@@ -0,0 +1,90 @@
+package pooltest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/epikur-io/go-lua-pool/generic"
+)
+
+// FakeClock is a generic.Clock whose time only moves by Advance, so timeouts
+// can be tested without sleeping. It is safe for concurrent use.
+type FakeClock struct {
+	mux    sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+// ensure interface is satisfied
+var _ generic.Clock = &FakeClock{}
+
+// Creates a clock starting at start
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.now
+}
+
+// Creates a timer firing once the clock was advanced by d
+func (c *FakeClock) NewTimer(d time.Duration) generic.Timer {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	t := &fakeTimer{clock: c, c: make(chan time.Time, 1), at: c.now.Add(d)}
+	if d <= 0 {
+		t.c <- c.now
+		return t
+	}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Moves the time forward and fires the timers due
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.now = c.now.Add(d)
+	pending := c.timers[:0]
+	for _, t := range c.timers {
+		if t.at.After(c.now) {
+			pending = append(pending, t)
+			continue
+		}
+		t.c <- c.now
+	}
+	c.timers = pending
+}
+
+// Returns the number of timers which haven't fired yet, to wait until the code
+// under test blocks on the clock before advancing it
+func (c *FakeClock) Timers() int {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return len(c.timers)
+}
+
+type fakeTimer struct {
+	clock *FakeClock
+	c     chan time.Time
+	at    time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	c := t.clock
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	for i, other := range c.timers {
+		if other == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package pooltest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	pool "github.com/epikur-io/go-lua-pool"
+	"github.com/epikur-io/go-lua-pool/generic"
+)
+
+// waits until the code under test blocks on the clock
+func waitForTimers(t *testing.T, c *FakeClock, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for c.Timers() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d timers but got %d", n, c.Timers())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewFakeClock(start)
+	timer := c.NewTimer(time.Minute)
+	c.Advance(59 * time.Second)
+	select {
+	case <-timer.C():
+		t.Fatal("timer fired early")
+	default:
+	}
+	c.Advance(time.Second)
+	if now := <-timer.C(); !now.Equal(start.Add(time.Minute)) {
+		t.Errorf("unexpected fire time %v", now)
+	}
+	if timer.Stop() || c.Timers() != 0 {
+		t.Errorf("expected the timer to be gone")
+	}
+
+	ctx, cancel := generic.ContextWithTimeout(context.Background(), c, time.Hour)
+	defer cancel()
+	c.Advance(time.Hour)
+	<-ctx.Done()
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		t.Errorf("expected %v but got %v", context.DeadlineExceeded, ctx.Err())
+	}
+}
+
+func TestPoolClock(t *testing.T) {
+	c := NewFakeClock(time.Now())
+	p := pool.NewPool(1, nil, pool.WithClock(c))
+	vm := p.Acquire()
+	defer p.Release(vm)
+	errs := make(chan error)
+	go func() {
+		_, err := p.AcquireWithTimeout(time.Hour)
+		errs <- err
+	}()
+	waitForTimers(t, c, 1)
+	c.Advance(time.Hour)
+	if err := <-errs; !errors.Is(err, generic.ErrTimeout) {
+		t.Errorf("expected %v but got %v", generic.ErrTimeout, err)
+	}
+
+	b := pool.NewBreaker(pool.BreakerOptions{MinExecutions: 1, Cooldown: time.Minute, Clock: c})
+	b.Record(errors.New("boom"))
+	if b.State() != pool.BreakerOpen {
+		t.Fatalf("expected the breaker to open")
+	}
+	c.Advance(time.Minute)
+	if b.State() != pool.BreakerHalfOpen {
+		t.Errorf("expected the breaker to be half-open after the cooldown")
+	}
+}
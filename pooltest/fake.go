@@ -0,0 +1,257 @@
+// Package pooltest provides a controllable fake pool to unit-test code using
+// a pool.IPool without real pooling behind it.
+package pooltest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	lua "github.com/epikur-io/go-lua"
+	pool "github.com/epikur-io/go-lua-pool"
+	"github.com/epikur-io/go-lua-pool/generic"
+)
+
+// Fake implements pool.IPool with canned VMs, scriptable acquire delays and
+// forced errors. It is safe for concurrent use.
+type Fake struct {
+	size int
+	vms  chan *lua.State
+
+	mux          sync.Mutex
+	held         map[*lua.State]bool
+	delay        time.Duration
+	acquireErr   error
+	acquireFails int
+	releaseErr   error
+	releaseFails int
+	waiting      int
+	acquires     int
+	releases     int
+	updates      int
+}
+
+// ensure interface is satisfied
+var _ pool.IPool = &Fake{}
+
+// Creates a fake of the given size handing out the given VMs. Missing VMs are
+// created by lua.NewState without opening any libraries.
+func NewFake(size int, vms ...*lua.State) *Fake {
+	f := &Fake{
+		size: size,
+		vms:  make(chan *lua.State, size),
+		held: make(map[*lua.State]bool),
+	}
+	for i := range size {
+		if i < len(vms) {
+			f.vms <- vms[i]
+		} else {
+			f.vms <- lua.NewState()
+		}
+	}
+	return f
+}
+
+// Delays every acquire by d before a VM is taken from the fake
+func (f *Fake) SetAcquireDelay(d time.Duration) {
+	f.mux.Lock()
+	f.delay = d
+	f.mux.Unlock()
+}
+
+// Makes the next n acquires fail with err, all of them if n is negative.
+// A nil err stops failing. Acquire panics with the error.
+func (f *Fake) FailAcquires(err error, n int) {
+	f.mux.Lock()
+	f.acquireErr, f.acquireFails = err, n
+	f.mux.Unlock()
+}
+
+// Makes the next n calls of TryRelease and TryReleaseWithContext fail with
+// err, all of them if n is negative. The VMs stay held. A nil err stops
+// failing.
+func (f *Fake) FailReleases(err error, n int) {
+	f.mux.Lock()
+	f.releaseErr, f.releaseFails = err, n
+	f.mux.Unlock()
+}
+
+// Returns the number of successful acquires
+func (f *Fake) Acquires() int {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return f.acquires
+}
+
+// Returns the number of successful releases
+func (f *Fake) Releases() int {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return f.releases
+}
+
+// Returns the number of calls of Update and UpdateWithTimeout
+func (f *Fake) Updates() int {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return f.updates
+}
+
+// Returns the VMs which are currently acquired, e.g. to detect leaks
+func (f *Fake) Held() []*lua.State {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	held := make([]*lua.State, 0, len(f.held))
+	for vm := range f.held {
+		held = append(held, vm)
+	}
+	return held
+}
+
+func (f *Fake) Len() int {
+	return len(f.vms)
+}
+
+func (f *Fake) Cap() int {
+	return f.size
+}
+
+// Only counted, the VMs are kept
+func (f *Fake) Update() {
+	f.mux.Lock()
+	f.updates++
+	f.mux.Unlock()
+}
+
+// Only counted, the VMs are kept
+func (f *Fake) UpdateWithTimeout(time.Duration) (int, int) {
+	f.Update()
+	return 0, 0
+}
+
+func (f *Fake) Acquire() *lua.State {
+	vm, err := f.AcquireWithContext(context.Background())
+	if err != nil {
+		panic(err)
+	}
+	return vm
+}
+
+// Fails with generic.ErrTimeout like pool.Pool does
+func (f *Fake) AcquireWithTimeout(to time.Duration) (*lua.State, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), to)
+	defer cancel()
+	vm, err := f.AcquireWithContext(ctx)
+	if err != nil && ctx.Err() != nil {
+		return nil, generic.ErrTimeout
+	}
+	return vm, err
+}
+
+func (f *Fake) AcquireWithContext(ctx context.Context) (*lua.State, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	f.mux.Lock()
+	delay := f.delay
+	err := f.acquireErr
+	if err != nil {
+		if f.acquireFails > 0 {
+			f.acquireFails--
+		}
+		if f.acquireFails == 0 {
+			f.acquireErr = nil
+		}
+	}
+	f.waiting++
+	f.mux.Unlock()
+	defer func() {
+		f.mux.Lock()
+		f.waiting--
+		f.mux.Unlock()
+	}()
+
+	if delay > 0 {
+		t := time.NewTimer(delay)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case vm := <-f.vms:
+		f.mux.Lock()
+		f.held[vm] = true
+		f.acquires++
+		f.mux.Unlock()
+		return vm, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Releases vm, VMs not acquired from the fake are ignored
+func (f *Fake) Release(vm *lua.State) {
+	f.release(vm)
+}
+
+func (f *Fake) TryRelease(vm *lua.State) error {
+	if err := f.forcedReleaseError(); err != nil {
+		return err
+	}
+	if !f.release(vm) {
+		return pool.ErrFailedToReleaseVM
+	}
+	return nil
+}
+
+func (f *Fake) TryReleaseWithContext(ctx context.Context, vm *lua.State) error {
+	if ctx != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return f.TryRelease(vm)
+}
+
+func (f *Fake) forcedReleaseError() error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	err := f.releaseErr
+	if err != nil {
+		if f.releaseFails > 0 {
+			f.releaseFails--
+		}
+		if f.releaseFails == 0 {
+			f.releaseErr = nil
+		}
+	}
+	return err
+}
+
+func (f *Fake) release(vm *lua.State) bool {
+	f.mux.Lock()
+	if !f.held[vm] {
+		f.mux.Unlock()
+		return false
+	}
+	delete(f.held, vm)
+	f.releases++
+	f.mux.Unlock()
+	f.vms <- vm
+	return true
+}
+
+func (f *Fake) Stats() pool.Stats {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return pool.Stats{
+		Capacity: f.size,
+		Idle:     len(f.vms),
+		InUse:    len(f.held),
+		Waiting:  f.waiting,
+	}
+}
@@ -0,0 +1,54 @@
+package pooltest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	lua "github.com/epikur-io/go-lua"
+	pool "github.com/epikur-io/go-lua-pool"
+	"github.com/epikur-io/go-lua-pool/generic"
+)
+
+func TestFake(t *testing.T) {
+	canned := lua.NewState()
+	f := NewFake(2, canned)
+	if vm := f.Acquire(); vm != canned {
+		t.Errorf("expected canned VM")
+	}
+	f.Acquire()
+	if _, err := f.AcquireWithTimeout(10 * time.Millisecond); !errors.Is(err, generic.ErrTimeout) {
+		t.Errorf("expected %v but got %v", generic.ErrTimeout, err)
+	}
+	if s := f.Stats(); s != (pool.Stats{Capacity: 2, InUse: 2}) {
+		t.Errorf("unexpected stats %+v", s)
+	}
+
+	errBoom := errors.New("boom")
+	f.FailReleases(errBoom, 1)
+	if err := f.TryRelease(canned); !errors.Is(err, errBoom) {
+		t.Errorf("expected %v but got %v", errBoom, err)
+	}
+	if err := f.TryRelease(canned); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.TryRelease(canned); !errors.Is(err, pool.ErrFailedToReleaseVM) {
+		t.Errorf("expected %v but got %v", pool.ErrFailedToReleaseVM, err)
+	}
+
+	f.FailAcquires(errBoom, 1)
+	if _, err := f.AcquireWithContext(context.Background()); !errors.Is(err, errBoom) {
+		t.Errorf("expected %v but got %v", errBoom, err)
+	}
+	f.SetAcquireDelay(20 * time.Millisecond)
+	start := time.Now()
+	vm, err := f.AcquireWithContext(context.Background())
+	if err != nil || time.Since(start) < 20*time.Millisecond {
+		t.Errorf("expected delayed acquire but got %v", err)
+	}
+	f.Release(vm)
+	if f.Acquires() != 3 || f.Releases() != 2 || len(f.Held()) != 1 {
+		t.Errorf("unexpected counts %d %d %d", f.Acquires(), f.Releases(), len(f.Held()))
+	}
+}
@@ -0,0 +1,175 @@
+package pooltest
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	lua "github.com/epikur-io/go-lua"
+	pool "github.com/epikur-io/go-lua-pool"
+)
+
+// HammerOptions configures Hammer, zero fields use the defaults
+type HammerOptions struct {
+	// concurrent workers, default 8
+	Workers int
+	// operations per worker, default 500
+	Ops int
+	// seed of the random operation sequence, reported on failure so a run
+	// can be repeated
+	Seed uint64
+	// close the pool at a random point of the run
+	Close bool
+}
+
+// Runs randomized concurrent Acquire, Release, Update and Close calls against p
+// and fails t if a VM is handed out twice, a VM gets lost or a stats snapshot
+// is inconsistent (if p implements pool.StatsProvider). Close is only called if p implements Close() and opts.Close
+// is set. Meant to be run with the race detector.
+func Hammer(t testing.TB, p pool.IPool, opts HammerOptions) {
+	t.Helper()
+	if opts.Workers <= 0 {
+		opts.Workers = 8
+	}
+	if opts.Ops <= 0 {
+		opts.Ops = 500
+	}
+	h := &hammer{
+		t:    t,
+		p:    p,
+		opts: opts,
+		held: make(map[*lua.State]bool),
+	}
+	if opts.Close {
+		if _, ok := p.(interface{ Close() }); ok {
+			// somewhere in the middle of the run
+			rnd := rand.New(rand.NewPCG(opts.Seed, 0))
+			h.closeAt = opts.Ops/4 + rnd.IntN(opts.Ops/2+1)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for w := range opts.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.work(rand.New(rand.NewPCG(opts.Seed, uint64(w)+1)), w == 0)
+		}()
+	}
+	wg.Wait()
+	if t.Failed() {
+		t.Logf("hammer seed %d", opts.Seed)
+		return
+	}
+	if h.closed {
+		return
+	}
+	// every VM was released, so the pool must be full again
+	var s pool.Stats
+	if sp, ok := p.(pool.StatsProvider); ok {
+		s = sp.Stats()
+	}
+	if s.InUse != 0 || s.Idle != s.Capacity || p.Len() != p.Cap() {
+		t.Errorf("lost VMs after hammering with seed %d: %+v", opts.Seed, s)
+	}
+}
+
+type hammer struct {
+	t       testing.TB
+	p       pool.IPool
+	opts    HammerOptions
+	closeAt int
+
+	mux    sync.Mutex
+	held   map[*lua.State]bool
+	closed bool
+}
+
+func (h *hammer) work(rnd *rand.Rand, first bool) {
+	for i := range h.opts.Ops {
+		if h.t.Failed() {
+			return
+		}
+		if first && h.closeAt > 0 && i == h.closeAt {
+			h.close()
+			continue
+		}
+		switch n := rnd.IntN(100); {
+		case n < 2:
+			h.p.UpdateWithTimeout(time.Duration(rnd.IntN(2)) * time.Millisecond)
+		default:
+			h.use(rnd)
+		}
+		h.checkStats()
+	}
+}
+
+// acquires a VM, holds it for a moment and releases it
+func (h *hammer) use(rnd *rand.Rand) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	vm, err := h.p.AcquireWithContext(ctx)
+	cancel()
+	if err != nil {
+		h.mux.Lock()
+		closed := h.closed
+		h.mux.Unlock()
+		if closed && !errors.Is(err, pool.ErrPoolClosed) {
+			h.t.Errorf("expected %v from a closed pool but got %v", pool.ErrPoolClosed, err)
+		}
+		return
+	}
+	if vm == nil {
+		h.t.Errorf("acquired a nil VM")
+		return
+	}
+	h.mux.Lock()
+	if h.held[vm] {
+		h.t.Errorf("VM %p handed out twice", vm)
+	}
+	h.held[vm] = true
+	h.mux.Unlock()
+
+	if rnd.IntN(4) == 0 {
+		time.Sleep(time.Duration(rnd.IntN(100)) * time.Microsecond)
+	} else {
+		runtime.Gosched()
+	}
+
+	h.mux.Lock()
+	delete(h.held, vm)
+	h.mux.Unlock()
+	if rnd.IntN(2) == 0 {
+		h.p.Release(vm)
+		return
+	}
+	if err := h.p.TryRelease(vm); err != nil {
+		h.mux.Lock()
+		closed := h.closed
+		h.mux.Unlock()
+		if !closed {
+			h.t.Errorf("releasing an acquired VM failed: %v", err)
+		}
+	}
+}
+
+func (h *hammer) close() {
+	h.mux.Lock()
+	h.closed = true
+	h.mux.Unlock()
+	h.p.(interface{ Close() }).Close()
+}
+
+func (h *hammer) checkStats() {
+	sp, ok := h.p.(pool.StatsProvider)
+	if !ok {
+		return
+	}
+	s := sp.Stats()
+	if s.Idle < 0 || s.InUse < 0 || s.InUse > s.Capacity || s.Idle+s.InUse > s.Capacity {
+		h.t.Errorf("inconsistent stats %+v", s)
+	}
+}
@@ -0,0 +1,34 @@
+package pooltest
+
+import (
+	"testing"
+
+	pool "github.com/epikur-io/go-lua-pool"
+	"github.com/epikur-io/go-lua-pool/generic"
+)
+
+func TestHammer(t *testing.T) {
+	for name, opts := range map[string][]pool.Option{
+		"list":     nil,
+		"sharded":  {pool.WithShards(3)},
+		"lifo":     {pool.WithOrder(generic.LIFO)},
+		"syncpool": {pool.WithBackend(generic.SyncPoolBackend)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			Hammer(t, pool.NewPool(4, nil, opts...), HammerOptions{Seed: 1})
+			Hammer(t, pool.NewPool(4, nil, opts...), HammerOptions{Seed: 2, Close: true})
+		})
+	}
+	t.Run("fake", func(t *testing.T) {
+		Hammer(t, NewFake(4), HammerOptions{Seed: 3})
+	})
+}
+
+func FuzzHammer(f *testing.F) {
+	f.Add(uint64(1), uint8(4), false)
+	f.Add(uint64(2), uint8(1), true)
+	f.Fuzz(func(t *testing.T, seed uint64, size uint8, close bool) {
+		p := pool.NewPool(1+int(size%8), nil)
+		Hammer(t, p, HammerOptions{Workers: 4, Ops: 100, Seed: seed, Close: close})
+	})
+}
@@ -0,0 +1,187 @@
+package pool
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+// number of instructions between two checks whether a profile sample is due
+const profileCheckInterval = 1000
+
+// maximum number of frames of a sampled call stack, the innermost frames of
+// deeper stacks are dropped
+const maxProfileDepth = 64
+
+// maximum number of distinct call stacks, further stacks are counted as
+// otherProfileFrame of their script
+const maxProfileStacks = 10000
+
+const otherProfileFrame = "[other]"
+
+// Samples the Lua call stack of running executions every interval and
+// aggregates the samples per script (see Profile), to find hot Lua functions
+// without instrumenting the scripts. The stack is captured from a count hook
+// checking the time every 1000 instructions, so time spent in Go functions
+// called by the script isn't sampled. 0 disables the profiler.
+func WithProfiling(interval time.Duration) Option {
+	return func(p *Pool) {
+		p.profileInterval = interval
+	}
+}
+
+// Aggregated samples of the profiler, see WithProfiling
+type Profile struct {
+	// time between two samples of an execution
+	Interval time.Duration
+	// ordered by script and stack
+	Samples []ProfileSample
+}
+
+// Number of times a call stack was sampled
+type ProfileSample struct {
+	// short source of the outermost Lua function, the name of registry
+	// scripts (see Run) or a shortened chunk for Eval
+	Script string
+	// functions from the outermost to the innermost one, identified by the
+	// line they are defined at, e.g. "myscript:12", or "myscript:main" for the
+	// chunk itself
+	Stack []string
+	Count int
+}
+
+// Writes the samples in the folded format of flamegraph.pl and speedscope, one
+// "script;outer;...;inner count" line per call stack
+func (p Profile) WriteFolded(w io.Writer) error {
+	for _, s := range p.Samples {
+		frames := append([]string{s.Script}, s.Stack...)
+		for i, f := range frames {
+			frames[i] = strings.ReplaceAll(f, ";", ":")
+		}
+		if _, err := fmt.Fprintf(w, "%s %d\n", strings.Join(frames, ";"), s.Count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the samples collected since the pool was created or ResetProfile was
+// called, empty unless the pool uses WithProfiling
+func (p *Pool) Profile() Profile {
+	if p.profiler == nil {
+		return Profile{}
+	}
+	return p.profiler.profile()
+}
+
+// Discards the samples collected so far
+func (p *Pool) ResetProfile() {
+	if p.profiler != nil {
+		p.profiler.reset()
+	}
+}
+
+type profiler struct {
+	interval time.Duration
+
+	mux sync.Mutex
+	// sample counts by script and frames joined by profileSeparator
+	samples map[string]int
+}
+
+const profileSeparator = "\x00"
+
+func newProfiler(interval time.Duration) *profiler {
+	return &profiler{
+		interval: interval,
+		samples:  make(map[string]int),
+	}
+}
+
+// records the current call stack of l
+func (pr *profiler) sample(l *lua.State) {
+	var frames []string
+	script := "?"
+	for level := 0; ; level++ {
+		f, ok := lua.Stack(l, level)
+		if !ok {
+			break
+		}
+		d, _ := lua.Info(l, "Sn", f)
+		if d.What != "Go" {
+			script = d.ShortSource
+		}
+		frames = append(frames, profileFrame(d))
+	}
+	if len(frames) == 0 {
+		return
+	}
+	// outermost first, keeping the root of deep stacks
+	slices.Reverse(frames)
+	if len(frames) > maxProfileDepth {
+		frames = frames[:maxProfileDepth]
+	}
+	key := script + profileSeparator + strings.Join(frames, profileSeparator)
+
+	pr.mux.Lock()
+	defer pr.mux.Unlock()
+	if _, ok := pr.samples[key]; !ok && len(pr.samples) >= maxProfileStacks {
+		key = script + profileSeparator + otherProfileFrame
+	}
+	pr.samples[key]++
+}
+
+// formats a frame as "name (source:line)", or "source:line" as go-lua usually
+// can't resolve function names
+func profileFrame(d lua.Debug) string {
+	var where string
+	switch d.What {
+	case "Go":
+		where = "[Go]"
+	case "main":
+		where = d.ShortSource + ":main"
+	default:
+		where = fmt.Sprintf("%s:%d", d.ShortSource, d.LineDefined)
+	}
+	if d.Name == "" {
+		return where
+	}
+	return d.Name + " (" + where + ")"
+}
+
+func (pr *profiler) profile() Profile {
+	pr.mux.Lock()
+	profile := Profile{
+		Interval: pr.interval,
+		Samples:  make([]ProfileSample, 0, len(pr.samples)),
+	}
+	for key, count := range pr.samples {
+		frames := strings.Split(key, profileSeparator)
+		profile.Samples = append(profile.Samples, ProfileSample{
+			Script: frames[0],
+			Stack:  frames[1:],
+			Count:  count,
+		})
+	}
+	pr.mux.Unlock()
+	sort.Slice(profile.Samples, func(i, j int) bool {
+		a, b := profile.Samples[i], profile.Samples[j]
+		if a.Script != b.Script {
+			return a.Script < b.Script
+		}
+		return strings.Join(a.Stack, profileSeparator) < strings.Join(b.Stack, profileSeparator)
+	})
+	return profile
+}
+
+func (pr *profiler) reset() {
+	pr.mux.Lock()
+	pr.samples = make(map[string]int)
+	pr.mux.Unlock()
+}
@@ -0,0 +1,102 @@
+package pool
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProfiling(t *testing.T) {
+	scripts := NewScriptRegistry()
+	err := scripts.Register("hot", `local function spin(n)
+	local x = 0
+	for i = 1, n do x = x + i end
+	return x
+end
+local x = spin(...)
+return x`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lpool := NewPool(1, nil, WithScriptRegistry(scripts), WithProfiling(time.Millisecond))
+	defer lpool.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !profiled(lpool.Profile(), "hot", "hot:1") {
+		if time.Now().After(deadline) {
+			t.Fatalf("spin was never sampled: %+v", lpool.Profile())
+		}
+		if _, err := lpool.Run(context.Background(), "hot", 1_000_000); err != nil {
+			t.Fatal(err)
+		}
+	}
+	profile := lpool.Profile()
+	if profile.Interval != time.Millisecond {
+		t.Errorf("unexpected interval %v", profile.Interval)
+	}
+	if stack := profile.Samples[0].Stack; stack[0] != "hot:main" {
+		t.Errorf("expected the main chunk as outermost frame but got %v", stack)
+	}
+
+	var buf bytes.Buffer
+	if err := profile.WriteFolded(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "hot;hot:main;hot:1 ") {
+		t.Errorf("unexpected folded stacks %q", buf.String())
+	}
+
+	lpool.ResetProfile()
+	if samples := lpool.Profile().Samples; len(samples) != 0 {
+		t.Errorf("expected no samples after reset but got %+v", samples)
+	}
+}
+
+func TestProfilingDeepStacks(t *testing.T) {
+	lpool := NewPool(1, nil, WithProfiling(time.Millisecond))
+	defer lpool.Close()
+	code := `local function spin(n) local x = 0 for i = 1, n do x = x + i end return x end
+local function deep(d) if d == 0 then return spin(1000000) end local x = deep(d - 1) return x end
+local x = deep(100)
+return x`
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(lpool.Profile().Samples) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("never sampled")
+		}
+		if _, err := lpool.Eval(context.Background(), code); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, s := range lpool.Profile().Samples {
+		if len(s.Stack) > maxProfileDepth || !strings.HasSuffix(s.Stack[0], ":main") {
+			t.Errorf("expected truncated stacks rooted at the main chunk but got %v", s.Stack)
+		}
+	}
+}
+
+func profiled(profile Profile, script string, frame string) bool {
+	for _, s := range profile.Samples {
+		if s.Script == script && s.Stack[len(s.Stack)-1] == frame {
+			return true
+		}
+	}
+	return false
+}
+
+func TestProfilingDisabled(t *testing.T) {
+	lpool := NewPool(1, nil)
+	defer lpool.Close()
+	lpool.Eval(context.Background(), "for i = 1, 100000 do end")
+	if samples := lpool.Profile().Samples; len(samples) != 0 {
+		t.Errorf("expected no samples but got %+v", samples)
+	}
+
+	if _, err := New(1, nil, WithProfiling(-time.Second)); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("expected %v but got %v", ErrInvalidOption, err)
+	}
+}
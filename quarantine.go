@@ -0,0 +1,42 @@
+package pool
+
+import (
+	"fmt"
+
+	lua "github.com/epikur-io/go-lua"
+	"github.com/epikur-io/go-lua-pool/generic"
+)
+
+// Reason of VMs quarantined after maxErrors consecutive errors, see
+// WithQuarantine
+var ErrRepeatedErrors = fmt.Errorf("repeated execution errors")
+
+// Reason of VMs quarantined after failing validation, e.g. by WithChaos
+var ErrInvalidVM = generic.ErrInvalidState
+
+// A quarantined VM with the reason and time it was quarantined
+type QuarantinedVM = generic.Quarantined[*lua.State]
+
+// Moves misbehaving VMs to a quarantine instead of destroying them, so they
+// can be inspected (see Quarantined) before they are recycled. VMs failing
+// validation are quarantined as well as VMs whose last maxErrors executions
+// by Do, Eval, CallGlobal and Run failed, 0 disables the latter. Errors of
+// canceled or timed out contexts don't count. Quarantined VMs are replaced
+// right away, up to size of them are kept, the oldest is closed first.
+func WithQuarantine(maxErrors, size int) Option {
+	return func(p *Pool) {
+		p.maxErrors = maxErrors
+		p.quarantineSize = size
+	}
+}
+
+// Returns the quarantined VMs, oldest first. The VMs are no longer used by the
+// pool and may be inspected, but not by several goroutines at once.
+func (p *Pool) Quarantined() []QuarantinedVM {
+	return p.core.Quarantined()
+}
+
+// Closes a quarantined VM, false if vm isn't quarantined
+func (p *Pool) RecycleQuarantined(vm *lua.State) bool {
+	return p.core.Recycle(vm)
+}
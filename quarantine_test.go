@@ -0,0 +1,53 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+func TestQuarantine(t *testing.T) {
+	lpool := NewPool(1, func() *lua.State {
+		vm := NewLuaVM()
+		lua.DoString(vm, "calls = 0")
+		return vm
+	}, WithQuarantine(2, 4))
+	ctx := context.Background()
+
+	// errors in a row only
+	for _, code := range []string{"error('a')", "return 1", "error('b')"} {
+		lpool.Eval(ctx, code)
+	}
+	if n := len(lpool.Quarantined()); n != 0 {
+		t.Fatalf("expected no quarantined VM but got %d", n)
+	}
+	vm := lpool.Acquire()
+	lpool.Release(vm)
+	lpool.Eval(ctx, "calls = calls + 1; error('c')")
+	q := lpool.Quarantined()
+	if len(q) != 1 || q[0].State != vm || !errors.Is(q[0].Reason, ErrRepeatedErrors) {
+		t.Fatalf("expected the failing VM in quarantine but got %+v", q)
+	}
+	// the VM can be inspected
+	vm.Global("calls")
+	if n, _ := vm.ToInteger(-1); n != 1 {
+		t.Errorf("expected the state of the VM to be kept but got %d calls", n)
+	}
+	vm.Pop(1)
+
+	replacement, err := lpool.AcquireWithTimeout(time.Second)
+	if err != nil || replacement == vm {
+		t.Fatalf("expected a replacement but got %v", err)
+	}
+	lpool.Release(replacement)
+	if !lpool.RecycleQuarantined(vm) || len(lpool.Quarantined()) != 0 {
+		t.Errorf("expected the VM to be recycled")
+	}
+
+	if _, err := New(1, nil, WithQuarantine(-1, 1)); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("expected %v but got %v", ErrInvalidOption, err)
+	}
+}
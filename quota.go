@@ -0,0 +1,82 @@
+package pool
+
+import (
+	"context"
+	"time"
+)
+
+// QuotaProfile bundles the limits of an execution. Profiles can be assigned per
+// pool (WithQuotaProfile), per script (ScriptRegistry.SetQuotaProfile) and per
+// call (ContextWithQuota), the most specific profile applies as a whole.
+// Zero fields disable the corresponding limit. Memory can't be limited per VM
+// with go-lua, see the README.
+type QuotaProfile struct {
+	// identifies the profile, e.g. a customer tier
+	Name string
+	// maximum number of Lua instructions, see WithInstructionLimit
+	Instructions int
+	// maximum CPU time, see WithCPUQuota
+	CPUTime time.Duration
+	// maximum wall-clock time of the execution, see RunWithTimeout
+	Timeout time.Duration
+	// limits for converting the results of Eval, CallGlobal, Run, ... to Go values
+	Output ConvertLimits
+}
+
+type quotaKey struct{}
+
+// Uses the given profile as default quota of all executions of the pool
+func WithQuotaProfile(q QuotaProfile) Option {
+	return func(p *Pool) {
+		p.quota = q
+	}
+}
+
+// Returns a context applying the given quota profile to the executions it is
+// passed to, overriding the profiles of the pool and the script
+func ContextWithQuota(ctx context.Context, q QuotaProfile) context.Context {
+	return context.WithValue(ctx, quotaKey{}, q)
+}
+
+// Returns the quota profile set by ContextWithQuota
+func QuotaFromContext(ctx context.Context) (QuotaProfile, bool) {
+	q, ok := ctx.Value(quotaKey{}).(QuotaProfile)
+	return q, ok
+}
+
+// Assigns a quota profile to all executions of the named script by Run and its
+// variants, overriding the profile of the pool. The script doesn't need to be
+// registered yet.
+func (r *ScriptRegistry) SetQuotaProfile(name string, q QuotaProfile) {
+	r.mux.Lock()
+	r.quotas[name] = q
+	r.mux.Unlock()
+}
+
+// Removes the quota profile of the named script, see SetQuotaProfile
+func (r *ScriptRegistry) RemoveQuotaProfile(name string) {
+	r.mux.Lock()
+	delete(r.quotas, name)
+	r.mux.Unlock()
+}
+
+func (r *ScriptRegistry) quotaProfile(name string) (QuotaProfile, bool) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	q, ok := r.quotas[name]
+	return q, ok
+}
+
+// returns the quota of an execution, script is empty for executions of
+// arbitrary code
+func (p *Pool) quotaFor(ctx context.Context, script string) QuotaProfile {
+	if q, ok := QuotaFromContext(ctx); ok {
+		return q
+	}
+	if script != "" && p.scripts != nil {
+		if q, ok := p.scripts.quotaProfile(script); ok {
+			return q
+		}
+	}
+	return p.quota
+}
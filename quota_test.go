@@ -0,0 +1,42 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestQuotaProfiles(t *testing.T) {
+	free := QuotaProfile{Name: "free", Instructions: 10000}
+	pro := QuotaProfile{Name: "pro", Timeout: 20 * time.Millisecond}
+
+	scripts := NewScriptRegistry()
+	scripts.Register("spin", "while true do end")
+	scripts.Register("list", "local t = {} for i = 1, 100 do t[i] = i end return t")
+	scripts.SetQuotaProfile("list", QuotaProfile{Output: ConvertLimits{MaxItems: 10}})
+	lpool := NewPool(1, nil, WithScriptRegistry(scripts), WithQuotaProfile(free))
+	ctx := context.Background()
+
+	// pool profile
+	if _, err := lpool.Run(ctx, "spin"); !errors.Is(err, ErrInstructionLimit) {
+		t.Errorf("expected instruction limit error but got %v", err)
+	}
+	// call profile
+	_, err := lpool.Run(ContextWithQuota(ctx, pro), "spin")
+	if !errors.Is(err, ErrExecTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected timeout but got %v", err)
+	}
+	// script profile
+	if _, err := lpool.Run(ctx, "list"); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("expected output limit error but got %v", err)
+	}
+	scripts.RemoveQuotaProfile("list")
+	if results, err := lpool.Run(ctx, "list"); err != nil || len(results[0].([]any)) != 100 {
+		t.Errorf("expected 100 items but got %v, %v", results, err)
+	}
+
+	if q, ok := QuotaFromContext(ContextWithQuota(ctx, pro)); !ok || q.Name != "pro" {
+		t.Errorf("expected pro profile but got %+v", q)
+	}
+}
@@ -0,0 +1,123 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	lua "github.com/epikur-io/go-lua"
+	"github.com/epikur-io/go-lua-pool/generic"
+)
+
+var ErrRateLimited = fmt.Errorf("acquire rate exceeded")
+
+// RateLimitError is returned by a RateLimitedPool when the rate is exceeded,
+// it matches ErrRateLimited via errors.Is
+type RateLimitError struct {
+	// time until the next acquire is allowed
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrRateLimited, e.RetryAfter)
+}
+
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+// RateLimitedPool limits the acquires of a pool with a token bucket so bursty
+// callers can't starve the pool for everyone else
+type RateLimitedPool struct {
+	IPool
+	// tokens per second
+	rate  float64
+	burst float64
+	clock generic.Clock
+
+	mux    sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// ensure interface is satisfied
+var _ IPool = &RateLimitedPool{}
+var _ StatsProvider = &RateLimitedPool{}
+
+// Returns the stats of the wrapped pool, zero if it doesn't implement
+// StatsProvider
+func (p *RateLimitedPool) Stats() Stats {
+	return statsOf(p.IPool)
+}
+
+// Wraps p allowing perSecond acquires per second on average and bursts of up
+// to burst acquires. Tokens are refilled by the clock of p if it is a *Pool,
+// see SetClock.
+func NewRateLimitedPool(p IPool, perSecond float64, burst int) *RateLimitedPool {
+	clock := clockOf(p)
+	return &RateLimitedPool{
+		IPool:  p,
+		rate:   perSecond,
+		burst:  float64(burst),
+		clock:  clock,
+		tokens: float64(burst),
+		last:   clock.Now(),
+	}
+}
+
+// Sets the clock refilling the tokens, call it before the pool is used
+func (p *RateLimitedPool) SetClock(clock generic.Clock) {
+	if clock == nil {
+		clock = generic.SystemClock
+	}
+	p.mux.Lock()
+	p.clock = clock
+	p.last = clock.Now()
+	p.mux.Unlock()
+}
+
+// takes a token, returns the time until one is available otherwise
+func (p *RateLimitedPool) take() time.Duration {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	now := p.clock.Now()
+	p.tokens = min(p.burst, p.tokens+now.Sub(p.last).Seconds()*p.rate)
+	p.last = now
+	if p.tokens >= 1 {
+		p.tokens--
+		return 0
+	}
+	if p.rate <= 0 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration((1 - p.tokens) / p.rate * float64(time.Second))
+}
+
+// Waits for the rate limit instead of failing, as Acquire can't return errors
+func (p *RateLimitedPool) Acquire() *lua.State {
+	for {
+		wait := p.take()
+		if wait == 0 {
+			return p.IPool.Acquire()
+		}
+		<-p.clock.NewTimer(wait).C()
+	}
+}
+
+// Fails with a RateLimitError if the rate is exceeded
+func (p *RateLimitedPool) AcquireWithTimeout(to time.Duration) (*lua.State, error) {
+	if wait := p.take(); wait > 0 {
+		return nil, &RateLimitError{RetryAfter: wait}
+	}
+	return p.IPool.AcquireWithTimeout(to)
+}
+
+// Fails with a RateLimitError if the rate is exceeded
+func (p *RateLimitedPool) AcquireWithContext(ctx context.Context) (*lua.State, error) {
+	if wait := p.take(); wait > 0 {
+		return nil, &RateLimitError{RetryAfter: wait}
+	}
+	return p.IPool.AcquireWithContext(ctx)
+}
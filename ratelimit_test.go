@@ -0,0 +1,60 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/epikur-io/go-lua-pool/generic"
+)
+
+func TestRateLimitedPool(t *testing.T) {
+	p := NewRateLimitedPool(NewPool(4, nil), 100, 2)
+	for range 2 {
+		vm, err := p.AcquireWithContext(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.Release(vm)
+	}
+	_, err := p.AcquireWithTimeout(time.Second)
+	var rl *RateLimitError
+	if !errors.Is(err, ErrRateLimited) || !errors.As(err, &rl) || rl.RetryAfter <= 0 || rl.RetryAfter > 10*time.Millisecond {
+		t.Errorf("expected rate limit error but got %v", err)
+	}
+	// waits for the next token
+	start := time.Now()
+	p.Release(p.Acquire())
+	if time.Since(start) == 0 {
+		t.Errorf("expected Acquire to wait")
+	}
+	if s := p.Stats(); s.Idle != 4 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+}
+
+func TestRateLimitedPoolClock(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock := &fixedClock{Clock: generic.SystemClock, now: start}
+	lpool := NewPool(2, nil, WithClock(clock))
+	defer lpool.Close()
+	p := NewRateLimitedPool(lpool, 1, 1)
+	vm, err := p.AcquireWithContext(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Release(vm)
+	var rle *RateLimitError
+	if _, err := p.AcquireWithContext(context.Background()); !errors.As(err, &rle) || rle.RetryAfter != time.Second {
+		t.Fatalf("expected to retry after exactly 1s but got %v", err)
+	}
+
+	// tokens are only refilled as the clock advances
+	clock.now = start.Add(time.Second)
+	if vm, err := p.AcquireWithContext(context.Background()); err != nil {
+		t.Errorf("expected a refilled token but got %v", err)
+	} else {
+		p.Release(vm)
+	}
+}
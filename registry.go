@@ -0,0 +1,80 @@
+package pool
+
+import (
+	lua "github.com/epikur-io/go-lua"
+)
+
+// registry field holding the keys present after the VM was set up
+const registryKeysKey = "lua-pool.registry"
+
+// fields the pool itself adds to the registry of a VM on demand
+var internalRegistryKeys = []string{scriptCacheKey, registryKeysKey}
+
+// Removes all entries added to the Lua registry of a VM while it was in use,
+// e.g. values stashed by Go functions called by scripts, whenever the VM is
+// released. This stops long-lived VMs from growing and from leaking data from
+// one user to the next. Entries present after the VM was set up by the factory
+// and preloaded scripts are kept, as well as the fields given by keep, e.g.
+// metatables created lazily by Go modules (see lua.NewMetaTable).
+func WithRegistryScrub(keep ...string) Option {
+	return func(p *Pool) {
+		p.scrubRegistry = true
+		p.registryKeep = append(p.registryKeep, keep...)
+	}
+}
+
+// records the current keys of the registry
+func snapshotRegistry(vm *lua.State, keep []string) {
+	top := vm.Top()
+	defer vm.SetTop(top)
+	vm.NewTable()
+	keys := vm.Top()
+	vm.PushNil()
+	for vm.Next(lua.RegistryIndex) {
+		vm.Pop(1)
+		vm.PushValue(-1)
+		vm.PushBoolean(true)
+		vm.RawSet(keys)
+	}
+	for _, names := range [][]string{keep, internalRegistryKeys} {
+		for _, name := range names {
+			vm.PushBoolean(true)
+			vm.SetField(keys, name)
+		}
+	}
+	vm.SetField(lua.RegistryIndex, registryKeysKey)
+}
+
+// removes all registry entries added since snapshotRegistry
+func scrubRegistry(vm *lua.State) {
+	top := vm.Top()
+	defer vm.SetTop(top)
+	vm.Field(lua.RegistryIndex, registryKeysKey)
+	if vm.IsNil(-1) {
+		return
+	}
+	keys := vm.Top()
+	// collect added keys first, go-lua doesn't allow removing entries during
+	// a traversal
+	vm.NewTable()
+	added := vm.Top()
+	n := 0
+	vm.PushNil()
+	for vm.Next(lua.RegistryIndex) {
+		vm.Pop(1)
+		vm.PushValue(-1)
+		vm.RawGet(keys)
+		isAdded := vm.IsNil(-1)
+		vm.Pop(1)
+		if isAdded {
+			n++
+			vm.PushValue(-1)
+			vm.RawSetInt(added, n)
+		}
+	}
+	for i := 1; i <= n; i++ {
+		vm.RawGetInt(added, i)
+		vm.PushNil()
+		vm.RawSet(lua.RegistryIndex)
+	}
+}
@@ -0,0 +1,54 @@
+package pool
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+func TestRegistryScrub(t *testing.T) {
+	scripts := NewScriptRegistry()
+	scripts.Register("answer", "return 42")
+	lpool := NewPool(1, func() *lua.State {
+		vm := NewLuaVM()
+		vm.PushString("factory")
+		vm.SetField(lua.RegistryIndex, "setup")
+		// stashes its argument in the registry
+		vm.Register("stash", func(l *lua.State) int {
+			l.PushValue(1)
+			l.SetField(lua.RegistryIndex, "stash")
+			l.PushValue(1)
+			l.SetField(lua.RegistryIndex, "kept")
+			return 0
+		})
+		return vm
+	}, WithScriptRegistry(scripts), WithRegistryScrub("kept"))
+	ctx := context.Background()
+
+	if _, err := lpool.Eval(ctx, `stash("secret")`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lpool.Run(ctx, "answer"); err != nil {
+		t.Fatal(err)
+	}
+	vm := lpool.Acquire()
+	defer lpool.Release(vm)
+	var values []any
+	for _, key := range []string{"stash", "kept", "setup"} {
+		vm.Field(lua.RegistryIndex, key)
+		v, _ := ToValue(vm, -1)
+		values = append(values, v)
+		vm.Pop(1)
+	}
+	if !reflect.DeepEqual(values, []any{nil, "secret", "factory"}) {
+		t.Errorf("unexpected registry values %v", values)
+	}
+	// the script cache survives
+	vm.Field(lua.RegistryIndex, scriptCacheKey)
+	if !vm.IsTable(-1) {
+		t.Errorf("expected the script cache to be kept")
+	}
+	vm.Pop(1)
+}
@@ -0,0 +1,84 @@
+package pool
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+)
+
+// Options of ReloadOnSignal
+type ReloadOptions struct {
+	// signals triggering a reload, defaults to SIGHUP
+	Signals []os.Signal
+	// scripts registered from files are re-read before the update, defaults
+	// to the registry of the pool (see WithScriptRegistry)
+	Registry *ScriptRegistry
+	// called after every reload with the number of idle VMs replaced right
+	// away, the names of the changed scripts and the errors of reading them
+	OnReload func(replaced int, changed []string, err error)
+}
+
+// Reloads the Lua code whenever the process receives one of the signals, e.g.
+// "kill -HUP <pid>": scripts registered from files are re-read and all VMs get
+// a rolling update (see RollingUpdate). Scripts failing to load keep their
+// previous version. Results are logged by the logger of the pool. Call the
+// returned function to stop listening.
+func (p *Pool) ReloadOnSignal(opts ReloadOptions) (stop func()) {
+	if len(opts.Signals) == 0 {
+		opts.Signals = []os.Signal{syscall.SIGHUP}
+	}
+	if opts.Registry == nil {
+		opts.Registry = p.scripts
+	}
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(signals, opts.Signals...)
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				p.logger.Info("lua pool: reloading", slog.String("signal", sig.String()))
+				replaced, changed, err := p.reload(opts.Registry)
+				if err != nil {
+					p.logger.Error("lua pool: failed to reload scripts", slog.String("error", err.Error()))
+				}
+				p.logger.Info("lua pool: reloaded",
+					slog.Int("replaced", replaced),
+					slog.Any("changed", changed))
+				if opts.OnReload != nil {
+					opts.OnReload(replaced, changed, err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
+
+// re-reads the files of the registry and updates the VMs, every pool gets a
+// single rolling update no matter how many scripts changed
+func (p *Pool) reload(r *ScriptRegistry) (replaced int, changed []string, err error) {
+	if r != nil {
+		var errs []error
+		for name := range r.Files() {
+			ok, err := r.reread(name)
+			if err != nil {
+				errs = append(errs, err)
+			} else if ok {
+				changed = append(changed, name)
+			}
+		}
+		sort.Strings(changed)
+		err = errors.Join(errs...)
+		// other pools preloading the changed scripts
+		r.refreshPools(changed, p)
+	}
+	return p.RollingUpdate(), changed, err
+}
@@ -0,0 +1,94 @@
+//go:build unix
+
+package pool
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+func TestReloadOnSignal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "greet.lua")
+	if err := os.WriteFile(path, []byte(`return "v1"`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r := NewScriptRegistry()
+	if err := r.RegisterFile("greet", path); err != nil {
+		t.Fatal(err)
+	}
+	lpool := NewPool(1, nil, WithScriptRegistry(r))
+
+	reloaded := make(chan []string, 1)
+	stop := lpool.ReloadOnSignal(ReloadOptions{
+		Signals: []os.Signal{syscall.SIGUSR1},
+		OnReload: func(replaced int, changed []string, err error) {
+			if err != nil || replaced != 1 {
+				t.Errorf("unexpected reload result %d, %v", replaced, err)
+			}
+			reloaded <- changed
+		},
+	})
+	defer stop()
+
+	if err := os.WriteFile(path, []byte(`return "v2"`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+	select {
+	case changed := <-reloaded:
+		if !slices.Equal(changed, []string{"greet"}) {
+			t.Errorf("unexpected changed scripts %v", changed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected reload")
+	}
+	res, err := lpool.Run(context.Background(), "greet")
+	if err != nil || len(res) != 1 || res[0] != "v2" {
+		t.Errorf("unexpected result %v, %v", res, err)
+	}
+}
+
+func TestReloadRollsPoolsOnce(t *testing.T) {
+	dir := t.TempDir()
+	r := NewScriptRegistry()
+	for _, name := range []string{"a", "b"} {
+		path := filepath.Join(dir, name+".lua")
+		if err := os.WriteFile(path, []byte(`return 1`), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.RegisterFile(name, path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var created atomic.Int32
+	factory := func() *lua.State {
+		created.Add(1)
+		return NewLuaVM()
+	}
+	lpool := NewPool(1, factory, WithScriptRegistry(r), WithPreloadScripts("a", "b"))
+	defer lpool.Close()
+	other := NewPool(1, factory, WithScriptRegistry(r), WithPreloadScripts("a", "b"))
+	defer other.Close()
+	for _, name := range []string{"a", "b"} {
+		if err := os.WriteFile(filepath.Join(dir, name+".lua"), []byte(`return 2`), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	created.Store(0)
+	replaced, changed, err := lpool.reload(r)
+	if err != nil || replaced != 1 || len(changed) != 2 {
+		t.Fatalf("unexpected reload result %d, %v, %v", replaced, changed, err)
+	}
+	waitIdle(t, other, 1)
+	if n := created.Load(); n != 2 {
+		t.Errorf("expected every pool to replace its VM once but %d VMs were created", n)
+	}
+}
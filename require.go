@@ -0,0 +1,140 @@
+package pool
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+// Sets package.path of every VM created by the pool
+func WithPackagePath(path string) Option {
+	return func(p *Pool) {
+		p.packagePath = &path
+	}
+}
+
+// Sets package.cpath of every VM created by the pool. go-lua can't load C
+// modules, an empty cpath makes that explicit.
+func WithPackageCPath(cpath string) Option {
+	return func(p *Pool) {
+		p.packageCPath = &cpath
+	}
+}
+
+// Adds a searcher (see package.searchers) to every VM created by the pool. The
+// searchers are consulted in the given order after package.preload and before
+// the file system, e.g. FSSearcher or ScriptRegistry.Searcher.
+func WithSearcher(searcher lua.Function) Option {
+	return func(p *Pool) {
+		p.searchers = append(p.searchers, searcher)
+	}
+}
+
+// Preloads a Go implemented module into every VM created by the pool, the
+// module is loaded by require(name). Replacement VMs, e.g. after Update, get
+// the module as well.
+func WithModule(name string, loader lua.Function) Option {
+	return func(p *Pool) {
+		p.modules = append(p.modules, lua.RegistryFunction{Name: name, Function: loader})
+	}
+}
+
+// applies the module and package options to a new VM, package options are
+// skipped for VMs without the package library
+func (p *Pool) setupPackage(vm *lua.State) {
+	top := vm.Top()
+	defer vm.SetTop(top)
+	if len(p.modules) > 0 {
+		lua.SubTable(vm, lua.RegistryIndex, "_PRELOAD")
+		for _, m := range p.modules {
+			vm.PushGoFunction(m.Function)
+			vm.SetField(-2, m.Name)
+		}
+		vm.Pop(1)
+	}
+	vm.Global("package")
+	if !vm.IsTable(-1) {
+		return
+	}
+	if p.packagePath != nil {
+		vm.PushString(*p.packagePath)
+		vm.SetField(-2, "path")
+	}
+	if p.packageCPath != nil {
+		vm.PushString(*p.packageCPath)
+		vm.SetField(-2, "cpath")
+	}
+	if len(p.searchers) == 0 {
+		return
+	}
+	vm.Field(-1, "searchers")
+	if !vm.IsTable(-1) {
+		return
+	}
+	searchers := vm.Top()
+	// move the existing searchers behind the preload searcher
+	n := vm.RawLength(searchers)
+	shift := len(p.searchers)
+	for i := n; i > 1; i-- {
+		vm.RawGetInt(searchers, i)
+		vm.RawSetInt(searchers, i+shift)
+	}
+	for i, searcher := range p.searchers {
+		vm.PushGoFunction(searcher)
+		vm.RawSetInt(searchers, i+2)
+	}
+}
+
+// Returns a searcher for WithSearcher loading Lua modules from fsys. Module
+// names are mapped to paths like package.path does: "a.b" is looked up as
+// "a/b.lua" and "a/b/init.lua".
+// Reads are checked against the access policy of the pool (see CheckAccess).
+func FSSearcher(fsys fs.FS) lua.Function {
+	return func(l *lua.State) int {
+		name := lua.CheckString(l, 1)
+		base := strings.ReplaceAll(name, ".", "/")
+		var tried strings.Builder
+		for _, file := range []string{base + ".lua", path.Join(base, "init.lua")} {
+			if err := CheckAccess(l, Access{Kind: AccessFile, Op: "read", Target: file}); err != nil {
+				lua.Errorf(l, "error loading module '%s':\n\t%s", name, err.Error())
+			}
+			source, err := fs.ReadFile(fsys, file)
+			if err != nil {
+				fmt.Fprintf(&tried, "\n\tno file '%s' in fs", file)
+				continue
+			}
+			if err := lua.LoadBuffer(l, string(source), "@"+file, "t"); err != nil {
+				lua.Errorf(l, "error loading module '%s' from file '%s':\n\t%s", name, file, err.Error())
+			}
+			l.PushString(file)
+			return 2
+		}
+		l.PushString(tried.String())
+		return 1
+	}
+}
+
+// Returns a searcher for WithSearcher loading modules from the registry.
+// "a.b" finds the script named "a.b" or "a/b", e.g. "lib/greet.lua"
+// registered by RegisterFS can be required as "lib.greet".
+func (r *ScriptRegistry) Searcher() lua.Function {
+	return func(l *lua.State) int {
+		name := lua.CheckString(l, 1)
+		for _, scriptName := range []string{name, strings.ReplaceAll(name, ".", "/")} {
+			s, err := r.get(scriptName)
+			if err != nil {
+				continue
+			}
+			if err := s.push(l); err != nil {
+				lua.Errorf(l, "error loading module '%s' from script '%s':\n\t%s", name, scriptName, err.Error())
+			}
+			l.PushString(scriptName)
+			return 2
+		}
+		l.PushString(fmt.Sprintf("\n\tno script '%s' in registry", name))
+		return 1
+	}
+}
@@ -0,0 +1,70 @@
+package pool
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+func TestRequireSearchers(t *testing.T) {
+	modules := fstest.MapFS{
+		"util/strings.lua": {Data: []byte(`return {upper = string.upper}`)},
+		"config/init.lua":  {Data: []byte(`return {name = ...}`)},
+	}
+	scripts := NewScriptRegistry()
+	if _, err := scripts.RegisterFS(testScripts, "testdata/scripts/lib/*.lua"); err != nil {
+		t.Fatal(err)
+	}
+	scripts.Register("math2", "return {double = function(n) return n * 2 end}")
+	lpool := NewPool(1, nil,
+		WithScriptRegistry(scripts),
+		WithPackagePath(""),
+		WithPackageCPath(""),
+		WithSearcher(scripts.Searcher()),
+		WithSearcher(FSSearcher(modules)),
+	)
+	ctx := context.Background()
+
+	results, err := lpool.Eval(ctx, `
+		require("testdata.scripts.lib.greet")
+		return require("util.strings").upper("a"), require("config").name,
+			require("math2").double(2), greet("lua"), package.path`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(results, []any{"A", "config", 4.0, "hello lua", ""}) {
+		t.Errorf("unexpected results %v", results)
+	}
+
+	_, err = lpool.Eval(ctx, `require("missing")`)
+	if err == nil || !strings.Contains(err.Error(), "no script 'missing' in registry") || !strings.Contains(err.Error(), "no file 'missing.lua' in fs") {
+		t.Errorf("expected searcher messages but got %v", err)
+	}
+}
+
+func TestWithModule(t *testing.T) {
+	kv := map[string]any{"answer": 42}
+	lpool := NewPool(1, nil, WithModule("kv", func(l *lua.State) int {
+		l.NewTable()
+		l.PushGoFunction(func(l *lua.State) int {
+			if err := PushValue(l, kv[lua.CheckString(l, 1)]); err != nil {
+				lua.Errorf(l, "%s", err.Error())
+			}
+			return 1
+		})
+		l.SetField(-2, "get")
+		return 1
+	}))
+	for range 2 {
+		results, err := lpool.Eval(context.Background(), `return require("kv").get("answer")`)
+		if err != nil || !reflect.DeepEqual(results, []any{42.0}) {
+			t.Errorf("expected 42 but got %v, %v", results, err)
+		}
+		// replacement VMs have the module as well
+		lpool.Update()
+	}
+}
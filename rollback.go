@@ -0,0 +1,55 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+var ErrNoRollback = fmt.Errorf("no previous factory to roll back to")
+
+// Replaces the factory of the pool, e.g. with one loading a new script bundle,
+// and all VMs (see Update). The previous factory is kept for Rollback. Ends a
+// running canary rollout. Not supported with WithFactory.
+func (p *Pool) UpdateFactory(factory func() *lua.State) error {
+	if len(p.flavors) > 0 {
+		return fmt.Errorf("%w: UpdateFactory with several factories", ErrInvalidOption)
+	}
+	p.setFactory(factory)
+	p.endCanary()
+	p.Update()
+	return nil
+}
+
+// Restores the factory replaced last by UpdateFactory or PromoteCanary and
+// replaces all VMs with VMs of it: idle VMs right away, acquired ones when they
+// are released. Waits until all VMs are replaced or ctx is done, returning the
+// error of ctx in that case, the remaining VMs are still replaced on release.
+// Fails with ErrNoRollback if there is nothing to roll back to, rolling back
+// twice doesn't restore the newer factory.
+func (p *Pool) Rollback(ctx context.Context) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	p.creatorMux.Lock()
+	if !p.hasPrevious {
+		p.creatorMux.Unlock()
+		return ErrNoRollback
+	}
+	p.creator = p.previous
+	p.previous, p.hasPrevious = nil, false
+	p.creatorMux.Unlock()
+	p.endCanary()
+	p.resetPrototype()
+	p.core.UpdateWithContext(ctx)
+	return ctx.Err()
+}
+
+// makes factory the factory of the pool and keeps the current one for Rollback
+func (p *Pool) setFactory(factory func() *lua.State) {
+	p.creatorMux.Lock()
+	defer p.creatorMux.Unlock()
+	p.previous, p.hasPrevious = p.creator, true
+	p.creator = factory
+}
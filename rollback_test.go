@@ -0,0 +1,59 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+func TestRollback(t *testing.T) {
+	version := func(n string) func() *lua.State {
+		return func() *lua.State {
+			vm := NewLuaVM()
+			lua.DoString(vm, "version = "+n)
+			return vm
+		}
+	}
+	lpool := NewPool(2, version("1"))
+	ctx := context.Background()
+	expect := func(v float64) {
+		t.Helper()
+		for range 2 {
+			results, err := lpool.Eval(ctx, "return version")
+			if err != nil || len(results) != 1 || results[0] != v {
+				t.Errorf("expected version %v but got %v, %v", v, results, err)
+			}
+		}
+	}
+	if err := lpool.Rollback(ctx); !errors.Is(err, ErrNoRollback) {
+		t.Errorf("expected %v but got %v", ErrNoRollback, err)
+	}
+	if err := lpool.UpdateFactory(version("2")); err != nil {
+		t.Fatal(err)
+	}
+	expect(2)
+	if err := lpool.Rollback(ctx); err != nil {
+		t.Fatal(err)
+	}
+	expect(1)
+	if err := lpool.Rollback(ctx); !errors.Is(err, ErrNoRollback) {
+		t.Errorf("expected %v but got %v", ErrNoRollback, err)
+	}
+
+	// a promoted canary is rolled back as well, busy VMs on release
+	if err := lpool.CanaryUpdate(ctx, version("3"), 0.5); err != nil {
+		t.Fatal(err)
+	}
+	lpool.PromoteCanary()
+	expect(3)
+	vm := lpool.Acquire()
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := lpool.Rollback(canceled); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v but got %v", context.Canceled, err)
+	}
+	lpool.Release(vm)
+	expect(1)
+}
@@ -0,0 +1,198 @@
+package pool
+
+import (
+	"strings"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+// SandboxProfile selects the libraries and functions available in VMs created
+// by NewSandboxedVM
+type SandboxProfile int
+
+const (
+	// all standard libraries, like NewLuaVM
+	SandboxTrusted SandboxProfile = iota
+	// base, package, table, string, bit32, math and os.clock, os.time and
+	// os.difftime. Code can't be loaded from files, load only accepts source
+	// code and require only finds modules preloaded into package.preload.
+	// collectgarbage is removed as it runs a GC of the whole process.
+	SandboxRestricted
+	// base, table, string and math without any way to load further code and
+	// without collectgarbage
+	SandboxMinimal
+)
+
+func (s SandboxProfile) String() string {
+	switch s {
+	case SandboxTrusted:
+		return "trusted"
+	case SandboxRestricted:
+		return "restricted"
+	case SandboxMinimal:
+		return "minimal"
+	}
+	return "unknown"
+}
+
+// Creates a new Lua VM with the libraries of the given profile, the io and
+// debug libraries are only available to trusted VMs
+func NewSandboxedVM(profile SandboxProfile) *lua.State {
+	vm := lua.NewState()
+	switch profile {
+	case SandboxTrusted:
+		lua.OpenLibraries(vm)
+	case SandboxRestricted:
+		openLibraries(vm,
+			lua.RegistryFunction{Name: "_G", Function: lua.BaseOpen},
+			lua.RegistryFunction{Name: "package", Function: lua.PackageOpen},
+			lua.RegistryFunction{Name: "table", Function: lua.TableOpen},
+			lua.RegistryFunction{Name: "string", Function: lua.StringOpen},
+			lua.RegistryFunction{Name: "bit32", Function: lua.Bit32Open},
+			lua.RegistryFunction{Name: "math", Function: lua.MathOpen},
+			lua.RegistryFunction{Name: "os", Function: lua.OSOpen},
+		)
+		DenyFunctions(vm, "dofile", "loadfile", "collectgarbage", "package.loadlib", "package.searchpath", BinaryChunks)
+		AllowFunctions(vm, "os.clock", "os.time", "os.difftime")
+		restrictPackage(vm)
+	default:
+		openLibraries(vm,
+			lua.RegistryFunction{Name: "_G", Function: lua.BaseOpen},
+			lua.RegistryFunction{Name: "table", Function: lua.TableOpen},
+			lua.RegistryFunction{Name: "string", Function: lua.StringOpen},
+			lua.RegistryFunction{Name: "math", Function: lua.MathOpen},
+		)
+		DenyFunctions(vm, "dofile", "loadfile", "load", "collectgarbage")
+	}
+	return vm
+}
+
+func openLibraries(vm *lua.State, libs ...lua.RegistryFunction) {
+	for _, lib := range libs {
+		lua.Require(vm, lib.Name, lib.Function, true)
+		vm.Pop(1)
+	}
+}
+
+// wraps load so it refuses precompiled chunks, which can crash the VM
+func restrictLoad(vm *lua.State) {
+	vm.Global("load")
+	vm.PushGoClosure(func(l *lua.State) int {
+		if l.Top() < 3 {
+			l.SetTop(3)
+		}
+		l.PushString("t")
+		l.Replace(3)
+		l.PushValue(lua.UpValueIndex(1))
+		l.Insert(1)
+		l.Call(l.Top()-1, lua.MultipleReturns)
+		return l.Top()
+	}, 1)
+	vm.SetGlobal("load")
+}
+
+// limits require to modules in package.preload
+func restrictPackage(vm *lua.State) {
+	vm.Global("package")
+	for _, name := range []string{"path", "cpath"} {
+		vm.PushString("")
+		vm.SetField(-2, name)
+	}
+	// the first searcher looks up package.preload, the others the file system
+	vm.Field(-1, "searchers")
+	for i := vm.RawLength(-1); i > 1; i-- {
+		vm.PushNil()
+		vm.RawSetInt(-2, i)
+	}
+	vm.Pop(2)
+}
+
+// pseudo function name for DenyFunctions making load refuse precompiled chunks
+const BinaryChunks = "load.binary"
+
+// Removes library functions, whole libraries or global functions from a VM,
+// e.g. "os.execute", "io" or "dofile". BinaryChunks keeps load but makes it
+// refuse precompiled chunks, which can crash the VM. Unknown names are ignored.
+func DenyFunctions(vm *lua.State, names ...string) {
+	top := vm.Top()
+	defer vm.SetTop(top)
+	for _, name := range names {
+		if name == BinaryChunks {
+			restrictLoad(vm)
+			continue
+		}
+		lib, fn, ok := strings.Cut(name, ".")
+		if !ok {
+			vm.PushNil()
+			vm.SetGlobal(lib)
+			// a removed library can't be required either
+			lua.SubTable(vm, lua.RegistryIndex, "_LOADED")
+			vm.PushNil()
+			vm.SetField(-2, lib)
+			vm.Pop(1)
+			continue
+		}
+		vm.Global(lib)
+		if vm.IsTable(-1) {
+			vm.PushNil()
+			vm.SetField(-2, fn)
+		}
+		vm.Pop(1)
+	}
+}
+
+// Restricts libraries to the given functions, e.g. AllowFunctions(vm,
+// "os.time", "os.clock") removes all other functions of os. Libraries without
+// an entry are left alone.
+func AllowFunctions(vm *lua.State, names ...string) {
+	top := vm.Top()
+	defer vm.SetTop(top)
+	allowed := make(map[string]map[string]bool)
+	for _, name := range names {
+		if lib, fn, ok := strings.Cut(name, "."); ok {
+			if allowed[lib] == nil {
+				allowed[lib] = make(map[string]bool)
+			}
+			allowed[lib][fn] = true
+		}
+	}
+	for lib, fns := range allowed {
+		vm.Global(lib)
+		if !vm.IsTable(-1) {
+			vm.Pop(1)
+			continue
+		}
+		// collect first, go-lua doesn't allow removing entries during a traversal
+		var denied []string
+		vm.PushNil()
+		for vm.Next(-2) {
+			vm.Pop(1)
+			if vm.TypeOf(-1) != lua.TypeString {
+				continue
+			}
+			if name, _ := vm.ToString(-1); !fns[name] {
+				denied = append(denied, name)
+			}
+		}
+		for _, name := range denied {
+			vm.PushNil()
+			vm.SetField(-2, name)
+		}
+		vm.Pop(1)
+	}
+}
+
+// Removes the given functions from every VM created by the pool, see DenyFunctions
+func WithDeniedFunctions(names ...string) Option {
+	return func(p *Pool) {
+		p.deniedFunctions = append(p.deniedFunctions, names...)
+	}
+}
+
+// Restricts the libraries of every VM created by the pool to the given
+// functions, see AllowFunctions
+func WithAllowedFunctions(names ...string) Option {
+	return func(p *Pool) {
+		p.allowedFunctions = append(p.allowedFunctions, names...)
+	}
+}
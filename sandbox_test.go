@@ -0,0 +1,82 @@
+package pool
+
+import (
+	"testing"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+func TestSandboxProfiles(t *testing.T) {
+	tests := []struct {
+		profile SandboxProfile
+		// expressions which must be true
+		available []string
+	}{
+		{SandboxTrusted, []string{
+			"io ~= nil", "debug ~= nil", "os.execute ~= nil", "dofile ~= nil", "collectgarbage ~= nil",
+		}},
+		{SandboxRestricted, []string{
+			"io == nil", "debug == nil", "dofile == nil", "loadfile == nil", "collectgarbage == nil",
+			"os.execute == nil", "os.getenv == nil", "os.remove == nil", "os.time() > 0",
+			"package.loadlib == nil", "#package.searchers == 1", "package.loaded.os == os",
+			"load('return 1')() == 1", "not pcall(require, 'missing')",
+			"string.upper('a') == 'A'", "math.max(1, 2) == 2", "bit32 ~= nil",
+		}},
+		{SandboxMinimal, []string{
+			"io == nil", "debug == nil", "os == nil", "package == nil", "require == nil",
+			"load == nil", "dofile == nil", "bit32 == nil", "collectgarbage == nil",
+			"table.concat({'a', 'b'}) == 'ab'", "pcall(error) == false",
+		}},
+	}
+	for _, test := range tests {
+		vm := NewSandboxedVM(test.profile)
+		for _, expr := range test.available {
+			if err := lua.DoString(vm, "assert("+expr+")"); err != nil {
+				t.Errorf("%s: %s: %v", test.profile, expr, err)
+			}
+		}
+	}
+}
+
+func TestSandboxRejectsBytecode(t *testing.T) {
+	bytecode, err := compile("chunk", "return 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm := NewSandboxedVM(SandboxRestricted)
+	vm.PushString(string(bytecode))
+	vm.SetGlobal("chunk")
+	if err := lua.DoString(vm, "assert(load(chunk) == nil)"); err != nil {
+		t.Error(err)
+	}
+	// the environment argument still works
+	if err := lua.DoString(vm, "assert(load('return x', 'env', 't', {x = 1})() == 1)"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDeniedAndAllowedFunctions(t *testing.T) {
+	lpool := NewPool(1, nil,
+		WithDeniedFunctions("os.execute", "os.remove", "io.popen", "debug", BinaryChunks),
+		WithAllowedFunctions("string.upper", "string.format"),
+	)
+	vm := lpool.Acquire()
+	defer lpool.Release(vm)
+	bytecode, err := compile("chunk", "return 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm.PushString(string(bytecode))
+	vm.SetGlobal("chunk")
+	for _, expr := range []string{
+		"os.execute == nil", "os.remove == nil", "os.time() > 0", "os.clock ~= nil",
+		"io.popen == nil", "io.write ~= nil",
+		"debug == nil", "package.loaded.debug == nil",
+		"load(chunk) == nil", "load('return 1')() == 1",
+		"string.upper('a') == 'A'", "string.lower == nil",
+	} {
+		if err := lua.DoString(vm, "assert("+expr+")"); err != nil {
+			t.Errorf("%s: %v", expr, err)
+		}
+	}
+}
@@ -0,0 +1,518 @@
+package pool
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+var (
+	ErrScriptNotFound   = fmt.Errorf("script not found")
+	ErrScriptExists     = fmt.Errorf("script already registered")
+	ErrNoScriptRegistry = fmt.Errorf("pool has no script registry")
+)
+
+// registry table of a VM holding the compiled scripts
+const scriptCacheKey = "lua-pool.scripts"
+
+// ScriptRegistry holds named scripts which are compiled once when registered and
+// can be run on every pool using the registry (see WithScriptRegistry and Run).
+// VMs load the precompiled bytecode instead of parsing the source again.
+// A registry can be shared by multiple pools.
+type ScriptRegistry struct {
+	mux     sync.RWMutex
+	scripts map[string]*script
+	// source of script versions
+	versions atomic.Uint64
+	// expected SHA-256 checksums of the script sources (see ExpectChecksum)
+	checksums map[string]string
+	// quota profiles of the scripts (see SetQuotaProfile)
+	quotas map[string]QuotaProfile
+
+	// pools using the registry, refreshed when preloaded scripts change
+	pools    map[*Pool]struct{}
+	poolsMux sync.Mutex
+}
+
+// a single version of a script, replaced as a whole on updates
+type script struct {
+	name     string
+	source   string
+	bytecode []byte
+	version  uint64
+	// hex encoded SHA-256 of the source
+	checksum string
+	// file the source was read from (see RegisterFile)
+	path string
+	// shared by all versions of a script
+	metrics *scriptMetrics
+}
+
+type scriptMetrics struct {
+	runs     atomic.Uint64
+	duration atomic.Int64
+	errors   atomic.Uint64
+
+	mux           sync.Mutex
+	lastError     string
+	lastErrorTime time.Time
+}
+
+// records an execution which finished at now
+func (m *scriptMetrics) record(now time.Time, duration time.Duration, err error) {
+	m.runs.Add(1)
+	m.duration.Add(int64(duration))
+	if err == nil {
+		return
+	}
+	m.errors.Add(1)
+	m.mux.Lock()
+	m.lastError = err.Error()
+	m.lastErrorTime = now
+	m.mux.Unlock()
+}
+
+// ScriptStats contains the execution metrics of a script
+type ScriptStats struct {
+	Name string
+	// hex encoded SHA-256 of the current source
+	Checksum string
+	// number of executions
+	Runs uint64
+	// total execution time
+	Duration time.Duration
+	// number of failed executions
+	Errors uint64
+	// message of the latest failure and when it happened, empty if none failed
+	LastError     string
+	LastErrorTime time.Time
+}
+
+func NewScriptRegistry() *ScriptRegistry {
+	return &ScriptRegistry{
+		scripts:   make(map[string]*script),
+		checksums: make(map[string]string),
+		quotas:    make(map[string]QuotaProfile),
+		pools:     make(map[*Pool]struct{}),
+	}
+}
+
+// Compiles and registers a script under the given name
+func (r *ScriptRegistry) Register(name string, source string) error {
+	return r.register(name, source, "")
+}
+
+// Reads, compiles and registers the content of a file under the given name.
+// The script can be reloaded from the file by ReloadFile.
+func (r *ScriptRegistry) RegisterFile(name string, path string) error {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return r.register(name, string(source), path)
+}
+
+func (r *ScriptRegistry) register(name string, source string, path string) error {
+	bytecode, err := compile(name, source)
+	if err != nil {
+		return err
+	}
+	sum := checksum(source)
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if _, ok := r.scripts[name]; ok {
+		return fmt.Errorf("%w: %s", ErrScriptExists, name)
+	}
+	if err := r.verify(name, sum); err != nil {
+		return err
+	}
+	r.scripts[name] = &script{
+		name:     name,
+		source:   source,
+		bytecode: bytecode,
+		version:  r.versions.Add(1),
+		checksum: sum,
+		path:     path,
+		metrics:  &scriptMetrics{},
+	}
+	return nil
+}
+
+// Registers all files of fsys matching the glob pattern (see fs.Glob), e.g. of
+// an embed.FS. The script names are the file paths without the ".lua"
+// extension. Returns the names of the registered scripts.
+func (r *ScriptRegistry) RegisterFS(fsys fs.FS, pattern string) ([]string, error) {
+	paths, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(paths))
+	for _, path := range paths {
+		source, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return names, err
+		}
+		name := strings.TrimSuffix(path, ".lua")
+		if err := r.register(name, string(source), ""); err != nil {
+			return names, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// Re-reads the file of a script registered by RegisterFile and replaces the
+// script if the content changed. Executions already running finish with the
+// previous version. If the new content fails to compile the previous version
+// stays in place.
+func (r *ScriptRegistry) ReloadFile(name string) (changed bool, err error) {
+	changed, err = r.reread(name)
+	if changed {
+		r.refreshPools([]string{name}, nil)
+	}
+	return changed, err
+}
+
+// re-reads the file of a script without updating the pools preloading it
+func (r *ScriptRegistry) reread(name string) (bool, error) {
+	old, err := r.get(name)
+	if err != nil {
+		return false, err
+	}
+	if old.path == "" {
+		return false, fmt.Errorf("script %s was not registered from a file", name)
+	}
+	source, err := os.ReadFile(old.path)
+	if err != nil {
+		return false, err
+	}
+	return r.swap(name, string(source))
+}
+
+// Publishes a new version of a script, registering it if it doesn't exist yet,
+// and returns the version now in use. The swap is atomic: executions already
+// running finish with the previous version while new executions use the new
+// one. VMs of pools preloading the script get a rolling update (see
+// RollingUpdate) before Publish returns. If the source fails to compile the
+// previous version stays in place.
+func (r *ScriptRegistry) Publish(name string, source string) (uint64, error) {
+	if _, err := r.replace(name, source); err != nil {
+		if !errors.Is(err, ErrScriptNotFound) {
+			return 0, err
+		}
+		if err := r.register(name, source, ""); err != nil {
+			return 0, err
+		}
+	}
+	return r.Version(name)
+}
+
+// Returns the current version of a script, versions increase with every change
+func (r *ScriptRegistry) Version(name string) (uint64, error) {
+	s, err := r.get(name)
+	if err != nil {
+		return 0, err
+	}
+	return s.version, nil
+}
+
+// replaces the source of an existing script, returns false if it didn't change
+func (r *ScriptRegistry) replace(name string, source string) (bool, error) {
+	changed, err := r.swap(name, source)
+	if changed {
+		r.refreshPools([]string{name}, nil)
+	}
+	return changed, err
+}
+
+// like replace but leaves the pools preloading the script alone
+func (r *ScriptRegistry) swap(name string, source string) (bool, error) {
+	bytecode, err := compile(name, source)
+	if err != nil {
+		return false, err
+	}
+	r.mux.Lock()
+	old, ok := r.scripts[name]
+	if !ok {
+		r.mux.Unlock()
+		return false, fmt.Errorf("%w: %s", ErrScriptNotFound, name)
+	}
+	if old.source == source {
+		r.mux.Unlock()
+		return false, nil
+	}
+	sum := checksum(source)
+	if err := r.verify(name, sum); err != nil {
+		r.mux.Unlock()
+		return false, err
+	}
+	r.scripts[name] = &script{
+		name:     name,
+		source:   source,
+		bytecode: bytecode,
+		version:  r.versions.Add(1),
+		checksum: sum,
+		path:     old.path,
+		metrics:  old.metrics,
+	}
+	r.mux.Unlock()
+	return true, nil
+}
+
+func (r *ScriptRegistry) attach(p *Pool) {
+	r.poolsMux.Lock()
+	r.pools[p] = struct{}{}
+	r.poolsMux.Unlock()
+}
+
+// forgets a closed pool
+func (r *ScriptRegistry) detach(p *Pool) {
+	r.poolsMux.Lock()
+	delete(r.pools, p)
+	r.poolsMux.Unlock()
+}
+
+// replaces the VMs of all open pools preloading any of the given scripts,
+// except the given pool
+func (r *ScriptRegistry) refreshPools(names []string, except *Pool) {
+	r.poolsMux.Lock()
+	var pools []*Pool
+	for p := range r.pools {
+		if p == except || p.Closed() {
+			continue
+		}
+		if slices.ContainsFunc(p.preloads, func(name string) bool { return slices.Contains(names, name) }) {
+			pools = append(pools, p)
+		}
+	}
+	r.poolsMux.Unlock()
+	for _, p := range pools {
+		p.RollingUpdate()
+	}
+}
+
+// Returns the files of all scripts registered by RegisterFile keyed by script name
+func (r *ScriptRegistry) Files() map[string]string {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	files := make(map[string]string)
+	for name, s := range r.scripts {
+		if s.path != "" {
+			files[name] = s.path
+		}
+	}
+	return files
+}
+
+// Returns the names of all registered scripts in alphabetical order
+func (r *ScriptRegistry) Names() []string {
+	r.mux.RLock()
+	names := make([]string, 0, len(r.scripts))
+	for name := range r.scripts {
+		names = append(names, name)
+	}
+	r.mux.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// Returns the execution metrics of all registered scripts ordered by name
+func (r *ScriptRegistry) Stats() []ScriptStats {
+	r.mux.RLock()
+	stats := make([]ScriptStats, 0, len(r.scripts))
+	for _, s := range r.scripts {
+		s.metrics.mux.Lock()
+		lastError, lastErrorTime := s.metrics.lastError, s.metrics.lastErrorTime
+		s.metrics.mux.Unlock()
+		stats = append(stats, ScriptStats{
+			Name:          s.name,
+			Checksum:      s.checksum,
+			Runs:          s.metrics.runs.Load(),
+			Duration:      time.Duration(s.metrics.duration.Load()),
+			Errors:        s.metrics.errors.Load(),
+			LastError:     lastError,
+			LastErrorTime: lastErrorTime,
+		})
+	}
+	r.mux.RUnlock()
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Name < stats[j].Name
+	})
+	return stats
+}
+
+func (r *ScriptRegistry) get(name string) (*script, error) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	s, ok := r.scripts[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrScriptNotFound, name)
+	}
+	return s, nil
+}
+
+// chunk name used for error messages and tracebacks
+func chunkName(name string) string {
+	return "=" + name
+}
+
+// compiles the source to bytecode which can be loaded into any VM
+func compile(name string, source string) ([]byte, error) {
+	vm := lua.NewState()
+	if err := lua.LoadBuffer(vm, source, chunkName(name), "t"); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := vm.Dump(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// pushes the compiled script function, every VM loads the bytecode of a script
+// version only once and caches the function in its registry
+func (s *script) push(vm *lua.State) error {
+	lua.SubTable(vm, lua.RegistryIndex, scriptCacheKey)
+	vm.Field(-1, s.name)
+	if vm.IsTable(-1) {
+		vm.RawGetInt(-1, 2)
+		version, _ := vm.ToNumber(-1)
+		if uint64(version) == s.version {
+			vm.RawGetInt(-2, 1)
+			// keep only the function
+			vm.Replace(-4)
+			vm.Pop(2)
+			return nil
+		}
+		vm.Pop(1)
+	}
+	vm.Pop(1)
+	if err := vm.Load(bytes.NewReader(s.bytecode), chunkName(s.name), "b"); err != nil {
+		vm.Remove(-2)
+		return err
+	}
+	// cache entry {function, version}
+	vm.CreateTable(2, 0)
+	vm.PushValue(-2)
+	vm.RawSetInt(-2, 1)
+	vm.PushNumber(float64(s.version))
+	vm.RawSetInt(-2, 2)
+	vm.SetField(-3, s.name)
+	vm.Remove(-2)
+	return nil
+}
+
+// Uses the given registry for Run
+func WithScriptRegistry(r *ScriptRegistry) Option {
+	return func(p *Pool) {
+		p.scripts = r
+	}
+}
+
+// Runs a script of the script registry on a pooled VM. Arguments and results
+// are converted like in Eval, the script receives the arguments as varargs (...).
+// Errors raised by the script are returned as *ScriptError.
+func (p *Pool) Run(ctx context.Context, name string, args ...any) ([]any, error) {
+	s, err := p.script(name)
+	if err != nil {
+		return nil, err
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	q := p.quotaFor(ctx, name)
+	var results []any
+	err = p.do(ctx, q, func(vm *lua.State) error {
+		var err error
+		results, err = p.runScript(ctx, vm, s, args, q.Output)
+		return err
+	})
+	return results, err
+}
+
+// returns the current version of a script of the pool's registry
+func (p *Pool) script(name string) (*script, error) {
+	if p.scripts == nil {
+		return nil, ErrNoScriptRegistry
+	}
+	return p.scripts.get(name)
+}
+
+// Calls hook after every execution of a script of the registry (Run,
+// RunWithTimeout, RunBatch, RunStream, ...) with the script name, the
+// execution time and the error of the script if it failed, e.g. to count
+// failures per script in a metrics system. Waiting for a VM is not included,
+// failed acquires don't call the hook.
+func WithScriptHook(hook func(ctx context.Context, name string, duration time.Duration, err error)) Option {
+	return func(p *Pool) {
+		p.scriptHooks = append(p.scriptHooks, hook)
+	}
+}
+
+// runs the script on the VM, records the metrics and calls the script hooks,
+// the results are converted with the given limits
+func (p *Pool) runScript(ctx context.Context, vm *lua.State, s *script, args []any, limits ConvertLimits) (results []any, err error) {
+	start := p.clock.Now()
+	defer func() {
+		now := p.clock.Now()
+		duration := now.Sub(start)
+		s.metrics.record(now, duration, err)
+		for _, hook := range p.scriptHooks {
+			hook(ctx, s.name, duration, err)
+		}
+	}()
+	vm.PushGoFunction(tracebackHandler)
+	handler := vm.Top()
+	if err := s.push(vm); err != nil {
+		return nil, err
+	}
+	return call(vm, handler, handler, args, limits)
+}
+
+// Executes the given scripts of the script registry (see WithScriptRegistry) in
+// every VM created by the pool, after the VM factory and in the given order.
+// This keeps new VMs, e.g. after Update, consistent with the registry without a
+// custom factory. Failing scripts are logged and skipped.
+func WithPreloadScripts(names ...string) Option {
+	return func(p *Pool) {
+		p.preloads = append(p.preloads, names...)
+	}
+}
+
+func (p *Pool) preload(vm *lua.State) {
+	for _, name := range p.preloads {
+		if err := p.preloadScript(vm, name); err != nil {
+			p.logger.Error("lua pool: failed to preload script",
+				slog.String("script", name),
+				slog.String("error", err.Error()))
+		}
+	}
+}
+
+func (p *Pool) preloadScript(vm *lua.State, name string) error {
+	s, err := p.script(name)
+	if err != nil {
+		return err
+	}
+	top := vm.Top()
+	defer vm.SetTop(top)
+	vm.PushGoFunction(tracebackHandler)
+	handler := vm.Top()
+	if err := s.push(vm); err != nil {
+		return err
+	}
+	_, err = call(vm, handler, handler, nil, ConvertLimits{})
+	return err
+}
@@ -0,0 +1,391 @@
+package pool
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	lua "github.com/epikur-io/go-lua"
+	"github.com/epikur-io/go-lua-pool/generic"
+)
+
+func TestRunScript(t *testing.T) {
+	scripts := NewScriptRegistry()
+	if err := scripts.Register("add", "local a, b = ... return a + b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := scripts.Register("fail", "\nerror('failed')"); err != nil {
+		t.Fatal(err)
+	}
+	lpool := NewPool(1, nil, WithScriptRegistry(scripts))
+
+	for range 3 {
+		results, err := lpool.Run(context.Background(), "add", 40, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(results, []any{42.0}) {
+			t.Errorf("unexpected results %#v", results)
+		}
+	}
+
+	_, err := lpool.Run(context.Background(), "fail")
+	var scriptErr *ScriptError
+	if !errors.As(err, &scriptErr) {
+		t.Fatalf("expected script error but got %v", err)
+	}
+	if !strings.Contains(err.Error(), "fail:2:") {
+		t.Errorf("expected error to reference the script name and line but got %q", err)
+	}
+
+	if _, err := lpool.Run(context.Background(), "missing"); !errors.Is(err, ErrScriptNotFound) {
+		t.Errorf("expected %v but got %v", ErrScriptNotFound, err)
+	}
+
+	stats := scripts.Stats()
+	if len(stats) != 2 || stats[0].Name != "add" || stats[0].Runs != 3 || stats[1].Runs != 1 {
+		t.Errorf("unexpected script stats %+v", stats)
+	}
+}
+
+func TestScriptErrors(t *testing.T) {
+	scripts := NewScriptRegistry()
+	if err := scripts.Register("check", "if ... < 0 then error('negative') end return ..."); err != nil {
+		t.Fatal(err)
+	}
+	type run struct {
+		name string
+		err  error
+	}
+	var runs []run
+	clock := fixedClock{Clock: generic.SystemClock, now: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	lpool := NewPool(1, nil, WithScriptRegistry(scripts), WithClock(clock), WithScriptHook(func(_ context.Context, name string, _ time.Duration, err error) {
+		runs = append(runs, run{name, err})
+	}))
+	defer lpool.Close()
+
+	ctx := context.Background()
+	lpool.Run(ctx, "check", 1)
+	_, runErr := lpool.Run(ctx, "check", -1)
+	if runErr == nil {
+		t.Fatal("expected an error")
+	}
+	lpool.Run(ctx, "check", 2)
+
+	stats := scripts.Stats()[0]
+	if stats.Runs != 3 || stats.Errors != 1 {
+		t.Errorf("unexpected script stats %+v", stats)
+	}
+	if stats.LastError != runErr.Error() || !stats.LastErrorTime.Equal(clock.now) {
+		t.Errorf("unexpected last error %q at %v", stats.LastError, stats.LastErrorTime)
+	}
+	if len(runs) != 3 || runs[0].name != "check" || runs[0].err != nil || runs[1].err == nil {
+		t.Errorf("unexpected hook calls %+v", runs)
+	}
+}
+
+// clock standing still at now
+type fixedClock struct {
+	generic.Clock
+	now time.Time
+}
+
+func (c fixedClock) Now() time.Time {
+	return c.now
+}
+
+func TestRegisterScript(t *testing.T) {
+	scripts := NewScriptRegistry()
+	if err := scripts.Register("broken", "this is not lua"); err == nil {
+		t.Errorf("expected compile error")
+	}
+	if err := scripts.Register("ok", "return 1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := scripts.Register("ok", "return 2"); !errors.Is(err, ErrScriptExists) {
+		t.Errorf("expected %v but got %v", ErrScriptExists, err)
+	}
+	if names := scripts.Names(); !reflect.DeepEqual(names, []string{"ok"}) {
+		t.Errorf("unexpected names %v", names)
+	}
+}
+
+func TestRunWithoutRegistry(t *testing.T) {
+	lpool := NewPool(1, nil)
+	if _, err := lpool.Run(context.Background(), "add"); !errors.Is(err, ErrNoScriptRegistry) {
+		t.Errorf("expected %v but got %v", ErrNoScriptRegistry, err)
+	}
+}
+
+func TestRunScriptBytecodeClosures(t *testing.T) {
+	scripts := NewScriptRegistry()
+	err := scripts.Register("counter", `
+		local prefix = ...
+		local function make()
+			local n = 0
+			return function() n = n + 1 return n end
+		end
+		local next = make()
+		next()
+		counter_calls = (counter_calls or 0) + 1
+		return prefix .. next(), counter_calls
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lpool := NewPool(1, nil, WithScriptRegistry(scripts))
+	for i := 1; i <= 2; i++ {
+		results, err := lpool.Run(context.Background(), "counter", "n=")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(results, []any{"n=2", float64(i)}) {
+			t.Errorf("unexpected results %#v", results)
+		}
+	}
+}
+
+var benchmarkScript = strings.Repeat("do local t = {} for i = 1, 10 do t[i] = string.format('%d', i) end end\n", 200)
+
+func BenchmarkLoadSource(b *testing.B) {
+	vm := lua.NewState()
+	for range b.N {
+		if err := lua.LoadBuffer(vm, benchmarkScript, "=bench", "t"); err != nil {
+			b.Fatal(err)
+		}
+		vm.Pop(1)
+	}
+}
+
+func BenchmarkLoadBytecode(b *testing.B) {
+	bytecode, err := compile("bench", benchmarkScript)
+	if err != nil {
+		b.Fatal(err)
+	}
+	vm := lua.NewState()
+	b.ResetTimer()
+	for range b.N {
+		if err := vm.Load(bytes.NewReader(bytecode), "=bench", "b"); err != nil {
+			b.Fatal(err)
+		}
+		vm.Pop(1)
+	}
+}
+
+func TestPreloadScripts(t *testing.T) {
+	scripts := NewScriptRegistry()
+	if err := scripts.Register("lib", "function double(n) return n * 2 end"); err != nil {
+		t.Fatal(err)
+	}
+	if err := scripts.Register("broken", "error('broken')"); err != nil {
+		t.Fatal(err)
+	}
+	var logs bytes.Buffer
+	lpool := NewPool(2, nil,
+		WithScriptRegistry(scripts),
+		WithPreloadScripts("broken", "lib"),
+		WithLogger(slog.New(slog.NewTextHandler(&logs, nil))),
+	)
+
+	check := func() {
+		for range lpool.Cap() {
+			results, err := lpool.CallGlobal(context.Background(), "double", 21)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(results, []any{42.0}) {
+				t.Errorf("unexpected results %#v", results)
+			}
+		}
+	}
+	check()
+	// replacement VMs are preloaded as well
+	lpool.Update()
+	check()
+
+	if !strings.Contains(logs.String(), "script=broken") {
+		t.Errorf("expected failing preload to be logged but got %q", logs.String())
+	}
+}
+
+func TestRegistryDetachesClosedPools(t *testing.T) {
+	scripts := NewScriptRegistry()
+	for range 5 {
+		NewPool(1, nil, WithScriptRegistry(scripts)).Close()
+	}
+	lpool := NewPool(1, nil, WithScriptRegistry(scripts))
+	defer lpool.Close()
+	scripts.poolsMux.Lock()
+	attached := len(scripts.pools)
+	scripts.poolsMux.Unlock()
+	if attached != 1 {
+		t.Errorf("expected only the open pool to be attached but got %d", attached)
+	}
+}
+
+func TestReloadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "version.lua")
+	if err := os.WriteFile(path, []byte(`return 1`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	scripts := NewScriptRegistry()
+	if err := scripts.RegisterFile("version", path); err != nil {
+		t.Fatal(err)
+	}
+	lpool := NewPool(1, nil, WithScriptRegistry(scripts))
+	run := func() any {
+		results, err := lpool.Run(context.Background(), "version")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return results[0]
+	}
+	if v := run(); v != 1.0 {
+		t.Errorf("expected version 1 but got %v", v)
+	}
+
+	if changed, err := scripts.ReloadFile("version"); changed || err != nil {
+		t.Errorf("expected unchanged script but got %v, %v", changed, err)
+	}
+	os.WriteFile(path, []byte(`return 2`), 0o644)
+	if changed, err := scripts.ReloadFile("version"); !changed || err != nil {
+		t.Errorf("expected changed script but got %v, %v", changed, err)
+	}
+	if v := run(); v != 2.0 {
+		t.Errorf("expected version 2 but got %v", v)
+	}
+
+	// broken updates keep the previous version
+	os.WriteFile(path, []byte(`return (`), 0o644)
+	if _, err := scripts.ReloadFile("version"); err == nil {
+		t.Errorf("expected compile error")
+	}
+	if v := run(); v != 2.0 {
+		t.Errorf("expected version 2 but got %v", v)
+	}
+}
+
+func TestPublishScript(t *testing.T) {
+	scripts := NewScriptRegistry()
+	v1, err := scripts.Publish("lib", "function version() return 1 end")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := scripts.Publish("slow", "wait() return 1"); err != nil {
+		t.Fatal(err)
+	}
+	blocked, proceed := make(chan struct{}), make(chan struct{})
+	lpool := NewPool(2, func() *lua.State {
+		vm := NewLuaVM()
+		vm.Register("wait", func(l *lua.State) int {
+			blocked <- struct{}{}
+			<-proceed
+			return 0
+		})
+		return vm
+	}, WithScriptRegistry(scripts), WithPreloadScripts("lib"))
+
+	// in-flight executions finish with the previous version
+	done := make(chan []any)
+	go func() {
+		results, err := lpool.Run(context.Background(), "slow")
+		if err != nil {
+			t.Error(err)
+		}
+		done <- results
+	}()
+	<-blocked
+	if _, err := scripts.Publish("slow", "return 2"); err != nil {
+		t.Fatal(err)
+	}
+	close(proceed)
+	if results := <-done; !reflect.DeepEqual(results, []any{1.0}) {
+		t.Errorf("expected previous version but got %v", results)
+	}
+	if results, err := lpool.Run(context.Background(), "slow"); err != nil || !reflect.DeepEqual(results, []any{2.0}) {
+		t.Errorf("expected new version but got %v, %v", results, err)
+	}
+
+	// VMs preloading a published script are replaced, busy ones on release
+	lvm := lpool.Acquire()
+	v2, err := scripts.Publish("lib", "function version() return 2 end")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v2 <= v1 {
+		t.Errorf("expected version to increase but got %d after %d", v2, v1)
+	}
+	lpool.Release(lvm)
+	for range lpool.Cap() {
+		results, err := lpool.CallGlobal(context.Background(), "version")
+		if err != nil || !reflect.DeepEqual(results, []any{2.0}) {
+			t.Errorf("expected preloaded version 2 but got %v, %v", results, err)
+		}
+	}
+
+	// unchanged sources and compile errors keep the current version
+	if v, err := scripts.Publish("lib", "function version() return 2 end"); v != v2 || err != nil {
+		t.Errorf("expected version %d but got %d, %v", v2, v, err)
+	}
+	if _, err := scripts.Publish("lib", "function ("); err == nil {
+		t.Errorf("expected compile error")
+	}
+	if v, _ := scripts.Version("lib"); v != v2 {
+		t.Errorf("expected version %d but got %d", v2, v)
+	}
+}
+
+//go:embed testdata/scripts
+var testScripts embed.FS
+
+func TestRegisterFS(t *testing.T) {
+	scripts := NewScriptRegistry()
+	fsys, err := fs.Sub(testScripts, "testdata/scripts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, err := scripts.RegisterFS(fsys, "*.lua")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lib, err := scripts.RegisterFS(fsys, "lib/*.lua")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names = append(names, lib...)
+	if !reflect.DeepEqual(names, []string{"mul", "lib/greet"}) {
+		t.Errorf("unexpected script names %v", names)
+	}
+
+	lpool := NewPool(1, nil, WithScriptRegistry(scripts), WithPreloadScripts("lib/greet"))
+	results, err := lpool.Run(context.Background(), "mul", 6, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(results, []any{42.0}) {
+		t.Errorf("unexpected results %#v", results)
+	}
+	results, err = lpool.CallGlobal(context.Background(), "greet", "fs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(results, []any{"hello fs"}) {
+		t.Errorf("unexpected results %#v", results)
+	}
+
+	if _, err := scripts.RegisterFS(fsys, "*.txt"); err == nil {
+		t.Errorf("expected compile error for non lua file")
+	}
+	if _, err := scripts.RegisterFS(fsys, "[invalid"); err == nil {
+		t.Errorf("expected error for invalid pattern")
+	}
+}
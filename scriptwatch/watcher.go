@@ -0,0 +1,178 @@
+// Package scriptwatch reloads scripts registered from files when the files change.
+package scriptwatch
+
+import (
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	pool "github.com/epikur-io/go-lua-pool"
+	"github.com/fsnotify/fsnotify"
+)
+
+// Options of a Watcher
+type Options struct {
+	// time to wait for further changes before reloading, editors tend to
+	// write files in multiple steps (default 100ms)
+	Debounce time.Duration
+	// defaults to slog.Default()
+	Logger *slog.Logger
+	// called after every reload with the names of the changed scripts
+	OnReload func(changed []string, err error)
+}
+
+// Watcher watches the files of all scripts registered by
+// ScriptRegistry.RegisterFile. Changed scripts are recompiled and published so
+// new executions and preloaded VMs use the new version (see
+// ScriptRegistry.Publish).
+type Watcher struct {
+	registry *pool.ScriptRegistry
+	opts     Options
+	fsw      *fsnotify.Watcher
+
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// Starts watching the script files of the registry with default options
+func New(registry *pool.ScriptRegistry) (*Watcher, error) {
+	return NewWithOptions(registry, Options{})
+}
+
+// Starts watching the script files of the registry
+func NewWithOptions(registry *pool.ScriptRegistry, opts Options) (*Watcher, error) {
+	if opts.Debounce <= 0 {
+		opts.Debounce = 100 * time.Millisecond
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	w := &Watcher{
+		registry: registry,
+		opts:     opts,
+		fsw:      fsw,
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	// watch the directories, editors often replace files instead of writing them
+	dirs := make(map[string]struct{})
+	for _, path := range registry.Files() {
+		dirs[filepath.Dir(filepath.Clean(path))] = struct{}{}
+	}
+	for dir := range dirs {
+		if err := fsw.Add(dir); err != nil {
+			fsw.Close()
+			return nil, err
+		}
+	}
+	go w.run()
+	return w, nil
+}
+
+// Stops watching
+func (w *Watcher) Close() error {
+	var err error
+	w.once.Do(func() {
+		close(w.done)
+		<-w.stopped
+		err = w.fsw.Close()
+	})
+	return err
+}
+
+func (w *Watcher) run() {
+	defer close(w.stopped)
+	var timer *time.Timer
+	var fire <-chan time.Time
+	pending := make(map[string]struct{})
+	for {
+		select {
+		case <-w.done:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case ev, ok := <-w.fsw.Events:
+			if !ok {
+				return
+			}
+			if !ev.Has(fsnotify.Write) && !ev.Has(fsnotify.Create) && !ev.Has(fsnotify.Rename) {
+				continue
+			}
+			names := w.scriptsFor(ev.Name)
+			if len(names) == 0 {
+				continue
+			}
+			for _, name := range names {
+				pending[name] = struct{}{}
+			}
+			if timer == nil {
+				timer = time.NewTimer(w.opts.Debounce)
+			} else {
+				timer.Reset(w.opts.Debounce)
+			}
+			fire = timer.C
+		case err, ok := <-w.fsw.Errors:
+			if !ok {
+				return
+			}
+			w.opts.Logger.Error("lua pool: script watcher failed", slog.String("error", err.Error()))
+		case <-fire:
+			fire = nil
+			w.reload(pending)
+			pending = make(map[string]struct{})
+		}
+	}
+}
+
+// returns the scripts registered from the given file
+func (w *Watcher) scriptsFor(path string) []string {
+	path = filepath.Clean(path)
+	var names []string
+	for name, file := range w.registry.Files() {
+		if filepath.Clean(file) == path {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func (w *Watcher) reload(pending map[string]struct{}) {
+	names := make([]string, 0, len(pending))
+	for name := range pending {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var changed []string
+	var firstErr error
+	for _, name := range names {
+		ok, err := w.registry.ReloadFile(name)
+		if err != nil {
+			w.opts.Logger.Error("lua pool: failed to reload script",
+				slog.String("script", name),
+				slog.String("error", err.Error()))
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if ok {
+			changed = append(changed, name)
+			sum, _ := w.registry.Checksum(name)
+			w.opts.Logger.Info("lua pool: reloaded script",
+				slog.String("script", name),
+				slog.String("checksum", sum))
+		}
+	}
+	if w.opts.OnReload != nil {
+		w.opts.OnReload(changed, firstErr)
+	}
+}
@@ -0,0 +1,60 @@
+package scriptwatch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	pool "github.com/epikur-io/go-lua-pool"
+)
+
+func TestReloadOnChange(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "greet.lua")
+	if err := os.WriteFile(path, []byte(`return "v1"`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	scripts := pool.NewScriptRegistry()
+	if err := scripts.RegisterFile("greet", path); err != nil {
+		t.Fatal(err)
+	}
+	lpool := pool.NewPool(2, nil, pool.WithScriptRegistry(scripts))
+
+	reloaded := make(chan []string, 1)
+	w, err := NewWithOptions(scripts, Options{
+		Debounce: 10 * time.Millisecond,
+		OnReload: func(changed []string, err error) {
+			if err != nil {
+				t.Error(err)
+			}
+			reloaded <- changed
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	if err := os.WriteFile(path, []byte(`return "v2"`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case changed := <-reloaded:
+		if !reflect.DeepEqual(changed, []string{"greet"}) {
+			t.Errorf("expected greet to be reloaded but got %v", changed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("script was not reloaded")
+	}
+
+	results, err := lpool.Run(context.Background(), "greet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(results, []any{"v2"}) {
+		t.Errorf("expected new script version but got %v", results)
+	}
+}
@@ -0,0 +1,237 @@
+package pool
+
+import (
+	lua "github.com/epikur-io/go-lua"
+)
+
+// registry field holding the snapshot of the globals, see WithGlobalsSnapshot
+const snapshotKey = "lua-pool.snapshot"
+
+// Takes a snapshot of the global table of every VM once it was set up by the
+// factory and preloaded scripts and restores it whenever the VM is released:
+// added globals are removed, and changed or removed ones are restored. This
+// gives every user a fresh set of globals without creating a new VM.
+// The snapshot is shallow, changes inside tables stored in globals, e.g.
+// string or math, are kept. Added globals are tracked by a metatable on the
+// global table; if scripts replace it, or the factory installed its own, all
+// globals are compared on release, which is considerably slower.
+// See WithReadOnlyGlobals for an alternative.
+func WithGlobalsSnapshot(enabled bool) Option {
+	return func(p *Pool) {
+		p.snapshotGlobals = enabled
+	}
+}
+
+// stores a copy of the global table and its metatable in the registry and
+// starts tracking added globals
+func snapshotGlobals(vm *lua.State) {
+	top := vm.Top()
+	defer vm.SetTop(top)
+	vm.RawGetInt(lua.RegistryIndex, lua.RegistryIndexGlobals)
+	globals := vm.Top()
+	vm.NewTable()
+	snapshot := vm.Top()
+
+	// saved globals as set for lookups and as sequence of key value pairs
+	// for fast traversals
+	vm.NewTable()
+	set := vm.Top()
+	vm.NewTable()
+	list := vm.Top()
+	n := 0
+	vm.PushNil()
+	for vm.Next(globals) {
+		vm.PushValue(-2)
+		vm.PushValue(-2)
+		vm.RawSet(set)
+		vm.PushValue(-2)
+		vm.RawSetInt(list, n+1)
+		vm.RawSetInt(list, n+2)
+		n += 2
+	}
+	vm.PushValue(set)
+	vm.SetField(snapshot, "set")
+	vm.PushValue(list)
+	vm.SetField(snapshot, "list")
+
+	if vm.MetaTable(globals) {
+		vm.SetField(snapshot, "meta")
+	} else {
+		vm.NewTable()
+		vm.PushValue(-1)
+		vm.SetField(snapshot, "added")
+		vm.PushGoClosure(trackGlobal, 1)
+		vm.NewTable()
+		vm.Insert(-2)
+		vm.SetField(-2, "__newindex")
+		// go-lua caches missing metamethods with a single bit, a metatable
+		// without __index would lose __newindex after the first read of an
+		// undefined global
+		vm.NewTable()
+		vm.SetField(-2, "__index")
+		vm.PushValue(-1)
+		vm.SetField(snapshot, "tracker")
+		vm.SetMetaTable(globals)
+	}
+	vm.PushValue(snapshot)
+	vm.SetField(lua.RegistryIndex, snapshotKey)
+}
+
+// __newindex of the global table recording added globals
+func trackGlobal(l *lua.State) int {
+	n := l.RawLength(lua.UpValueIndex(1))
+	l.PushValue(2)
+	l.RawSetInt(lua.UpValueIndex(1), n+1)
+	l.SetTop(3)
+	l.RawSet(1)
+	return 0
+}
+
+// resets the global table to the snapshot
+func restoreGlobals(vm *lua.State) {
+	top := vm.Top()
+	defer vm.SetTop(top)
+	vm.Field(lua.RegistryIndex, snapshotKey)
+	if vm.IsNil(-1) {
+		return
+	}
+	snapshot := vm.Top()
+	vm.RawGetInt(lua.RegistryIndex, lua.RegistryIndexGlobals)
+	globals := vm.Top()
+	vm.Field(snapshot, "tracker")
+	tracker := vm.Top()
+
+	tracked := false
+	if !vm.IsNil(tracker) && vm.MetaTable(globals) {
+		tracked = vm.RawEqual(-1, tracker)
+		vm.Pop(1)
+	}
+	if tracked {
+		removeTrackedGlobals(vm, snapshot, globals)
+	} else {
+		removeAddedGlobals(vm, snapshot, globals)
+	}
+
+	vm.Field(snapshot, "list")
+	list := vm.Top()
+	for i := 1; ; i += 2 {
+		if vm.RawGetInt(list, i); vm.IsNil(-1) {
+			vm.Pop(1)
+			break
+		}
+		vm.RawGetInt(list, i+1)
+		vm.PushValue(-2)
+		vm.RawGet(globals)
+		if vm.RawEqual(-1, -2) {
+			vm.Pop(3)
+			continue
+		}
+		vm.Pop(1)
+		vm.RawSet(globals)
+	}
+	vm.Pop(1)
+
+	if !vm.IsNil(tracker) {
+		vm.PushValue(tracker)
+	} else {
+		vm.Field(snapshot, "meta")
+	}
+	vm.SetMetaTable(globals)
+}
+
+// removes the globals recorded by trackGlobal
+func removeTrackedGlobals(vm *lua.State, snapshot int, globals int) {
+	vm.Field(snapshot, "added")
+	added := vm.Top()
+	for i := vm.RawLength(added); i > 0; i-- {
+		vm.RawGetInt(added, i)
+		vm.PushNil()
+		vm.RawSet(globals)
+		vm.PushNil()
+		vm.RawSetInt(added, i)
+	}
+	vm.Pop(1)
+}
+
+// removes all globals missing in the snapshot by comparing every global
+func removeAddedGlobals(vm *lua.State, snapshot int, globals int) {
+	vm.Field(snapshot, "set")
+	set := vm.Top()
+	// collect added globals first, go-lua doesn't allow removing entries
+	// during a traversal
+	vm.NewTable()
+	added := vm.Top()
+	n := 0
+	vm.PushNil()
+	for vm.Next(globals) {
+		vm.Pop(1)
+		vm.PushValue(-1)
+		vm.RawGet(set)
+		isAdded := vm.IsNil(-1)
+		vm.Pop(1)
+		if isAdded {
+			n++
+			vm.PushValue(-1)
+			vm.RawSetInt(added, n)
+		}
+	}
+	for i := 1; i <= n; i++ {
+		vm.RawGetInt(added, i)
+		vm.PushNil()
+		vm.RawSet(globals)
+	}
+	// the tracker missed the changes, reset it
+	vm.Field(snapshot, "added")
+	if vm.IsTable(-1) {
+		for i := vm.RawLength(-1); i > 0; i-- {
+			vm.PushNil()
+			vm.RawSetInt(-2, i)
+		}
+	}
+	vm.Pop(3)
+}
+
+// sets the global name to the value on top of the stack, both in the global
+// table and the snapshot so restores keep it, and pops the value
+func setSnapshotGlobal(vm *lua.State, name string) {
+	top := vm.Top()
+	defer vm.SetTop(top - 1)
+	vm.Field(lua.RegistryIndex, snapshotKey)
+	if vm.IsNil(-1) {
+		return
+	}
+	snapshot := vm.Top()
+	vm.Field(snapshot, "set")
+	vm.PushString(name)
+	vm.PushValue(top)
+	vm.RawSet(-3)
+
+	// update the pair in the list or append one, removed globals keep their
+	// key with a nil value
+	vm.Field(snapshot, "list")
+	list := vm.Top()
+	i := 1
+	for ; ; i += 2 {
+		vm.RawGetInt(list, i)
+		if vm.IsNil(-1) {
+			vm.Pop(1)
+			vm.PushString(name)
+			vm.RawSetInt(list, i)
+			break
+		}
+		s, ok := vm.ToString(-1)
+		isName := ok && vm.TypeOf(-1) == lua.TypeString && s == name
+		vm.Pop(1)
+		if isName {
+			break
+		}
+	}
+	vm.PushValue(top)
+	vm.RawSetInt(list, i+1)
+
+	// rawset, assignments would be tracked as added globals
+	vm.RawGetInt(lua.RegistryIndex, lua.RegistryIndexGlobals)
+	vm.PushString(name)
+	vm.PushValue(top)
+	vm.RawSet(-3)
+}
@@ -0,0 +1,70 @@
+package pool
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+func TestGlobalsSnapshot(t *testing.T) {
+	lpool := NewPool(1, func() *lua.State {
+		vm := NewLuaVM()
+		lua.DoString(vm, "limit = 10")
+		return vm
+	}, WithGlobalsSnapshot(true))
+	ctx := context.Background()
+
+	_, err := lpool.Eval(ctx, `
+		limit = 20
+		added = {}
+		print = nil
+		setmetatable(_G, {__index = function() return "default" end})`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := lpool.Eval(ctx, "return limit, added, type(print), missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(results, []any{10.0, nil, "function", nil}) {
+		t.Errorf("expected restored globals but got %v", results)
+	}
+
+	// raw acquires are restored on release as well
+	vm := lpool.Acquire()
+	lua.DoString(vm, "limit = 30")
+	lpool.Release(vm)
+	if results, _ := lpool.Eval(ctx, "return limit"); !reflect.DeepEqual(results, []any{10.0}) {
+		t.Errorf("expected restored limit but got %v", results)
+	}
+}
+
+func TestGlobalsSnapshotRawset(t *testing.T) {
+	vm := NewLuaVM()
+	snapshotGlobals(vm)
+	// replacing the metatable of the globals disables tracking
+	if err := lua.DoString(vm, `setmetatable(_G, nil) rawset(_G, "raw", 1) tracked = 2`); err != nil {
+		t.Fatal(err)
+	}
+	restoreGlobals(vm)
+	if err := lua.DoString(vm, "assert(raw == nil) assert(tracked == nil) added = 3"); err != nil {
+		t.Fatal(err)
+	}
+	// tracking works again after the restore
+	restoreGlobals(vm)
+	if err := lua.DoString(vm, "assert(added == nil)"); err != nil {
+		t.Error(err)
+	}
+}
+
+func BenchmarkRestoreGlobals(b *testing.B) {
+	vm := NewLuaVM()
+	snapshotGlobals(vm)
+	for range b.N {
+		vm.PushInteger(1)
+		vm.SetGlobal("x")
+		restoreGlobals(vm)
+	}
+}
@@ -0,0 +1,193 @@
+package pool
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+// SpilloverPool acquires from a primary pool and falls back to a secondary one
+// (e.g. an overflow pool or a NopPool) if the primary is exhausted for longer
+// than a short wait. VMs are released to the pool they came from.
+type SpilloverPool struct {
+	primary   IPool
+	secondary IPool
+	wait      time.Duration
+
+	acquires   atomic.Uint64
+	spillovers atomic.Uint64
+
+	// VMs acquired from the secondary pool
+	spilled map[*lua.State]bool
+	mux     sync.Mutex
+}
+
+// ensure interface is satisfied
+var _ IPool = &SpilloverPool{}
+
+// Creates a pool waiting up to wait for a VM of primary before acquiring from
+// secondary
+func NewSpilloverPool(primary, secondary IPool, wait time.Duration) *SpilloverPool {
+	return &SpilloverPool{
+		primary:   primary,
+		secondary: secondary,
+		wait:      wait,
+		spilled:   make(map[*lua.State]bool),
+	}
+}
+
+// SpilloverStats counts the acquires of a SpilloverPool
+type SpilloverStats struct {
+	// successful acquires
+	Acquires uint64
+	// acquires served by the secondary pool
+	Spillovers uint64
+}
+
+// Returns the fraction of acquires served by the secondary pool
+func (s SpilloverStats) Rate() float64 {
+	if s.Acquires == 0 {
+		return 0
+	}
+	return float64(s.Spillovers) / float64(s.Acquires)
+}
+
+func (p *SpilloverPool) SpilloverStats() SpilloverStats {
+	return SpilloverStats{
+		Acquires:   p.acquires.Load(),
+		Spillovers: p.spillovers.Load(),
+	}
+}
+
+// Returns the number of idle VMs of both pools
+func (p *SpilloverPool) Len() int {
+	return p.primary.Len() + p.secondary.Len()
+}
+
+// Returns the capacity of both pools
+func (p *SpilloverPool) Cap() int {
+	return p.primary.Cap() + p.secondary.Cap()
+}
+
+// Updates both pools
+func (p *SpilloverPool) Update() {
+	p.primary.Update()
+	p.secondary.Update()
+}
+
+// Updates both pools, each with the given timeout
+func (p *SpilloverPool) UpdateWithTimeout(to time.Duration) (int, int) {
+	removed, created := p.primary.UpdateWithTimeout(to)
+	r, c := p.secondary.UpdateWithTimeout(to)
+	return removed + r, created + c
+}
+
+func (p *SpilloverPool) Acquire() *lua.State {
+	if vm, err := p.primary.AcquireWithTimeout(p.wait); err == nil {
+		p.acquires.Add(1)
+		return vm
+	}
+	return p.spill(p.secondary.Acquire())
+}
+
+// Waits up to the given duration in total, fails with the error of the
+// secondary pool
+func (p *SpilloverPool) AcquireWithTimeout(to time.Duration) (*lua.State, error) {
+	start := time.Now()
+	if vm, err := p.primary.AcquireWithTimeout(min(p.wait, to)); err == nil {
+		p.acquires.Add(1)
+		return vm, nil
+	}
+	vm, err := p.secondary.AcquireWithTimeout(max(to-time.Since(start), 0))
+	if err != nil {
+		return nil, err
+	}
+	return p.spill(vm), nil
+}
+
+func (p *SpilloverPool) AcquireWithContext(ctx context.Context) (*lua.State, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	primaryCtx, cancel := context.WithTimeout(ctx, p.wait)
+	vm, err := p.primary.AcquireWithContext(primaryCtx)
+	cancel()
+	if err == nil {
+		p.acquires.Add(1)
+		return vm, nil
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if vm, err = p.secondary.AcquireWithContext(ctx); err != nil {
+		return nil, err
+	}
+	return p.spill(vm), nil
+}
+
+func (p *SpilloverPool) spill(vm *lua.State) *lua.State {
+	p.acquires.Add(1)
+	p.spillovers.Add(1)
+	p.mux.Lock()
+	p.spilled[vm] = true
+	p.mux.Unlock()
+	return vm
+}
+
+// returns the pool vm was acquired from
+func (p *SpilloverPool) owner(vm *lua.State) IPool {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if p.spilled[vm] {
+		return p.secondary
+	}
+	return p.primary
+}
+
+// forgets a VM released to the secondary pool
+func (p *SpilloverPool) released(vm *lua.State, owner IPool) {
+	if owner == p.secondary {
+		p.mux.Lock()
+		delete(p.spilled, vm)
+		p.mux.Unlock()
+	}
+}
+
+func (p *SpilloverPool) Release(vm *lua.State) {
+	owner := p.owner(vm)
+	owner.Release(vm)
+	p.released(vm, owner)
+}
+
+func (p *SpilloverPool) TryRelease(vm *lua.State) error {
+	owner := p.owner(vm)
+	if err := owner.TryRelease(vm); err != nil {
+		return err
+	}
+	p.released(vm, owner)
+	return nil
+}
+
+func (p *SpilloverPool) TryReleaseWithContext(ctx context.Context, vm *lua.State) error {
+	owner := p.owner(vm)
+	if err := owner.TryReleaseWithContext(ctx, vm); err != nil {
+		return err
+	}
+	p.released(vm, owner)
+	return nil
+}
+
+// Returns the sums of the stats of both pools, pools not implementing
+// StatsProvider count as empty
+func (p *SpilloverPool) Stats() Stats {
+	a, b := statsOf(p.primary), statsOf(p.secondary)
+	return Stats{
+		Capacity: a.Capacity + b.Capacity,
+		Idle:     a.Idle + b.Idle,
+		InUse:    a.InUse + b.InUse,
+		Waiting:  a.Waiting + b.Waiting,
+	}
+}
@@ -0,0 +1,38 @@
+package pool
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSpilloverPool(t *testing.T) {
+	primary, secondary := NewPool(1, nil), NewNopPool(1, nil)
+	p := NewSpilloverPool(primary, secondary, 5*time.Millisecond)
+
+	a := p.Acquire()
+	b, err := p.AcquireWithContext(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.AcquireWithTimeout(10 * time.Millisecond); err == nil {
+		t.Errorf("expected both pools to be exhausted")
+	}
+	if s := p.Stats(); s.InUse != 2 || s.Capacity != 2 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+	if s := p.SpilloverStats(); s.Acquires != 2 || s.Spillovers != 1 || s.Rate() != 0.5 {
+		t.Errorf("unexpected spillover stats %+v", s)
+	}
+
+	p.Release(b)
+	if secondary.Stats().InUse != 0 {
+		t.Errorf("expected spilled VM to be released to the secondary pool")
+	}
+	if err := p.TryRelease(a); err != nil {
+		t.Fatal(err)
+	}
+	if primary.Stats().Idle != 1 {
+		t.Errorf("expected VM to be released to the primary pool")
+	}
+}
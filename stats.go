@@ -0,0 +1,64 @@
+package pool
+
+import "encoding/json"
+
+// Stats is a point-in-time snapshot of the pool state
+type Stats struct {
+	// capacity of the pool
+	Capacity int
+	// VMs waiting in the pool
+	Idle int
+	// VMs currently acquired
+	InUse int
+	// callers waiting for a VM
+	Waiting int
+}
+
+// Returns a snapshot of the current pool state, Idle and InUse always add up to
+// Capacity (see generic.Pool.Stats)
+func (p *Pool) Stats() Stats {
+	s := p.core.Stats()
+	return Stats{
+		Capacity: s.Capacity,
+		Idle:     s.Idle,
+		InUse:    s.InUse,
+		Waiting:  s.Waiting,
+	}
+}
+
+// Returns the current pool stats JSON encoded
+func (p *Pool) StatsJSON() ([]byte, error) {
+	return json.Marshal(p.Stats())
+}
+
+// JSON representation of Stats, field names are part of the public API and
+// must not change.
+type statsJSON struct {
+	Capacity int `json:"capacity"`
+	Idle     int `json:"idle"`
+	InUse    int `json:"in_use"`
+	Waiting  int `json:"waiting"`
+}
+
+func (s Stats) MarshalJSON() ([]byte, error) {
+	return json.Marshal(statsJSON{
+		Capacity: s.Capacity,
+		Idle:     s.Idle,
+		InUse:    s.InUse,
+		Waiting:  s.Waiting,
+	})
+}
+
+func (s *Stats) UnmarshalJSON(data []byte) error {
+	var v statsJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*s = Stats{
+		Capacity: v.Capacity,
+		Idle:     v.Idle,
+		InUse:    v.InUse,
+		Waiting:  v.Waiting,
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package pool
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	lpool := NewPool(3, nil)
+	lvm := lpool.Acquire()
+	defer lpool.Release(lvm)
+
+	stats := lpool.Stats()
+	if stats.Capacity != 3 || stats.Idle != 2 || stats.InUse != 1 || stats.Waiting != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestStatsWaiting(t *testing.T) {
+	lpool := NewPool(1, nil)
+	lvm := lpool.Acquire()
+	acquired := make(chan struct{})
+	go func() {
+		lpool.Release(lpool.Acquire())
+		close(acquired)
+	}()
+	for lpool.Stats().Waiting != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	lpool.Release(lvm)
+	<-acquired
+	if stats := lpool.Stats(); stats.Waiting != 0 || stats.Idle != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestStatsJSON(t *testing.T) {
+	lpool := NewPool(2, nil)
+	data, err := lpool.StatsJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"capacity", "idle", "in_use", "waiting"} {
+		if _, ok := fields[name]; !ok {
+			t.Errorf("expected field %q in %s", name, data)
+		}
+	}
+
+	var stats Stats
+	if err := json.Unmarshal(data, &stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats != lpool.Stats() {
+		t.Errorf("expected %+v after round trip but got %+v", lpool.Stats(), stats)
+	}
+}
@@ -0,0 +1,98 @@
+package pool
+
+import (
+	"context"
+	"time"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+// StreamOptions configures RunStream
+type StreamOptions struct {
+	// maximum execution time per input, overrides the timeout of the quota
+	// profile (see QuotaProfile)
+	ItemTimeout time.Duration
+}
+
+// StreamResult holds the outcome of a single input of RunStream
+type StreamResult struct {
+	Input   any
+	Results []any
+	Err     error
+}
+
+// Runs a script of the script registry once per input received from in, passing
+// the input as the only argument (see Run), and sends the results to the
+// returned channel in input order. All inputs run on the same VM, so state kept
+// by the script in the VM stays warm between inputs. The VM is only swapped
+// after Pool.RollingUpdate, an input violating its quota or failed inputs
+// handled like Do handles them (see WithErrorPolicy, WithQuarantine and
+// WithAutoRecycle). The returned channel is closed once in is closed or ctx is
+// done, inputs not processed by then are dropped.
+// An error is returned if the script doesn't exist.
+func (p *Pool) RunStream(ctx context.Context, name string, in <-chan any, opts StreamOptions) (<-chan StreamResult, error) {
+	if _, err := p.script(name); err != nil {
+		return nil, err
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	out := make(chan StreamResult)
+	go func() {
+		defer close(out)
+		vm, err := p.AcquireWithContext(ctx)
+		if err != nil {
+			return
+		}
+		defer func() {
+			if vm != nil {
+				p.Release(vm)
+			}
+		}()
+		for {
+			var input any
+			var ok bool
+			select {
+			case input, ok = <-in:
+				if !ok {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+			res := p.streamItem(ctx, vm, name, input, opts.ItemTimeout)
+			select {
+			case out <- res:
+			case <-ctx.Done():
+				return
+			}
+			if !p.keep(ctx, vm, res.Err) {
+				if vm, err = p.AcquireWithContext(ctx); err != nil {
+					vm = nil
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (p *Pool) streamItem(ctx context.Context, vm *lua.State, name string, input any, timeout time.Duration) StreamResult {
+	res := StreamResult{Input: input}
+	// the latest version of the script, it may have been published meanwhile
+	s, err := p.script(name)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	q := p.quotaFor(ctx, name)
+	if timeout > 0 {
+		q.Timeout = timeout
+	}
+	res.Err = p.exec(ctx, vm, q, nil, func(vm *lua.State) error {
+		var err error
+		res.Results, err = p.runScript(ctx, vm, s, []any{input}, q.Output)
+		return err
+	})
+	return res
+}
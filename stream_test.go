@@ -0,0 +1,121 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+func TestRunStream(t *testing.T) {
+	scripts := NewScriptRegistry()
+	// counts the calls in a global to check that the VM stays warm
+	if err := scripts.Register("count", `
+		local n = ...
+		if n < 0 then spin() end
+		calls = (calls or 0) + 1
+		return n, calls`); err != nil {
+		t.Fatal(err)
+	}
+	lpool := NewPool(2, func() *lua.State {
+		vm := NewLuaVM()
+		lua.DoString(vm, "function spin() while true do end end")
+		return vm
+	}, WithScriptRegistry(scripts))
+
+	in := make(chan any)
+	out, err := lpool.RunStream(context.Background(), "count", in, StreamOptions{ItemTimeout: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for _, n := range []any{1, 2, -1, 3} {
+			in <- n
+		}
+		close(in)
+	}()
+	var results []StreamResult
+	for res := range out {
+		results = append(results, res)
+	}
+	if len(results) != 4 {
+		t.Fatalf("expected 4 results but got %d", len(results))
+	}
+	if !errors.Is(results[2].Err, context.DeadlineExceeded) {
+		t.Errorf("expected item timeout but got %v", results[2].Err)
+	}
+	// the VM is replaced after the timeout
+	for i, calls := range map[int]float64{0: 1, 1: 2, 3: 1} {
+		res := results[i]
+		expected := []any{float64(res.Input.(int)), calls}
+		if res.Err != nil || !reflect.DeepEqual(res.Results, expected) {
+			t.Errorf("item %d: expected %v but got %v, %v", i, expected, res.Results, res.Err)
+		}
+	}
+	waitIdle(t, lpool, 2)
+
+	if _, err := lpool.RunStream(context.Background(), "missing", in, StreamOptions{}); !errors.Is(err, ErrScriptNotFound) {
+		t.Errorf("expected script not found but got %v", err)
+	}
+}
+
+func TestRunStreamCancel(t *testing.T) {
+	scripts := NewScriptRegistry()
+	scripts.Register("echo", "return ...")
+	lpool := NewPool(1, nil, WithScriptRegistry(scripts))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	in := make(chan any)
+	out, err := lpool.RunStream(ctx, "echo", in, StreamOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	in <- "a"
+	if res := <-out; res.Err != nil || !reflect.DeepEqual(res.Results, []any{"a"}) {
+		t.Errorf("unexpected result %+v", res)
+	}
+	cancel()
+	if _, ok := <-out; ok {
+		t.Errorf("expected output to be closed")
+	}
+	// the VM is returned to the pool
+	if _, err := lpool.Eval(context.Background(), "return 1"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRunStreamAutoRecycle(t *testing.T) {
+	scripts := NewScriptRegistry()
+	scripts.Register("count", `
+		calls = (calls or 0) + 1
+		if ... then error("boom") end
+		return calls`)
+	lpool := NewPool(1, nil, WithScriptRegistry(scripts), WithAutoRecycle(2))
+	defer lpool.Close()
+
+	in := make(chan any)
+	out, err := lpool.RunStream(context.Background(), "count", in, StreamOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for _, fail := range []any{false, true, true, false} {
+			in <- fail
+		}
+		close(in)
+	}()
+	var results []StreamResult
+	for res := range out {
+		results = append(results, res)
+	}
+	if len(results) != 4 || results[1].Err == nil || results[2].Err == nil {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	// the VM is replaced after 2 errors in a row
+	if res := results[3]; res.Err != nil || !reflect.DeepEqual(res.Results, []any{float64(1)}) {
+		t.Errorf("expected a fresh VM but got %v, %v", res.Results, res.Err)
+	}
+}
@@ -0,0 +1,211 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+// SwapPool is a handle to a pool which can be replaced as a whole by a new
+// pool built in the background (blue/green deployment, see Swap). VMs are
+// released to the pool they were acquired from.
+type SwapPool struct {
+	size int
+	opts []Option
+
+	current atomic.Pointer[Pool]
+	// serializes Swap and Close
+	swapMux sync.Mutex
+	closed  bool
+
+	mux sync.Mutex
+	// pools of the acquired VMs, which may be swapped out meanwhile
+	owners map[*lua.State]*Pool
+}
+
+// ensure interface is satisfied
+var _ IPool = &SwapPool{}
+
+// Creates a swappable pool, the size and options are used for the pools
+// created by Swap as well (see New)
+func NewSwapPool(size int, vmFactoryFunc func() *lua.State, opts ...Option) (*SwapPool, error) {
+	p, err := New(size, vmFactoryFunc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	s := &SwapPool{size: size, opts: opts, owners: make(map[*lua.State]*Pool)}
+	s.current.Store(p)
+	return s, nil
+}
+
+// Builds a complete new pool with factory and swaps it in once all its VMs
+// are created, so deploys don't slow down acquirers like Update does. The old
+// pool is closed: its idle VMs are dropped right away and acquired ones when
+// they are released, callers waiting for one of its VMs move on to the new
+// pool. Returns the error of ctx if it is done before the new pool is ready,
+// the old pool stays in place then.
+func (s *SwapPool) Swap(ctx context.Context, factory func() *lua.State) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	s.swapMux.Lock()
+	defer s.swapMux.Unlock()
+	if s.closed {
+		return ErrPoolClosed
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	type result struct {
+		p   *Pool
+		err error
+	}
+	ready := make(chan result, 1)
+	go func() {
+		p, err := New(s.size, factory, s.opts...)
+		ready <- result{p, err}
+	}()
+	var r result
+	select {
+	case r = <-ready:
+	case <-ctx.Done():
+		go func() {
+			if r := <-ready; r.p != nil {
+				r.p.Close()
+			}
+		}()
+		return ctx.Err()
+	}
+	if r.err != nil {
+		return r.err
+	}
+	s.current.Swap(r.p).Close()
+	return nil
+}
+
+// Returns the pool currently in place
+func (s *SwapPool) Pool() *Pool {
+	return s.current.Load()
+}
+
+// Closes the current pool, Swap fails with ErrPoolClosed afterwards
+func (s *SwapPool) Close() {
+	s.swapMux.Lock()
+	defer s.swapMux.Unlock()
+	s.closed = true
+	s.current.Load().Close()
+}
+
+func (s *SwapPool) Len() int {
+	return s.current.Load().Len()
+}
+
+func (s *SwapPool) Cap() int {
+	return s.current.Load().Cap()
+}
+
+// Updates the current pool, see Pool.Update
+func (s *SwapPool) Update() {
+	s.current.Load().Update()
+}
+
+func (s *SwapPool) UpdateWithTimeout(to time.Duration) (int, int) {
+	return s.current.Load().UpdateWithTimeout(to)
+}
+
+// Acquire a vm from the current pool (blocking), nil once closed
+func (s *SwapPool) Acquire() *lua.State {
+	vm, _ := s.acquire(func(p *Pool) (*lua.State, error) {
+		if vm := p.Acquire(); vm != nil {
+			return vm, nil
+		}
+		return nil, ErrPoolClosed
+	})
+	return vm
+}
+
+// Like Pool.AcquireWithTimeout, a retry after a swap only waits for the
+// remaining time
+func (s *SwapPool) AcquireWithTimeout(to time.Duration) (*lua.State, error) {
+	deadline := s.current.Load().clock.Now().Add(to)
+	return s.acquire(func(p *Pool) (*lua.State, error) {
+		return p.AcquireWithTimeout(deadline.Sub(p.clock.Now()))
+	})
+}
+
+func (s *SwapPool) AcquireWithContext(ctx context.Context) (*lua.State, error) {
+	return s.acquire(func(p *Pool) (*lua.State, error) {
+		return p.AcquireWithContext(ctx)
+	})
+}
+
+// acquires from the current pool, again from the new one if it was swapped
+// out meanwhile
+func (s *SwapPool) acquire(acquire func(*Pool) (*lua.State, error)) (*lua.State, error) {
+	for {
+		p := s.current.Load()
+		vm, err := acquire(p)
+		if errors.Is(err, ErrPoolClosed) && s.current.Load() != p {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		s.mux.Lock()
+		s.owners[vm] = p
+		s.mux.Unlock()
+		return vm, nil
+	}
+}
+
+// Releases a vm to the pool it was acquired from, see Pool.Release
+func (s *SwapPool) Release(vm *lua.State) {
+	p, _ := s.owner(vm)
+	p.Release(vm)
+}
+
+func (s *SwapPool) TryRelease(vm *lua.State) error {
+	return s.tryRelease(vm, func(p *Pool) error {
+		return p.TryRelease(vm)
+	})
+}
+
+func (s *SwapPool) TryReleaseWithContext(ctx context.Context, vm *lua.State) error {
+	return s.tryRelease(vm, func(p *Pool) error {
+		return p.TryReleaseWithContext(ctx, vm)
+	})
+}
+
+func (s *SwapPool) tryRelease(vm *lua.State, release func(*Pool) error) error {
+	p, owned := s.owner(vm)
+	err := release(p)
+	if err != nil && owned {
+		// keep the owner for another attempt
+		s.mux.Lock()
+		s.owners[vm] = p
+		s.mux.Unlock()
+	}
+	return err
+}
+
+// removes and returns the pool vm was acquired from, the current pool for
+// unknown VMs
+func (s *SwapPool) owner(vm *lua.State) (*Pool, bool) {
+	s.mux.Lock()
+	p, ok := s.owners[vm]
+	delete(s.owners, vm)
+	s.mux.Unlock()
+	if !ok {
+		return s.current.Load(), false
+	}
+	return p, true
+}
+
+// Returns the stats of the current pool
+func (s *SwapPool) Stats() Stats {
+	return s.current.Load().Stats()
+}
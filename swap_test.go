@@ -0,0 +1,87 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	lua "github.com/epikur-io/go-lua"
+	"github.com/epikur-io/go-lua-pool/generic"
+)
+
+func TestSwapPool(t *testing.T) {
+	version := func(n string) func() *lua.State {
+		return func() *lua.State {
+			vm := NewLuaVM()
+			lua.DoString(vm, "version = "+n)
+			return vm
+		}
+	}
+	s, err := NewSwapPool(2, version("1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	old := s.Pool()
+	held := s.Acquire()
+	waiting := make(chan *lua.State)
+	go func() {
+		// waits on the old pool and moves on to the new one
+		vm, _ := s.AcquireWithContext(ctx)
+		waiting <- vm
+	}()
+	second, _ := s.AcquireWithTimeout(time.Second)
+
+	if err := s.Swap(ctx, version("2")); err != nil {
+		t.Fatal(err)
+	}
+	vm := <-waiting
+	if _, ok := s.Pool().VMID(vm); !ok {
+		t.Fatal("expected a VM of the new pool")
+	}
+	vm.Global("version")
+	if n, _ := vm.ToInteger(-1); n != 2 {
+		t.Errorf("expected version 2 but got %d", n)
+	}
+	vm.Pop(1)
+	s.Release(vm)
+
+	// VMs of the old pool go back to it and are dropped
+	s.Release(held)
+	if err := s.TryRelease(second); err != nil {
+		t.Errorf("expected the release to the old pool to succeed but got %v", err)
+	}
+	if !old.Closed() || old.Stats().InUse != 0 {
+		t.Errorf("expected the old pool to be drained but got %+v", old.Stats())
+	}
+	if st := s.Stats(); st.Idle != 2 || st.InUse != 0 {
+		t.Errorf("unexpected stats of the new pool %+v", st)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := s.Swap(canceled, version("3")); err != context.Canceled {
+		t.Errorf("expected %v but got %v", context.Canceled, err)
+	}
+	s.Close()
+	if err := s.Swap(ctx, version("3")); err != ErrPoolClosed {
+		t.Errorf("expected %v but got %v", ErrPoolClosed, err)
+	}
+	if s.Acquire() != nil {
+		t.Errorf("expected no VM from a closed pool")
+	}
+}
+
+func TestSwapPoolAcquireTimeout(t *testing.T) {
+	s, err := NewSwapPool(1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	vm := s.Acquire()
+	defer s.Release(vm)
+	if _, err := s.AcquireWithTimeout(10 * time.Millisecond); !errors.Is(err, generic.ErrTimeout) {
+		t.Errorf("expected %v but got %v", generic.ErrTimeout, err)
+	}
+}
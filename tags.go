@@ -0,0 +1,50 @@
+package pool
+
+import (
+	"context"
+
+	lua "github.com/epikur-io/go-lua"
+	"github.com/epikur-io/go-lua-pool/generic"
+)
+
+var ErrNoTaggedVM = generic.ErrNoTaggedState
+
+// Tags new VMs with the returned tags, e.g. the script bundle the factory
+// loaded (see AcquireWithTag)
+func WithTagger(tagger func(*lua.State) []string) Option {
+	return func(p *Pool) {
+		p.tagger = tagger
+	}
+}
+
+// Prepares a VM acquired by AcquireWithTag which doesn't carry the tag yet,
+// e.g. by loading the script bundle named by the tag. The VM is tagged if load
+// succeeds, a VM load fails on is replaced.
+func WithTagLoader(load func(vm *lua.State, tag string) error) Option {
+	return func(p *Pool) {
+		p.tagLoader = load
+	}
+}
+
+// Adds tags to a VM of the pool, e.g. from a hook which loaded a script bundle.
+// Tags live as long as the VM, its replacement only gets the tags of the
+// tagger.
+func (p *Pool) Tag(vm *lua.State, tags ...string) {
+	p.core.Tag(vm, tags...)
+}
+
+// Returns the tags of a VM of the pool
+func (p *Pool) Tags(vm *lua.State) []string {
+	info, _ := p.core.Info(vm)
+	return info.Tags
+}
+
+// Acquires a VM carrying tag, preferring idle VMs with the tag and preparing
+// another VM with the tag loader otherwise (see generic.Pool.AcquireWithTag).
+// Fails with ErrNoTaggedVM if no tagged VM is idle and no tag loader is
+// configured.
+func (p *Pool) AcquireWithTag(ctx context.Context, tag string) (*lua.State, error) {
+	start := p.debugNow()
+	vm, err := p.core.AcquireWithTag(ctx, tag)
+	return p.finishAcquire(vm, start, err)
+}
@@ -0,0 +1,34 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+func TestAcquireWithTag(t *testing.T) {
+	lpool := NewPool(2, nil, WithTagLoader(func(vm *lua.State, tag string) error {
+		return lua.DoString(vm, "bundle = '"+tag+"'")
+	}))
+	ctx := context.Background()
+	vm, err := lpool.AcquireWithTag(ctx, "billing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tags := lpool.Tags(vm); len(tags) != 1 || tags[0] != "billing" {
+		t.Errorf("unexpected tags %v", tags)
+	}
+	lpool.Release(vm)
+	again, _ := lpool.AcquireWithTag(ctx, "billing")
+	if again != vm {
+		t.Errorf("expected the tagged VM")
+	}
+	lpool.Release(again)
+
+	lpool = NewPool(1, nil)
+	if _, err := lpool.AcquireWithTag(ctx, "billing"); !errors.Is(err, ErrNoTaggedVM) {
+		t.Errorf("expected %v but got %v", ErrNoTaggedVM, err)
+	}
+}
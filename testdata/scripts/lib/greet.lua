@@ -0,0 +1 @@
+function greet(name) return "hello " .. name end
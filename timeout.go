@@ -0,0 +1,35 @@
+package pool
+
+import (
+	"context"
+	"time"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+// Like Run but aborts the script once it runs longer than timeout, returning an
+// error matching ErrExecTimeout and context.DeadlineExceeded. The VM checks the
+// deadline before every instruction, so endless loops are interrupted as well;
+// only long running Go functions called by the script delay the abort. VMs
+// interrupted by the timeout are replaced instead of returned to the pool since
+// their state may be inconsistent. ctx only bounds the wait for a VM and the
+// execution as a whole, the timeout starts once a VM was acquired. The timeout
+// overrides the one of the quota profile (see QuotaProfile).
+func (p *Pool) RunWithTimeout(ctx context.Context, name string, timeout time.Duration, args ...any) ([]any, error) {
+	s, err := p.script(name)
+	if err != nil {
+		return nil, err
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	q := p.quotaFor(ctx, name)
+	q.Timeout = timeout
+	var results []any
+	err = p.do(ctx, q, func(vm *lua.State) error {
+		var err error
+		results, err = p.runScript(ctx, vm, s, args, q.Output)
+		return err
+	})
+	return results, err
+}
@@ -0,0 +1,37 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRunWithTimeout(t *testing.T) {
+	scripts := NewScriptRegistry()
+	scripts.Register("spin", "while true do end")
+	scripts.Register("add", "local a, b = ... return a + b")
+	lpool := NewPool(1, nil, WithScriptRegistry(scripts))
+	lvm := lpool.Acquire()
+	lpool.Release(lvm)
+
+	start := time.Now()
+	if _, err := lpool.RunWithTimeout(context.Background(), "spin", 20*time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded but got %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("expected the script to be aborted but it ran for %s", d)
+	}
+
+	// the slot is available again, on a new VM
+	results, err := lpool.RunWithTimeout(context.Background(), "add", time.Second, 40, 2)
+	if err != nil || !reflect.DeepEqual(results, []any{42.0}) {
+		t.Errorf("expected 42 but got %v, %v", results, err)
+	}
+	vm := lpool.Acquire()
+	defer lpool.Release(vm)
+	if vm == lvm {
+		t.Errorf("expected the interrupted VM to be replaced")
+	}
+}
@@ -0,0 +1,115 @@
+package pool
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+// AcquireSite describes where an outstanding VM was acquired
+type AcquireSite struct {
+	VM *lua.State
+	// see Pool.VMID
+	ID uint64
+	// file:line of the caller
+	Caller string
+	// fully qualified name of the calling function
+	Function string
+	// time of the acquire
+	Time time.Time
+}
+
+// Records the caller of every acquire until the VM is released again, the
+// first caller outside of this package, e.g. of Do or Eval. Intended for
+// debugging leaks, it adds a stack walk to every acquire.
+func WithAcquireTracking(enabled bool) Option {
+	return func(p *Pool) {
+		p.trackAcquires = enabled
+	}
+}
+
+// Returns the acquire sites of all VMs currently held by callers, oldest first.
+// The list is always empty if acquire tracking is disabled.
+func (p *Pool) OutstandingAcquires() []AcquireSite {
+	p.sitesMux.Lock()
+	sites := make([]AcquireSite, 0, len(p.sites))
+	for _, site := range p.sites {
+		sites = append(sites, site)
+	}
+	p.sitesMux.Unlock()
+	sort.Slice(sites, func(i, j int) bool {
+		return sites[i].Time.Before(sites[j].Time)
+	})
+	return sites
+}
+
+// directory of the source files of this package
+var packageDir = func() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Dir(file)
+}()
+
+// true for frames of this package, except of its tests
+func internalFrame(f runtime.Frame) bool {
+	return filepath.Dir(f.File) == packageDir && !strings.HasSuffix(f.File, "_test.go")
+}
+
+func (p *Pool) trackAcquire(vm *lua.State) {
+	if !p.trackAcquires {
+		return
+	}
+	site := AcquireSite{VM: vm, Time: p.clock.Now()}
+	site.ID, _ = p.VMID(vm)
+	if f, ok := acquireCaller(); ok {
+		site.Caller = fmt.Sprintf("%s:%d", f.File, f.Line)
+		site.Function = f.Function
+	}
+	p.sitesMux.Lock()
+	p.sites[vm] = site
+	p.sitesMux.Unlock()
+}
+
+// returns the first caller outside of this package, or the outermost frame of
+// the package if it started the goroutine, e.g. an Executor worker
+func acquireCaller() (runtime.Frame, bool) {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	var last runtime.Frame
+	found := false
+	for {
+		f, more := frames.Next()
+		if f.Function != "" && !strings.HasPrefix(f.Function, "runtime.") {
+			if !internalFrame(f) {
+				return f, true
+			}
+			last, found = f, true
+		}
+		if !more {
+			return last, found
+		}
+	}
+}
+
+func (p *Pool) untrackAcquire(vm *lua.State) (AcquireSite, bool) {
+	if !p.trackAcquires {
+		return AcquireSite{}, false
+	}
+	p.sitesMux.Lock()
+	defer p.sitesMux.Unlock()
+	site, ok := p.sites[vm]
+	delete(p.sites, vm)
+	return site, ok
+}
+
+// puts back a site if the release of a VM failed
+func (p *Pool) restoreAcquire(vm *lua.State, site AcquireSite) {
+	p.sitesMux.Lock()
+	p.sites[vm] = site
+	p.sitesMux.Unlock()
+}
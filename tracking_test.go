@@ -0,0 +1,66 @@
+package pool
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+func TestAcquireTracking(t *testing.T) {
+	lpool := NewPool(2, nil, WithAcquireTracking(true))
+	lvm := lpool.Acquire()
+	lvm2, err := lpool.AcquireWithTimeout(1 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sites := lpool.OutstandingAcquires()
+	if len(sites) != 2 {
+		t.Fatalf("expected 2 outstanding acquires but got %d", len(sites))
+	}
+	for _, site := range sites {
+		if !strings.Contains(site.Caller, "tracking_test.go") {
+			t.Errorf("expected caller in tracking_test.go but got %q", site.Caller)
+		}
+		if !strings.HasSuffix(site.Function, "TestAcquireTracking") {
+			t.Errorf("unexpected caller function %q", site.Function)
+		}
+		if id, _ := lpool.VMID(site.VM); site.ID == 0 || site.ID != id {
+			t.Errorf("expected the ID of the VM but got %d", site.ID)
+		}
+	}
+
+	lpool.Release(lvm)
+	if err := lpool.TryRelease(lvm2); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(lpool.OutstandingAcquires()); n != 0 {
+		t.Errorf("expected no outstanding acquires but got %d", n)
+	}
+}
+
+func TestAcquireTrackingThroughDo(t *testing.T) {
+	lpool := NewPool(1, nil, WithAcquireTracking(true))
+	var site AcquireSite
+	err := lpool.Do(func(vm *lua.State) error {
+		site = lpool.OutstandingAcquires()[0]
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(site.Caller, "tracking_test.go") || !strings.HasSuffix(site.Function, "TestAcquireTrackingThroughDo") {
+		t.Errorf("expected the caller of Do but got %q in %q", site.Function, site.Caller)
+	}
+}
+
+func TestAcquireTrackingDisabled(t *testing.T) {
+	lpool := NewPool(1, nil)
+	lvm := lpool.Acquire()
+	defer lpool.Release(lvm)
+	if n := len(lpool.OutstandingAcquires()); n != 0 {
+		t.Errorf("expected no recorded acquires but got %d", n)
+	}
+}
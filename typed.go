@@ -0,0 +1,59 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+// Like Pool.Eval but converts the first value returned by the chunk into T
+// (see Unmarshal) instead of returning []any. Further results are ignored, the
+// zero value is returned if the chunk returns nothing or nil.
+func EvalAs[T any](ctx context.Context, p *Pool, code string, args ...any) (T, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	q := p.quotaFor(ctx, "")
+	var result T
+	err := p.do(ctx, q, func(vm *lua.State) error {
+		vm.PushGoFunction(tracebackHandler)
+		handler := vm.Top()
+		if err := lua.LoadString(vm, code); err != nil {
+			return err
+		}
+		return callAs(vm, handler, handler, args, q.Output, &result)
+	})
+	return result, err
+}
+
+// Like Pool.CallGlobal but converts the first value returned by the function
+// into T, see EvalAs.
+func CallAs[T any](ctx context.Context, p *Pool, fnName string, args ...any) (T, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	q := p.quotaFor(ctx, "")
+	var result T
+	err := p.do(ctx, q, func(vm *lua.State) error {
+		vm.PushGoFunction(tracebackHandler)
+		handler := vm.Top()
+		vm.Global(fnName)
+		if !vm.IsFunction(-1) {
+			return fmt.Errorf("%w: %s", ErrFunctionNotFound, fnName)
+		}
+		return callAs(vm, handler, handler, args, q.Output, &result)
+	})
+	return result, err
+}
+
+// like call but unmarshals the first result into v
+func callAs(vm *lua.State, base int, handler int, args []any, limits ConvertLimits, v any) error {
+	if err := protectedCall(vm, handler, args); err != nil {
+		return err
+	}
+	if vm.Top() == base {
+		return nil
+	}
+	return limits.Unmarshal(vm, base+1, v)
+}
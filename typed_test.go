@@ -0,0 +1,61 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+func TestEvalAs(t *testing.T) {
+	lpool := NewPool(1, nil)
+	ctx := context.Background()
+
+	n, err := EvalAs[int](ctx, lpool, "local a, b = ... return a + b", 40, 2)
+	if err != nil || n != 42 {
+		t.Errorf("expected 42 but got %v, %v", n, err)
+	}
+
+	cfg, err := EvalAs[testConfig](ctx, lpool, `return {ID = 3, name = "api", tags = {"a", "b"}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := testConfig{testBase: testBase{ID: 3}, Name: "api", Tags: []string{"a", "b"}}
+	if !reflect.DeepEqual(cfg, expected) {
+		t.Errorf("expected %+v but got %+v", expected, cfg)
+	}
+
+	if s, err := EvalAs[string](ctx, lpool, "return"); err != nil || s != "" {
+		t.Errorf("expected zero value but got %q, %v", s, err)
+	}
+	if _, err := EvalAs[int](ctx, lpool, `return "x"`); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("expected type mismatch but got %v", err)
+	}
+}
+
+func TestCallAs(t *testing.T) {
+	lpool := NewPool(1, func() *lua.State {
+		vm := NewLuaVM()
+		lua.DoString(vm, `function double(list)
+			local out = {}
+			for i, v in ipairs(list) do out[i] = v * 2 end
+			return out
+		end`)
+		return vm
+	})
+	ctx := context.Background()
+
+	list, err := CallAs[[]int](ctx, lpool, "double", []int{1, 2, 3})
+	if err != nil || !reflect.DeepEqual(list, []int{2, 4, 6}) {
+		t.Errorf("expected doubled list but got %v, %v", list, err)
+	}
+	if _, err := CallAs[[]int](ctx, lpool, "missing"); !errors.Is(err, ErrFunctionNotFound) {
+		t.Errorf("expected function not found but got %v", err)
+	}
+	var serr *ScriptError
+	if _, err := CallAs[[]int](ctx, lpool, "double", 1); !errors.As(err, &serr) {
+		t.Errorf("expected script error but got %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package pool
+
+import (
+	"context"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+// true if the VM was created before the last RollingUpdate
+func (p *Pool) isStale(vm *lua.State) bool {
+	return p.core.IsStale(vm)
+}
+
+// replaces a VM held by a caller whose state can't be trusted anymore, e.g.
+// after an interrupted execution. The replacement is created in the background
+// so the caller doesn't pay for it.
+func (p *Pool) recycle(vm *lua.State) {
+	p.untrackAcquire(vm)
+	if p.debug {
+		p.logDrop(vm, "recycled")
+	}
+	p.core.Discard(vm)
+}
+
+// moves a VM held by a caller into quarantine instead of releasing it
+func (p *Pool) quarantine(vm *lua.State, reason error) {
+	p.untrackAcquire(vm)
+	if p.debug {
+		p.logDrop(vm, "quarantined")
+	}
+	p.core.Quarantine(vm, reason)
+}
+
+// handles a VM held across executions, e.g. by pinned executors or RunStream,
+// after an execution like Pool.do does on release. Returns false if the VM was
+// replaced, quarantined or released because it is stale or reached the auto
+// recycle threshold.
+func (p *Pool) keep(ctx context.Context, vm *lua.State, err error) bool {
+	recycle := p.mustRecycle(err)
+	var quarantine error
+	if !recycle {
+		recycle, quarantine = p.afterExec(ctx, vm, err)
+	}
+	switch {
+	case recycle:
+		p.recycle(vm)
+	case quarantine != nil:
+		p.quarantine(vm, quarantine)
+	case p.isStale(vm) || p.doomed(vm):
+		// doomed VMs are replaced or quarantined by the validator
+		p.Release(vm)
+	default:
+		p.reset(vm)
+		return true
+	}
+	return false
+}
+
+// cleans up the state a user left in a VM before it is returned to the pool.
+// Also called for held VMs between executions, e.g. by pinned executors.
+func (p *Pool) reset(vm *lua.State) {
+	if p.snapshotGlobals {
+		restoreGlobals(vm)
+	}
+	if p.readOnlyGlobals {
+		resetGlobals(vm)
+	}
+	if p.scrubRegistry {
+		scrubRegistry(vm)
+	}
+	if p.deterministic != nil {
+		reseed(vm)
+	}
+	p.collectGarbage()
+}
@@ -0,0 +1,36 @@
+package pool
+
+import (
+	"context"
+
+	lua "github.com/epikur-io/go-lua"
+	"github.com/epikur-io/go-lua-pool/generic"
+)
+
+// Returned for weights below 1, above the capacity of the pool or if the
+// backend doesn't support weights (only SemaphoreBackend without shards does)
+var ErrInvalidWeight = generic.ErrInvalidWeight
+
+type weightKey struct{}
+
+// Returns a context making the executions it is passed to (DoWithContext, Eval,
+// Run, ...) acquire their VM with the given weight, see AcquireWeighted
+func ContextWithWeight(ctx context.Context, weight int) context.Context {
+	return context.WithValue(ctx, weightKey{}, weight)
+}
+
+// Returns the weight set by ContextWithWeight
+func WeightFromContext(ctx context.Context) (int, bool) {
+	w, ok := ctx.Value(weightKey{}).(int)
+	return w, ok
+}
+
+// Acquires a VM which takes weight slots of the pool until it is released, so
+// expensive scripts can reserve more of the capacity and leave less room for
+// further heavy executions. Waiting acquires are served in order, light ones
+// don't overtake a waiting heavy one.
+func (p *Pool) AcquireWeighted(ctx context.Context, weight int) (*lua.State, error) {
+	start := p.debugNow()
+	vm, err := p.core.AcquireWeighted(ctx, weight)
+	return p.finishAcquire(vm, start, err)
+}
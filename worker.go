@@ -0,0 +1,45 @@
+package pool
+
+import (
+	"context"
+
+	lua "github.com/epikur-io/go-lua"
+)
+
+// Returns a function running fn on a VM like DoWithContext, for use as
+// errgroup.Group.Go(p.Go(ctx, fn)). ctx should be the context of the group, so
+// a failing worker cancels the acquires of the others.
+func (p *Pool) Go(ctx context.Context, fn func(*lua.State) error) func() error {
+	return func() error {
+		return p.DoWithContext(ctx, fn)
+	}
+}
+
+// Returns a function processing items until the channel is closed or ctx is
+// done, for use as errgroup.Group.Go(Worker(ctx, p, items, fn)). A VM is
+// acquired per item and released before the next one is received, so a small
+// pool can serve more workers and no worker holds a VM while it waits for
+// input. The first error of fn stops the worker and is returned, ctx.Err() if
+// ctx is done. Items are never passed to fn after ctx is done.
+func Worker[T any](ctx context.Context, p *Pool, items <-chan T, fn func(*lua.State, T) error) func() error {
+	return func() error {
+		for {
+			select {
+			case item, ok := <-items:
+				if !ok {
+					return nil
+				}
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				if err := p.DoWithContext(ctx, func(vm *lua.State) error {
+					return fn(vm, item)
+				}); err != nil {
+					return err
+				}
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package pool_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	lua "github.com/epikur-io/go-lua"
+	pool "github.com/epikur-io/go-lua-pool"
+	"golang.org/x/sync/errgroup"
+)
+
+func TestWorker(t *testing.T) {
+	lpool := pool.NewPool(2, nil)
+	g, ctx := errgroup.WithContext(context.Background())
+	items := make(chan int)
+	var sum atomic.Int64
+	// more workers than VMs, each VM is only held while an item is processed
+	for range 4 {
+		g.Go(pool.Worker(ctx, lpool, items, func(vm *lua.State, n int) error {
+			if err := lua.DoString(vm, fmt.Sprintf("return %d * 2", n)); err != nil {
+				return err
+			}
+			v, _ := vm.ToInteger(-1)
+			sum.Add(int64(v))
+			return nil
+		}))
+	}
+	for i := range 10 {
+		items <- i
+	}
+	close(items)
+	if err := g.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if sum.Load() != 90 {
+		t.Errorf("expected 90 but got %d", sum.Load())
+	}
+
+	// the first error cancels the other workers
+	errStop := errors.New("stop")
+	g, ctx = errgroup.WithContext(context.Background())
+	items = make(chan int)
+	for range 2 {
+		g.Go(pool.Worker(ctx, lpool, items, func(vm *lua.State, n int) error {
+			return errStop
+		}))
+	}
+	items <- 1
+	if err := g.Wait(); !errors.Is(err, errStop) {
+		t.Errorf("expected %v but got %v", errStop, err)
+	}
+	if s := lpool.Stats(); s.Idle != 2 {
+		t.Errorf("expected all VMs to be released but got %+v", s)
+	}
+}
+
+// Fans out scripts over a small pool. The group is limited to the capacity of
+// the pool and every goroutine acquires at most one VM at a time: acquiring a
+// second VM while holding one can deadlock once all VMs are held by goroutines
+// waiting for another one.
+func ExamplePool_Go() {
+	lpool := pool.NewPool(2, nil)
+	g, ctx := errgroup.WithContext(context.Background())
+	g.SetLimit(lpool.Cap())
+	results := make([]float64, 5)
+	for i := range results {
+		g.Go(lpool.Go(ctx, func(vm *lua.State) error {
+			if err := lua.DoString(vm, fmt.Sprintf("return %d ^ 2", i)); err != nil {
+				return err
+			}
+			results[i], _ = vm.ToNumber(-1)
+			return nil
+		}))
+	}
+	if err := g.Wait(); err != nil {
+		fmt.Println(err)
+	}
+	fmt.Println(results)
+	// Output: [0 1 4 9 16]
+}